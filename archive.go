@@ -0,0 +1,242 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+)
+
+//. Import
+
+// Put all xml files from an archive into the database, with the paths in the archive as document names.
+//
+// The archive can be a tar file, a gzipped tar file, or a zip file, which is read into memory first.
+// Only regular files with the extension .xml are used. A leading "./" or "/" is removed from the paths.
+// In a transactional environment, documents are put in transactions of 1000 documents, as with db.BeginBulk().
+// Returns the number of documents put into the database, before an error if there was one.
+//
+// Example:
+//
+//      fp, _ := os.Open("corpus.tar.gz")
+//      n, err := db.ImportArchive(fp, false)
+//      fp.Close()
+func (db *Db) ImportArchive(r io.Reader, replace bool) (int, error) {
+	bulk, err := db.BeginBulk(BulkConfig{})
+	if err != nil {
+		return 0, err
+	}
+	n, err := importArchive(bulk, r, replace)
+	if err == nil {
+		// the last batch is not counted if it can't be committed
+		pending := bulk.count
+		if err = bulk.Flush(); err != nil {
+			n -= pending
+		}
+	}
+	if e := bulk.End(); e != nil && err == nil {
+		err = e
+	}
+	return n, err
+}
+
+func importArchive(bulk *BulkLoader, r io.Reader, replace bool) (int, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return importZip(bulk, br, replace)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, err
+		}
+		defer zr.Close()
+		return importTar(bulk, zr, replace)
+	}
+	return importTar(bulk, br, replace)
+}
+
+func importTar(bulk *BulkLoader, r io.Reader, replace bool) (int, error) {
+	n := 0
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		name, ok := archiveName(hdr.Name)
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return n, err
+		}
+		if err := bulkPut(bulk, &n, name, string(data), replace); err != nil {
+			return n, err
+		}
+	}
+}
+
+func importZip(bulk *BulkLoader, r io.Reader, replace bool) (int, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, f := range zr.File {
+		name, ok := archiveName(f.Name)
+		if !ok || !f.Mode().IsRegular() {
+			continue
+		}
+		fr, err := f.Open()
+		if err != nil {
+			return n, err
+		}
+		data, err := ioutil.ReadAll(fr)
+		fr.Close()
+		if err != nil {
+			return n, err
+		}
+		if err := bulkPut(bulk, &n, name, string(data), replace); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Put a document, and count it. If the put fails, the documents of the aborted transaction are not counted.
+func bulkPut(bulk *BulkLoader, n *int, name, data string, replace bool) error {
+	pending := bulk.count
+	if err := bulk.PutXml(name, data, replace); err != nil {
+		*n -= pending
+		return err
+	}
+	*n++
+	return nil
+}
+
+// The document name for a path in an archive, false if it is not an xml file
+func archiveName(p string) (string, bool) {
+	if !strings.HasSuffix(strings.ToLower(p), ".xml") {
+		return "", false
+	}
+	for strings.HasPrefix(p, "./") || strings.HasPrefix(p, "/") {
+		p = strings.TrimPrefix(strings.TrimPrefix(p, "./"), "/")
+	}
+	return p, p != ""
+}
+
+//. Export
+
+// Write all documents in the database to w, as a gzipped tar file, with the document names as paths.
+//
+// The archive can be imported with db.ImportArchive(). Unlike db.Dump(), this doesn't include metadata.
+// So the import gets back the same names, each name must be a clean relative path with the extension .xml,
+// such as "a/b.xml", but not "a//b.xml", "./b.xml", "../b.xml", or "b". For any other name, this returns an error.
+//
+// Example:
+//
+//      fp, _ := os.Create("corpus.tar.gz")
+//      err := db.ExportArchive(fp)
+//      fp.Close()
+func (db *Db) ExportArchive(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	now := time.Now()
+	err := db.exportArchive(func(name, content string) error {
+		p, err := exportName(name)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name:     p,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  now,
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = io.WriteString(tw, content)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Write all documents in the database to w, as a zip file, with the document names as paths.
+//
+// See: db.ExportArchive()
+func (db *Db) ExportZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	now := time.Now()
+	err := db.exportArchive(func(name, content string) error {
+		p, err := exportName(name)
+		if err != nil {
+			return err
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     p,
+			Method:   zip.Deflate,
+			Modified: now,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(fw, content)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (db *Db) exportArchive(write func(name, content string) error) error {
+	docs, err := db.All()
+	if err != nil {
+		return err
+	}
+	defer docs.Close()
+	for docs.Next() {
+		if err := write(docs.Name(), docs.Content()); err != nil {
+			return err
+		}
+	}
+	return docs.Error()
+}
+
+// The name as a path, if it is a relative path, so the archive can be extracted safely,
+// and db.ImportArchive() gets back the same name
+func exportName(name string) (string, error) {
+	if p, ok := archiveName(name); !ok || p != name || path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("Document name can't be used as path in archive: %q", name)
+	}
+	return name, nil
+}
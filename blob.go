@@ -0,0 +1,174 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unsafe"
+)
+
+//. Variables
+
+var (
+	errblobkey = errors.New("Invalid blob key")
+)
+
+//. Blobs
+
+// Attach binary data, such as the original pdf of the document, to an xml document in the database, by key.
+//
+// The data is stored as binary metadata of the document, so it is removed with the document,
+// and it is written in the same transaction as the document. An existing blob with the same key is replaced.
+// The key must be a valid xml name without a prefix. Blobs are not included in docs.MetaData() and db.Dump(),
+// and they are lost when the document is replaced, for instance with db.PutXml() with replace set to true.
+//
+// Example:
+//
+//      pdf, _ := ioutil.ReadFile("doc1.pdf")
+//      err := db.PutBlob("doc1.xml", "pdf", pdf)
+func (db *Db) PutBlob(name, key string, data []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	if !validBlobKey(key) {
+		return errblobkey
+	}
+	_, err := db.blob(1, name, key, data)
+	if err == nil {
+		db.notify(ChangeEvent{Kind: ChangeUpdate, Name: name})
+	}
+	return err
+}
+
+// Get the binary data attached to an xml document in the database by db.PutBlob().
+//
+// If the document exists, but the blob doesn't, the error is ErrBlobNotFound.
+func (db *Db) GetBlob(name, key string) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return nil, errclosed
+	}
+	return db.blob(0, name, key, nil)
+}
+
+// Remove binary data attached to an xml document in the database by db.PutBlob().
+//
+// If the document exists, but the blob doesn't, the error is ErrBlobNotFound.
+func (db *Db) RemoveBlob(name, key string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	_, err := db.blob(2, name, key, nil)
+	if err == nil {
+		db.notify(ChangeEvent{Kind: ChangeUpdate, Name: name})
+	}
+	return err
+}
+
+// Get the keys of the binary data attached to an xml document in the database by db.PutBlob().
+func (db *Db) Blobs(name string) ([]string, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return nil, errclosed
+	}
+	b, err := db.blob(3, name, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return blobKeys(b), nil
+}
+
+func (db *Db) blob(op int, name, key string, data []byte) ([]byte, error) {
+	csname, csbuf := cstring(name)
+	defer csbuf.free()
+	cskey, keybuf := cstring(key)
+	defer keybuf.free()
+	csdata := &emptyCString[0]
+	if len(data) > 0 {
+		csdata = (*C.char)(unsafe.Pointer(&data[0]))
+	}
+	return blobResult(C.c_dbxml_blob(db.db, C.int(op), csname, cskey, csdata, C.ulonglong(len(data))))
+}
+
+// Attach binary data to an xml document in the database, in the transaction.
+//
+// Put the document and its blobs in one transaction, so the document never exists without them. See: db.PutBlob()
+func (t *Txn) PutBlob(name, key string, data []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.opened {
+		return errtxnclosed
+	}
+	if !validBlobKey(key) {
+		return errblobkey
+	}
+	_, err := t.blob(1, name, key, data)
+	if err == nil {
+		t.events = append(t.events, ChangeEvent{Kind: ChangeUpdate, Name: name})
+	}
+	return err
+}
+
+// Get the binary data attached to an xml document in the database, in the transaction. See: db.GetBlob()
+func (t *Txn) GetBlob(name, key string) ([]byte, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.opened {
+		return nil, errtxnclosed
+	}
+	return t.blob(0, name, key, nil)
+}
+
+func (t *Txn) blob(op int, name, key string, data []byte) ([]byte, error) {
+	csname, csbuf := cstring(name)
+	defer csbuf.free()
+	cskey, keybuf := cstring(key)
+	defer keybuf.free()
+	csdata := &emptyCString[0]
+	if len(data) > 0 {
+		csdata = (*C.char)(unsafe.Pointer(&data[0]))
+	}
+	return blobResult(C.c_dbxml_txn_blob(t.txn, C.int(op), csname, cskey, csdata, C.ulonglong(len(data))))
+}
+
+func blobResult(r C.c_dbxml_result) ([]byte, error) {
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return nil, resultError(r)
+	}
+	return C.GoBytes(unsafe.Pointer(C.c_dbxml_result_string(r)), C.int(C.c_dbxml_result_size(r))), nil
+}
+
+func blobKeys(b []byte) []string {
+	keys := make([]string, 0)
+	for len(b) > 0 {
+		p := bytes.IndexByte(b, 0)
+		keys = append(keys, string(b[:p]))
+		b = b[p+1:]
+	}
+	return keys
+}
+
+func validBlobKey(key string) bool {
+	return validName(key) && !strings.Contains(key, ":")
+}
@@ -0,0 +1,187 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"errors"
+)
+
+//. Types
+
+// Options for db.BeginBulk().
+type BulkConfig struct {
+	// The number of documents that are put in one transaction. If 0, 1000 is used.
+	//
+	// This is only used for a database in a transactional environment. Other databases don't commit each put.
+	BatchSize int
+
+	// Remove all indexes at the start of the bulk load, and add them again at the end, re-indexing all documents at once.
+	//
+	// This is faster when a lot of documents are added to a database with many indexes. Queries during the bulk
+	// load don't use the indexes, and indexes added with db.AddIndex() during the bulk load are lost at the end.
+	// If the program stops before bulk.End() or db.Close() is called, all indexes are lost.
+	DeferIndexes bool
+}
+
+// A bulk load of documents into a database, started with db.BeginBulk().
+//
+// A bulk load must be used by one goroutine at a time.
+type BulkLoader struct {
+	db        *Db
+	batchSize int
+	txn       *Txn
+	count     int
+	deferred  bool
+	opened    bool
+}
+
+//. Variables
+
+var (
+	errbulkclosed = errors.New("Bulk load is ended")
+)
+
+//. Bulk
+
+// Start a bulk load of documents into the database.
+//
+// In a transactional environment, documents are put in transactions of BatchSize documents, instead of
+// committing each document separately. If a put fails, the transaction with the documents since the last
+// commit is aborted, and the error is returned. The bulk load can then be continued with a new transaction.
+//
+// Example:
+//
+//      bulk, err := db.BeginBulk(dbxml.BulkConfig{BatchSize: 5000, DeferIndexes: true})
+//      if err != nil {
+//          return err
+//      }
+//      for _, name := range names {
+//          if err := bulk.PutXml(name, data[name], false); err != nil {
+//              bulk.End()
+//              return err
+//          }
+//      }
+//      return bulk.End()
+func (db *Db) BeginBulk(config BulkConfig) (*BulkLoader, error) {
+	var info ContainerInfo
+	if err := db.info(&info); err != nil {
+		return nil, err
+	}
+	if info.ReadOnly {
+		return nil, errors.New("Database is read-only")
+	}
+	b := &BulkLoader{
+		db:        db,
+		batchSize: config.BatchSize,
+		opened:    true,
+	}
+	if b.batchSize <= 0 {
+		b.batchSize = 1000
+	}
+	if !info.Transactional {
+		b.batchSize = 0
+	}
+	if config.DeferIndexes {
+		if err := db.suspendIndexes(); err != nil {
+			return nil, err
+		}
+		b.deferred = true
+	}
+	return b, nil
+}
+
+// Put an xml document from memory into the database, as part of the bulk load.
+func (b *BulkLoader) PutXml(name string, data string, replace bool) error {
+	if !b.opened {
+		return errbulkclosed
+	}
+	if b.batchSize == 0 {
+		return b.db.PutXml(name, data, replace)
+	}
+	if b.txn == nil {
+		t, err := b.db.Begin()
+		if err != nil {
+			return err
+		}
+		b.txn = t
+	}
+	if err := b.txn.PutXml(name, data, replace); err != nil {
+		b.txn.Abort()
+		b.txn = nil
+		b.count = 0
+		return err
+	}
+	b.count++
+	if b.count >= b.batchSize {
+		return b.Flush()
+	}
+	return nil
+}
+
+// Commit the documents that were put since the last commit.
+func (b *BulkLoader) Flush() error {
+	if !b.opened {
+		return errbulkclosed
+	}
+	if b.txn == nil {
+		return nil
+	}
+	t := b.txn
+	b.txn = nil
+	b.count = 0
+	return t.Commit()
+}
+
+// End the bulk load. Remaining documents are committed, and deferred indexes are added again.
+//
+// The bulk load is ended, even if this returns an error.
+func (b *BulkLoader) End() error {
+	if !b.opened {
+		return errbulkclosed
+	}
+	err := b.Flush()
+	b.opened = false
+	if b.deferred {
+		if err2 := b.db.resumeIndexes(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+func (db *Db) suspendIndexes() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	r := C.c_dbxml_suspend_indexes(db.db)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
+
+func (db *Db) resumeIndexes() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		// Indexes were restored when the database was closed
+		return nil
+	}
+	r := C.c_dbxml_resume_indexes(db.db)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
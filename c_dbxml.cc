@@ -1,55 +1,605 @@
 #include "c_dbxml.h"
 #include <dbxml/DbXml.hpp>
 #include <string>
+#include <set>
+#include <map>
+#include <vector>
+#include <sstream>
+#include <cstdlib>
+#include <cstring>
+#include <ctime>
+#include <exception>
+#include <stdexcept>
+#include <fnmatch.h>
+#include <unistd.h>
+#include <climits>
 
 #define ALIAS "c_dbxml"
+#define DBXML_URI "http://www.sleepycat.com/2002/dbxml"
+#define VERSION_URI "https://github.com/pebbe/dbxml/version"
+#define DCTERMS_URI "http://purl.org/dc/terms/"
+#define BLOB_URI "https://github.com/pebbe/dbxml/blob"
 
 extern "C" {
 
+    // implemented in Go
+    long long goReaderRead(unsigned long long handle, char *buf, unsigned int size);
+    unsigned long long goResolveFunction(char *uri, char *name, int nargs);
+    int goCallFunction(unsigned long long handle, char *args, unsigned long long size, int *counts, int nargs, char **result, unsigned long long *resultsize);
+    int goResolve(int kind, char *uri, char **result, unsigned long long *resultsize);
+    int goMergeProgress(unsigned long long handle, unsigned long long count);
+    void goLog(int level, char *msg);
+    int goCompress(char *name, int decompress, char *data, unsigned long long size, char **result, unsigned long long *resultsize);
+    int goTransform(unsigned long long handle, char *name, char *data, unsigned long long size, char **result, unsigned long long *resultsize);
+
+    class GoInputStream : public DbXml::XmlInputStream {
+    public:
+	GoInputStream(unsigned long long handle) : handle(handle), pos(0) {}
+	unsigned int curPos() const {
+	    return pos;
+	}
+	unsigned int readBytes(char *toFill, const unsigned int maxToRead) {
+	    long long n = goReaderRead(handle, toFill, maxToRead);
+	    if (n < 0) {
+		// not end of input, so the document that was read so far isn't stored
+		throw DbXml::XmlException(DbXml::XmlException::INVALID_VALUE, "Error reading document from io.Reader");
+	    }
+	    if (n == 0) {
+		return 0;
+	    }
+	    pos += (unsigned int) n;
+	    return (unsigned int) n;
+	}
+    private:
+	unsigned long long handle;
+	unsigned int pos;
+    };
+
+    class GoExternalFunction : public DbXml::XmlExternalFunction {
+    public:
+	GoExternalFunction(unsigned long long handle) : handle(handle) {}
+	DbXml::XmlResults execute(DbXml::XmlTransaction &txn, DbXml::XmlManager &mgr, DbXml::XmlArguments const &args) const {
+	    // arguments are passed as strings, each followed by a null byte, and the number of strings per argument
+	    std::string buf;
+	    unsigned int n = args.getNumberOfArgs();
+	    std::vector<int> counts(n + 1, 0);
+	    for (unsigned int i = 0; i < n; i++) {
+		DbXml::XmlResults arg = args.getArgument(i);
+		DbXml::XmlValue value;
+		while (arg.next(value)) {
+		    buf.append(value.asString());
+		    buf.push_back('\0');
+		    counts[i]++;
+		}
+	    }
+
+	    char *result = 0;
+	    unsigned long long size = 0;
+	    int err = goCallFunction(handle, (char *) buf.data(), (unsigned long long) buf.size(), &counts[0], (int) n, &result, &size);
+	    std::string s;
+	    if (result) {
+		s.assign(result, size);
+		free(result);
+	    }
+	    if (err) {
+		throw DbXml::XmlException(DbXml::XmlException::QUERY_EVALUATION_ERROR, s);
+	    }
+
+	    // results are returned in the same format as the arguments
+	    DbXml::XmlResults results = mgr.createResults();
+	    std::string::size_type start = 0;
+	    for (std::string::size_type i = 0; i < s.size(); i++) {
+		if (s[i] == '\0') {
+		    results.add(DbXml::XmlValue(s.substr(start, i - start)));
+		    start = i + 1;
+		}
+	    }
+	    return results;
+	}
+	void close() {
+	    delete this;
+	}
+    private:
+	unsigned long long handle;
+    };
+
+    // kind: 0 = document, 1 = schema, 2 = entity
+    // returns false if the uri is not resolved by Go, throws on error
+    static bool c_dbxml_go_resolve(int kind, std::string const &uri, std::string &content)
+    {
+	char *result = 0;
+	unsigned long long size = 0;
+	int status = goResolve(kind, (char *) uri.c_str(), &result, &size);
+	if (result) {
+	    content.assign(result, size);
+	    free(result);
+	}
+	if (status == 2) {
+	    throw DbXml::XmlException(DbXml::XmlException::INVALID_VALUE, content);
+	}
+	return status == 1;
+    }
+
+    class GoResolver : public DbXml::XmlResolver {
+    public:
+	bool resolveDocument(DbXml::XmlTransaction *txn, DbXml::XmlManager &mgr, std::string const &uri, DbXml::XmlValue &result) const {
+	    std::string content;
+	    if (!c_dbxml_go_resolve(0, uri, content)) {
+		return false;
+	    }
+	    DbXml::XmlDocument doc = mgr.createDocument();
+	    doc.setName(uri);
+	    doc.setContent(content);
+	    result = DbXml::XmlValue(doc);
+	    return true;
+	}
+	DbXml::XmlInputStream *resolveSchema(DbXml::XmlTransaction *txn, DbXml::XmlManager &mgr,
+					     std::string const &schemaLocation, std::string const &nameSpace) const {
+	    std::string content;
+	    if (!c_dbxml_go_resolve(1, schemaLocation, content)) {
+		return 0;
+	    }
+	    return mgr.createMemBufInputStream(content.data(), (unsigned int) content.size(), true);
+	}
+	DbXml::XmlInputStream *resolveEntity(DbXml::XmlTransaction *txn, DbXml::XmlManager &mgr,
+					     std::string const &systemId, std::string const &publicId) const {
+	    std::string content;
+	    if (!c_dbxml_go_resolve(2, systemId, content)) {
+		return 0;
+	    }
+	    return mgr.createMemBufInputStream(content.data(), (unsigned int) content.size(), true);
+	}
+	DbXml::XmlExternalFunction *resolveExternalFunction(DbXml::XmlTransaction *txn, DbXml::XmlManager &mgr,
+							    std::string const &uri, std::string const &name, size_t numberOfArgs) const {
+	    unsigned long long handle = goResolveFunction((char *) uri.c_str(), (char *) name.c_str(), (int) numberOfArgs);
+	    if (!handle) {
+		return 0;
+	    }
+	    return new GoExternalFunction(handle);
+	}
+    };
+
+    class GoCompression : public DbXml::XmlCompression {
+    public:
+	GoCompression(std::string const &name) : name(name) {}
+	bool compress(DbXml::XmlTransaction &txn, DbXml::XmlData const &source, DbXml::XmlData &dest) {
+	    return transform(0, source, dest);
+	}
+	bool decompress(DbXml::XmlTransaction &txn, DbXml::XmlData const &source, DbXml::XmlData &dest) {
+	    return transform(1, source, dest);
+	}
+    private:
+	bool transform(int decompress, DbXml::XmlData const &source, DbXml::XmlData &dest) {
+	    char *result = 0;
+	    unsigned long long size = 0;
+	    int status = goCompress((char *) name.c_str(), decompress, (char *) source.get_data(), source.get_size(), &result, &size);
+	    if (status == 1) {
+		dest.set(result, (u_int32_t) size);
+	    }
+	    if (result) {
+		free(result);
+	    }
+	    return status == 1;
+	}
+	std::string name;
+    };
+
+    // compressions registered from Go, registered with each manager when a container is opened, they must outlive the managers
+    static std::map<std::string, GoCompression *> c_dbxml_compressions;
+
+    // one resolver for all managers, it must outlive them
+    static GoResolver c_dbxml_resolver;
+
+    struct c_dbxml_errstate {
+	c_dbxml_errstate() : code(0), line(0), column(0), dberrno(0) {}
+	int code;
+	int line;
+	int column;
+	int dberrno;
+    };
+
+    // set the error number of Berkeley DB, and the code for a deadlock or a timeout
+    static void c_dbxml_set_dberrno(c_dbxml_errstate &info, int dberrno)
+    {
+	info.dberrno = dberrno;
+	if (dberrno == DB_LOCK_DEADLOCK) {
+	    info.code = 11;
+	} else if (dberrno == DB_LOCK_NOTGRANTED) {
+	    // lock or transaction timeout, with DB_TIME_NOTGRANTED
+	    info.code = 9;
+	}
+    }
+
+    static void c_dbxml_set_errinfo(c_dbxml_errstate &info, DbXml::XmlException const &xe)
+    {
+	switch (xe.getExceptionCode()) {
+	case DbXml::XmlException::DOCUMENT_NOT_FOUND:
+	    info.code = 1;
+	    break;
+	case DbXml::XmlException::UNIQUE_ERROR:
+	    info.code = 2;
+	    break;
+	case DbXml::XmlException::CONTAINER_CLOSED:
+	    info.code = 3;
+	    break;
+	case DbXml::XmlException::CONTAINER_NOT_FOUND:
+	    info.code = 4;
+	    break;
+	case DbXml::XmlException::CONTAINER_EXISTS:
+	    info.code = 5;
+	    break;
+	case DbXml::XmlException::QUERY_PARSER_ERROR:
+	    info.code = 6;
+	    break;
+	case DbXml::XmlException::QUERY_EVALUATION_ERROR:
+	    info.code = 7;
+	    break;
+	case DbXml::XmlException::OPERATION_INTERRUPTED:
+	    info.code = 8;
+	    break;
+	case DbXml::XmlException::OPERATION_TIMEOUT:
+	    info.code = 9;
+	    break;
+	case DbXml::XmlException::INDEXER_PARSER_ERROR:
+	    info.code = 10;
+	    break;
+	default:
+	    info.code = 0;
+	}
+	info.line = xe.getQueryLine();
+	info.column = xe.getQueryColumn();
+	c_dbxml_set_dberrno(info, xe.getDbErrno());
+
+	if (info.code == 10) {
+	    // parse or validation error in a document, the position is only available in the message:
+	    // "... Parse error in document at line, 7, char 3. Parser message: ..."
+	    std::string msg(xe.what());
+	    std::string::size_type i = msg.find("at line, ");
+	    if (i != std::string::npos) {
+		char *end;
+		info.line = (int) strtol(msg.c_str() + i + 9, &end, 10);
+		if (end[0] == ',' && end[1] == ' ' && strncmp(end + 2, "char ", 5) == 0) {
+		    info.column = (int) strtol(end + 7, 0, 10);
+		}
+	    }
+	}
+    }
+
+    // Store the message and the error info of the exception that is being handled. Call this only in a catch block.
+    static void c_dbxml_catch_msg(std::string &errstring, c_dbxml_errstate &info)
+    {
+	info = c_dbxml_errstate();
+	try {
+	    throw;
+	} catch (DbXml::XmlException const &xe) {
+	    errstring = xe.what();
+	    c_dbxml_set_errinfo(info, xe);
+	} catch (std::exception const &e) {
+	    errstring = e.what();
+	} catch (...) {
+	    errstring = "Unknown error";
+	}
+    }
+
+    static void c_dbxml_catch(std::string &errstring, bool &error, c_dbxml_errstate &info)
+    {
+	c_dbxml_catch_msg(errstring, info);
+	error = true;
+    }
+
+    // abort the transaction, if any, after an error
+    static void c_dbxml_abort(DbXml::XmlTransaction &txn)
+    {
+	try {
+	    if (!txn.isNull()) {
+		txn.abort();
+	    }
+	} catch (DbXml::XmlException &) {
+	    ;
+	}
+    }
+
+    static c_dbxml_errinfo c_dbxml_get_errinfo(c_dbxml_errstate const &state)
+    {
+	c_dbxml_errinfo info;
+	info.code = state.code;
+	info.line = state.line;
+	info.column = state.column;
+	info.dberrno = state.dberrno;
+	return info;
+    }
+
     struct c_dbxml_t {
+	c_dbxml_t() : alias(ALIAS), timeout(0), snapshot(false), timestamps(false), suspended(false), unordered(false), seqdb(0), transform(0) {}
+	c_dbxml_t(DbXml::XmlManager const &m) : manager(m), alias(ALIAS), timeout(0), snapshot(false), timestamps(false), suspended(false), unordered(false), seqdb(0), transform(0) {}
+	~c_dbxml_t() {
+	    for (std::map<std::string, DB_SEQUENCE *>::iterator it = sequences.begin(); it != sequences.end(); ++it) {
+		it->second->close(it->second, 0);
+	    }
+	    if (seqdb) {
+		seqdb->close(seqdb, 0);
+	    }
+	}
 	DbXml::XmlManager manager;
 	DbXml::XmlUpdateContext context;
 	DbXml::XmlContainer container;
 	DbXml::XmlContainerConfig config;
+	// the alias of the container in queries, unique within the manager
+	std::string alias;
+	unsigned int timeout;
+	bool snapshot;
+	// stamp dcterms:created and dcterms:modified on each put
+	bool timestamps;
+	// indexes removed during a bulk load, restored by c_dbxml_resume_indexes or c_dbxml_close
+	bool suspended;
+	DbXml::XmlIndexSpecification indexes;
+	// declare ordering unordered in queries prepared by c_dbxml_prepare_query
+	bool unordered;
+	std::string baseURI;
+	std::vector<std::string> aliases;
+	// sequences, stored in a separate database file, opened when first used
+	DB *seqdb;
+	std::map<std::string, DB_SEQUENCE *> sequences;
+	// applied to the content of each document that is stored, the query first, then the Go function
+	unsigned long long transform;
+	DbXml::XmlQueryExpression transformQuery;
+	// XInclude processing and whitespace stripping before the other transformations, not null if enabled
+	DbXml::XmlQueryExpression xinclude;
+	DbXml::XmlQueryExpression strip;
 	bool error;
 	std::string filename;
 	std::string errstring;
+	c_dbxml_errstate info;
     };
 
     struct c_dbxml_result_t {
 	std::string result;
 	bool error;
+	c_dbxml_errstate info;
     };
 
     struct c_dbxml_docs_t {
+	c_dbxml_docs_t() : manager(0), sharedTxn(false), namesOnly(false), offset(0), skip(0), limit(0), count(0) {}
+	// for queries on the current result, by c_dbxml_docs_query
+	DbXml::XmlManager *manager;
 	DbXml::XmlDocument doc;
 	DbXml::XmlValue value;
+	DbXml::XmlTransaction txn;
+	// the transaction belongs to a c_dbxml_txn, and is not committed by c_dbxml_docs_free
+	bool sharedTxn;
+	DbXml::XmlQueryExpression expression;
 	DbXml::XmlResults it;
 	DbXml::XmlQueryContext context;
 	bool validDoc;
 	bool more;
+	bool namesOnly;
+	// if not empty, skip documents with names that don't match, see fnmatch(3)
+	std::string pattern;
+	unsigned long long offset;
+	unsigned long long skip;
+	unsigned long long limit;
+	unsigned long long count;
 	std::string name;
 	std::string content;
 	std::string match;
+	std::string handle;
 	std::string result;
+	std::string batch;
 	bool error;
 	std::string errstring;
+	c_dbxml_errstate info;
     };
 
     struct c_dbxml_query_t {
+	c_dbxml_query_t() : manager(0), snapshot(false), isolation(0), flags(DbXml::DBXML_LAZY_DOCS | DbXml::DBXML_WELL_FORMED_ONLY) {}
+	DbXml::XmlManager *manager;
+	bool snapshot;
+	int isolation;
 	DbXml::XmlQueryContext context;
 	DbXml::XmlQueryExpression expression;
+	u_int32_t flags;
 	bool error;
 	std::string errstring;
+	c_dbxml_errstate info;
     };
 
-    c_dbxml c_dbxml_open(char const *filename, int readwrite, int read)
+    struct c_dbxml_env_t {
+	c_dbxml_env_t() : manager(0), logging(false), transactional(false), multiversion(false), encrypted(false), master(0), containers(0), wantRecovery(false), recovering(false) {}
+	DbXml::XmlManager *manager;
+	bool logging;
+	bool transactional;
+	bool multiversion;
+	// new containers are encrypted
+	bool encrypted;
+	// set by the replication event handler
+	volatile int master;
+	// the number of containers opened, for their aliases
+	unsigned long containers;
+	// recovery was requested when the environment is opened
+	bool wantRecovery;
+	// set by the message callback when recovery reports progress while the environment is opened
+	bool recovering;
+	std::string baseURI;
+	// for collection() without argument, empty if there is no default collection
+	std::string defaultCollection;
+	bool error;
+	std::string errstring;
+	c_dbxml_errstate info;
+    };
+
+    struct c_dbxml_txn_t {
+	c_dbxml db;
+	DbXml::XmlTransaction txn;
+	DbXml::XmlUpdateContext context;
+	bool error;
+	std::string errstring;
+	c_dbxml_errstate info;
+    };
+
+    struct c_dbxml_stream_t {
+	DbXml::XmlDocument doc;
+	DbXml::XmlInputStream *is;
+	bool error;
+	std::string errstring;
+	c_dbxml_errstate info;
+    };
+
+    static void c_dbxml_open_container(c_dbxml db, char const *filename, int readwrite, int read, int creation, int storage, int validate, char const *compression,
+				       unsigned int pagesize);
+
+    // log output of DbXml and Berkeley DB goes to Go, level: 0 = info, 1 = error
+    static void c_dbxml_errcall(DB_ENV const *dbenv, char const *prefix, char const *msg)
+    {
+	goLog(1, (char *) msg);
+    }
+
+    static void c_dbxml_msgcall(DB_ENV const *dbenv, char const *msg)
+    {
+	// app_private is also set for replication, so only messages during a requested recovery count
+	if (dbenv->app_private && ((c_dbxml_env) dbenv->app_private)->wantRecovery) {
+	    ((c_dbxml_env) dbenv->app_private)->recovering = true;
+	}
+	goLog(0, (char *) msg);
+    }
+
+    static void c_dbxml_set_logging(DB_ENV *dbenv)
+    {
+	dbenv->set_errcall(dbenv, c_dbxml_errcall);
+	dbenv->set_msgcall(dbenv, c_dbxml_msgcall);
+    }
+
+    void c_dbxml_set_log_level(int level, int enabled)
+    {
+	DbXml::setLogLevel((DbXml::LogLevel) level, enabled ? true : false);
+    }
+
+    void c_dbxml_set_log_category(int category, int enabled)
+    {
+	DbXml::setLogCategory((DbXml::LogCategory) category, enabled ? true : false);
+    }
+
+    void c_dbxml_register_compression(char const *name)
+    {
+	if (c_dbxml_compressions.find(name) == c_dbxml_compressions.end()) {
+	    c_dbxml_compressions[name] = new GoCompression(name);
+	}
+    }
+
+    c_dbxml c_dbxml_open(char const *filename, int readwrite, int read, int creation, int storage, int validate, char const *compression,
+			 unsigned long long cachesize, unsigned int pagesize, char const *password)
+    {
+	c_dbxml db;
+
+	if (cachesize || password[0]) {
+	    // a private environment like the default of XmlManager, with the given cache size and password
+	    DB_ENV *dbenv;
+	    int ret = db_env_create(&dbenv, 0);
+	    if (!ret) {
+		c_dbxml_set_logging(dbenv);
+		if (cachesize) {
+		    ret = dbenv->set_cachesize(dbenv,
+					       (u_int32_t) (cachesize / 1073741824ULL),
+					       (u_int32_t) (cachesize % 1073741824ULL),
+					       1);
+		}
+		if (!ret && password[0]) {
+		    ret = dbenv->set_encrypt(dbenv, password, DB_ENCRYPT_AES);
+		}
+		if (!ret) {
+		    ret = dbenv->open(dbenv, 0, DB_CREATE | DB_PRIVATE | DB_INIT_MPOOL | DB_THREAD, 0);
+		}
+		if (ret) {
+		    dbenv->close(dbenv, 0);
+		}
+	    }
+	    if (ret) {
+		db = new c_dbxml_t;
+		db->errstring = db_strerror(ret);
+		c_dbxml_set_dberrno(db->info, ret);
+		db->error = true;
+		return db;
+	    }
+	    try {
+		db = new c_dbxml_t(DbXml::XmlManager(dbenv, DbXml::DBXML_ADOPT_DBENV));
+	    } catch (...) {
+		dbenv->close(dbenv, 0);
+		db = new c_dbxml_t;
+		c_dbxml_catch(db->errstring, db->error, db->info);
+		return db;
+	    }
+	} else {
+	    db = new c_dbxml_t;
+	    c_dbxml_set_logging(db->manager.getDB_ENV());
+	}
+	db->manager.registerResolver(c_dbxml_resolver);
+	if (password[0]) {
+	    db->config.setEncrypted(true);
+	}
+	c_dbxml_open_container(db, filename, readwrite, read, creation, storage, validate, compression, pagesize);
+	return db;
+    }
+
+    c_dbxml c_dbxml_env_open_container(c_dbxml_env env, char const *filename, int readwrite, int read, int creation, int storage, int validate, char const *compression,
+				       unsigned int pagesize)
     {
 	c_dbxml db;
 
-	db = new c_dbxml_t;
+	db = new c_dbxml_t(*env->manager);
+	// containers share the manager, so each needs its own alias
+	std::ostringstream alias;
+	alias << ALIAS << ++env->containers;
+	db->alias = alias.str();
+	if (env->transactional) {
+	    // writes outside a transaction are auto-committed
+	    db->config.setTransactional(true);
+	    // allow queries and transactions with read uncommitted isolation
+	    db->config.setReadUncommitted(true);
+	}
+	if (env->multiversion) {
+	    // queries run in a snapshot transaction
+	    db->config.setMultiversion(true);
+	    db->snapshot = true;
+	}
+	if (env->encrypted) {
+	    db->config.setEncrypted(true);
+	}
+	c_dbxml_open_container(db, filename, readwrite, read, creation, storage, validate, compression, pagesize);
+	return db;
+    }
+
+    static void c_dbxml_open_container(c_dbxml db, char const *filename, int readwrite, int read, int creation, int storage, int validate, char const *compression,
+				       unsigned int pagesize)
+    {
 	db->filename = filename;
 
+	// an existing container needs the compression it was created with
+	for (std::map<std::string, GoCompression *>::iterator it = c_dbxml_compressions.begin(); it != c_dbxml_compressions.end(); ++it) {
+	    try {
+		db->manager.registerCompression(it->first.c_str(), *it->second);
+	    } catch (...) {
+		// already registered with a manager that is shared by an environment
+		;
+	    }
+	}
+	if (!strcmp(compression, "none")) {
+	    db->config.setCompressionName(DbXml::XmlContainerConfig::NO_COMPRESSION);
+	} else if (!strcmp(compression, "default")) {
+	    db->config.setCompressionName(DbXml::XmlContainerConfig::DEFAULT_COMPRESSION);
+	} else if (compression[0]) {
+	    db->config.setCompressionName(compression);
+	}
+
+	if (pagesize) {
+	    db->config.setPageSize(pagesize);
+	}
+
+	if (storage == 1) {
+	    db->config.setContainerType(DbXml::XmlContainer::NodeContainer);
+	} else if (storage == 2) {
+	    db->config.setContainerType(DbXml::XmlContainer::WholedocContainer);
+	}
+	db->config.setAllowValidation(validate ? true : false);
+
 	for (int i = 0; i < 2; i++) {
 	    /* if both: first attempt is read+write */
 	    if (i == 0 && readwrite == 0) {
@@ -61,378 +611,2990 @@ extern "C" {
 	    try {
 		db->context = db->manager.createUpdateContext();
 		if (i == 0) {
-		    db->config.setAllowCreate(true);
+		    db->config.setAllowCreate(creation != 2);
+		    db->config.setExclusiveCreate(creation == 1);
 		    db->config.setMode(0666);
 		} else {
 		    db->config.setAllowCreate(false);
+		    db->config.setExclusiveCreate(false);
 		    db->config.setReadOnly(true);
 		}
+		// the container is used by several threads concurrently
+		db->config.setThreaded(true);
 		db->container = db->manager.openContainer(filename, db->config);
 		db->error = false;
-		if (!db->container.addAlias(ALIAS)) {
-		    db->errstring = "Unable to add alias \"" ALIAS "\"";
+		if (!db->container.addAlias(db->alias)) {
+		    db->errstring = "Unable to add alias \"" + db->alias + "\"";
 		    db->error = true;
 		}
-	    } catch (DbXml::XmlException &xe) {
-		db->errstring = xe.what();
-		db->error = true;
+	    } catch (...) {
+		c_dbxml_catch(db->errstring, db->error, db->info);
 	    }
 	    if (db->error == false) {
 		break;
 	    }
 	}
+    }
 
-	return db;
+    static void c_dbxml_rep_event(DB_ENV *dbenv, u_int32_t event, void *info)
+    {
+	c_dbxml_env env = (c_dbxml_env) dbenv->app_private;
+	if (event == DB_EVENT_REP_MASTER) {
+	    env->master = 1;
+	} else if (event == DB_EVENT_REP_CLIENT) {
+	    env->master = 0;
+	}
     }
 
-    void c_dbxml_free(c_dbxml db)
+    static int c_dbxml_rep_site(DB_ENV *dbenv, char const *host, unsigned int port, u_int32_t which)
     {
-	delete db;
+	DB_SITE *site;
+	int ret;
+
+	ret = dbenv->repmgr_site(dbenv, host, port, &site, 0);
+	if (ret) {
+	    return ret;
+	}
+	ret = site->set_config(site, which, 1);
+	site->close(site);
+	return ret;
     }
 
-    int c_dbxml_error(c_dbxml db)
+    c_dbxml_env c_dbxml_env_open(char const *home, unsigned long long cachesize, char const *datadir, char const *logdir, int transactional, int multiversion,
+				 unsigned int locktimeout, unsigned int txntimeout,
+				 char const *localhost, unsigned int localport, char const **remotehosts, unsigned int *remoteports,
+				 int role, int priority, char const *password, int multiprocess, int recovery)
     {
-	return db->error ? 1 : 0;
+	c_dbxml_env env;
+	DB_ENV *dbenv;
+	u_int32_t flags;
+	int ret;
+
+	env = new c_dbxml_env_t;
+	env->manager = 0;
+	env->error = false;
+
+	ret = db_env_create(&dbenv, 0);
+	if (ret) {
+	    env->errstring = db_strerror(ret);
+	    c_dbxml_set_dberrno(env->info, ret);
+	    env->error = true;
+	    return env;
+	}
+	c_dbxml_set_logging(dbenv);
+	if (cachesize) {
+	    ret = dbenv->set_cachesize(dbenv,
+				       (u_int32_t) (cachesize / 1073741824ULL),
+				       (u_int32_t) (cachesize % 1073741824ULL),
+				       1);
+	}
+	if (!ret && datadir[0]) {
+	    ret = dbenv->add_data_dir(dbenv, datadir);
+	}
+	if (!ret && logdir[0]) {
+	    ret = dbenv->set_lg_dir(dbenv, logdir);
+	}
+	if (!ret && multiversion) {
+	    ret = dbenv->set_flags(dbenv, DB_MULTIVERSION, 1);
+	}
+	if (!ret && (transactional || multiversion)) {
+	    // abort one of the transactions in a deadlock
+	    ret = dbenv->set_lk_detect(dbenv, DB_LOCK_DEFAULT);
+	}
+	if (!ret && locktimeout) {
+	    ret = dbenv->set_timeout(dbenv, (db_timeout_t) locktimeout, DB_SET_LOCK_TIMEOUT);
+	}
+	if (!ret && txntimeout) {
+	    ret = dbenv->set_timeout(dbenv, (db_timeout_t) txntimeout, DB_SET_TXN_TIMEOUT);
+	}
+	if (!ret && (locktimeout || txntimeout)) {
+	    // report a timeout as DB_LOCK_NOTGRANTED instead of DB_LOCK_DEADLOCK
+	    ret = dbenv->set_flags(dbenv, DB_TIME_NOTGRANTED, 1);
+	}
+	if (!ret && password[0]) {
+	    ret = dbenv->set_encrypt(dbenv, password, DB_ENCRYPT_AES);
+	}
+	flags = DB_CREATE | DB_INIT_LOCK | DB_INIT_LOG | DB_INIT_MPOOL | DB_INIT_TXN | DB_THREAD;
+	if (multiprocess && !recovery) {
+	    // recovery only runs if a registered process died without closing the environment
+	    flags |= DB_REGISTER | DB_RECOVER;
+	}
+	if (recovery) {
+	    // without DB_REGISTER, so recovery always runs
+	    flags |= recovery == 2 ? DB_RECOVER_FATAL : DB_RECOVER;
+	    if (!ret) {
+		// progress of recovery is reported through the message callback, which also tells that recovery has started
+		env->wantRecovery = true;
+		dbenv->app_private = env;
+		ret = dbenv->set_verbose(dbenv, DB_VERB_RECOVERY, 1);
+	    }
+	}
+	if (!ret && localhost[0]) {
+	    flags |= DB_INIT_REP;
+	    dbenv->app_private = env;
+	    ret = dbenv->set_event_notify(dbenv, c_dbxml_rep_event);
+	    if (!ret) {
+		ret = c_dbxml_rep_site(dbenv, localhost, localport, DB_LOCAL_SITE);
+	    }
+	    for (int i = 0; !ret && remotehosts[i]; i++) {
+		ret = c_dbxml_rep_site(dbenv, remotehosts[i], remoteports[i], DB_BOOTSTRAP_HELPER);
+	    }
+	    if (!ret) {
+		ret = dbenv->rep_set_priority(dbenv, (u_int32_t) priority);
+	    }
+	}
+	if (!ret) {
+	    ret = dbenv->open(dbenv, home, flags, 0);
+	    if (ret && env->recovering) {
+		env->errstring = std::string("Recovery failed: ") + db_strerror(ret);
+		c_dbxml_set_dberrno(env->info, ret);
+		env->error = true;
+		dbenv->close(dbenv, 0);
+		return env;
+	    }
+	}
+	if (!ret && recovery) {
+	    ret = dbenv->set_verbose(dbenv, DB_VERB_RECOVERY, 0);
+	    env->wantRecovery = false;
+	    env->recovering = false;
+	}
+	if (!ret && localhost[0]) {
+	    // role: 0 = election, 1 = master, 2 = client
+	    ret = dbenv->repmgr_start(dbenv, 3, role == 1 ? DB_REP_MASTER : (role == 2 ? DB_REP_CLIENT : DB_REP_ELECTION));
+	}
+	if (ret) {
+	    env->errstring = db_strerror(ret);
+	    c_dbxml_set_dberrno(env->info, ret);
+	    env->error = true;
+	    dbenv->close(dbenv, 0);
+	    return env;
+	}
+
+	env->logging = true;
+	env->multiversion = multiversion ? true : false;
+	env->encrypted = password[0] ? true : false;
+	env->transactional = (transactional || multiversion || multiprocess || recovery || localhost[0]) ? true : false;
+
+	try {
+	    env->manager = new DbXml::XmlManager(dbenv, DbXml::DBXML_ADOPT_DBENV);
+	    env->manager->registerResolver(c_dbxml_resolver);
+	} catch (...) {
+	    c_dbxml_catch(env->errstring, env->error, env->info);
+	    dbenv->close(dbenv, 0);
+	}
+
+	return env;
     }
 
-    char const *c_dbxml_errstring(c_dbxml db)
+    c_dbxml_env c_dbxml_manager_new()
     {
-	return db->errstring.c_str();
+	c_dbxml_env env;
+
+	env = new c_dbxml_env_t;
+	env->manager = 0;
+	env->error = false;
+
+	try {
+	    env->manager = new DbXml::XmlManager();
+	    env->manager->registerResolver(c_dbxml_resolver);
+	    c_dbxml_set_logging(env->manager->getDB_ENV());
+	} catch (...) {
+	    c_dbxml_catch(env->errstring, env->error, env->info);
+	}
+
+	return env;
     }
 
-    void c_dbxml_result_free(c_dbxml_result r)
+    void c_dbxml_env_free(c_dbxml_env env)
     {
-	delete r;
+	// this also closes the adopted DB_ENV
+	delete env->manager;
+	delete env;
     }
 
-    int c_dbxml_result_error(c_dbxml_result r)
+    int c_dbxml_env_is_master(c_dbxml_env env)
     {
-	return r->error ? 1 : 0;
+	return env->master;
     }
 
-    char const *c_dbxml_result_string(c_dbxml_result r)
+    int c_dbxml_env_error(c_dbxml_env env)
     {
-	return r->result.c_str();
+	return env->error ? 1 : 0;
     }
 
-    c_dbxml_result c_dbxml_put_file(c_dbxml db, char const * filename, int replace)
+    char const *c_dbxml_env_errstring(c_dbxml_env env)
+    {
+	return env->errstring.c_str();
+    }
+
+    void c_dbxml_free(c_dbxml db)
+    {
+	delete db;
+    }
+
+    c_dbxml_result c_dbxml_close(c_dbxml db)
     {
 	c_dbxml_result r;
 	r = new c_dbxml_result_t;
-
-	if (replace) {
-	    try {
-		db->container.deleteDocument(filename, db->context);
-	    } catch (DbXml::XmlException &xe) {
-		;
+	r->error = false;
+	try {
+	    if (db->suspended) {
+		db->suspended = false;
+		db->container.setIndexSpecification(db->indexes, db->context);
+	    }
+	    if (!db->config.getReadOnly()) {
+		db->container.sync();
 	    }
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
 	}
-        try {
-            DbXml::XmlInputStream *is = db->manager.createLocalFileInputStream(filename);
-            db->container.putDocument(filename, is, db->context, DbXml::DBXML_WELL_FORMED_ONLY);
-	    r->error = false;
-        } catch (DbXml::XmlException &xe) {
-	    r->result = xe.what();
-	    r->error = true;
-        }
-
+	delete db;
 	return r;
     }
 
-    // replace if replace != 0
-    c_dbxml_result c_dbxml_put_xml(c_dbxml db, char const *name, char const *data, int replace)
+    c_dbxml_result c_dbxml_next_sequence(c_dbxml db, char const *name, unsigned long long *value)
     {
 	c_dbxml_result r;
+	DB_SEQUENCE *seq;
+	DBT key;
+	db_seq_t v;
+	int ret = 0;
+
 	r = new c_dbxml_result_t;
+	r->error = false;
 
-	if (replace) {
-	    try {
-		db->container.deleteDocument(name, db->context);
-	    } catch (DbXml::XmlException &xe) {
-		;
+	if (!db->seqdb) {
+	    DB_ENV *dbenv = db->manager.getDB_ENV();
+	    u_int32_t flags = DB_CREATE | DB_THREAD;
+	    if (db->config.getTransactional()) {
+		flags |= DB_AUTO_COMMIT;
+	    }
+	    ret = db_create(&db->seqdb, dbenv, 0);
+	    if (!ret) {
+		ret = db->seqdb->open(db->seqdb, NULL, (db->filename + ".seq").c_str(), NULL, DB_BTREE, flags, 0666);
+		if (ret) {
+		    db->seqdb->close(db->seqdb, 0);
+		}
+	    }
+	    if (ret) {
+		db->seqdb = 0;
+		r->result = db_strerror(ret);
+		c_dbxml_set_dberrno(r->info, ret);
+		r->error = true;
+		return r;
 	    }
 	}
 
-        try {
-            db->container.putDocument(name, data, db->context);
-	    r->error = false;
-        } catch (DbXml::XmlException &xe) {
-	    r->result = xe.what();
+	std::map<std::string, DB_SEQUENCE *>::iterator it = db->sequences.find(name);
+	if (it != db->sequences.end()) {
+	    seq = it->second;
+	} else {
+	    ret = db_sequence_create(&seq, db->seqdb, 0);
+	    if (!ret) {
+		// the first value is 1
+		ret = seq->initial_value(seq, 1);
+		if (!ret) {
+		    std::memset(&key, 0, sizeof(key));
+		    key.data = (void *) name;
+		    key.size = (u_int32_t) std::strlen(name);
+		    ret = seq->open(seq, NULL, &key, DB_CREATE | DB_THREAD);
+		}
+		if (ret) {
+		    seq->close(seq, 0);
+		}
+	    }
+	    if (ret) {
+		r->result = db_strerror(ret);
+		c_dbxml_set_dberrno(r->info, ret);
+		r->error = true;
+		return r;
+	    }
+	    db->sequences[name] = seq;
+	}
+
+	ret = seq->get(seq, NULL, 1, &v, 0);
+	if (ret) {
+	    r->result = db_strerror(ret);
+	    c_dbxml_set_dberrno(r->info, ret);
 	    r->error = true;
-        }
+	    return r;
+	}
+	*value = (unsigned long long) v;
 	return r;
     }
 
-    // replace if replace != 0
-    c_dbxml_result c_dbxml_merge(c_dbxml db, char const * dbxmlfile, int replace) {
-	c_dbxml_result r;
-	r = new c_dbxml_result_t;
+    c_dbxml_errinfo c_dbxml_errinfo_db(c_dbxml db)
+    {
+	return c_dbxml_get_errinfo(db->info);
+    }
 
-	DbXml::XmlContainer input = db->manager.openContainer(dbxmlfile);
-	DbXml::XmlDocument doc;
-	DbXml::XmlResults it = input.getAllDocuments(DbXml::DBXML_LAZY_DOCS);
-	while (it.next(doc)) {
+    c_dbxml_errinfo c_dbxml_errinfo_result(c_dbxml_result r)
+    {
+	return c_dbxml_get_errinfo(r->info);
+    }
+
+    c_dbxml_errinfo c_dbxml_errinfo_docs(c_dbxml_docs docs)
+    {
+	return c_dbxml_get_errinfo(docs->info);
+    }
+
+    c_dbxml_errinfo c_dbxml_errinfo_query(c_dbxml_query query)
+    {
+	return c_dbxml_get_errinfo(query->info);
+    }
+
+    c_dbxml_errinfo c_dbxml_errinfo_env(c_dbxml_env env)
+    {
+	return c_dbxml_get_errinfo(env->info);
+    }
+
+    c_dbxml_errinfo c_dbxml_errinfo_stream(c_dbxml_stream s)
+    {
+	return c_dbxml_get_errinfo(s->info);
+    }
+
+    int c_dbxml_error(c_dbxml db)
+    {
+	return db->error ? 1 : 0;
+    }
+
+    char const *c_dbxml_errstring(c_dbxml db)
+    {
+	return db->errstring.c_str();
+    }
+
+    void c_dbxml_result_free(c_dbxml_result r)
+    {
+	delete r;
+    }
+
+    int c_dbxml_result_error(c_dbxml_result r)
+    {
+	return r->error ? 1 : 0;
+    }
+
+    char const *c_dbxml_result_string(c_dbxml_result r)
+    {
+	return r->result.c_str();
+    }
+
+    c_dbxml_result c_dbxml_add_alias(c_dbxml db, char const *alias)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+
+	try {
+	    if (db->container.addAlias(alias)) {
+		db->aliases.push_back(alias);
+		r->error = false;
+	    } else {
+		r->result = std::string("Unable to add alias \"") + alias + "\"";
+		r->error = true;
+	    }
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    unsigned long long c_dbxml_result_size(c_dbxml_result r)
+    {
+	return (unsigned long long) r->result.size();
+    }
+
+    void c_dbxml_set_timestamps(c_dbxml db, int timestamps)
+    {
+	db->timestamps = timestamps ? true : false;
+    }
+
+    static std::string c_dbxml_now()
+    {
+	time_t t = time(0);
+	struct tm tm;
+	char buf[32];
+	gmtime_r(&t, &tm);
+	strftime(buf, sizeof(buf), "%Y-%m-%dT%H:%M:%SZ", &tm);
+	return buf;
+    }
+
+    // the creation time of an existing document, empty if there is none
+    static std::string c_dbxml_created(c_dbxml db, DbXml::XmlTransaction *txn, char const *name)
+    {
+	if (!db->timestamps) {
+	    return "";
+	}
+	try {
+	    DbXml::XmlDocument doc = txn ?
+		db->container.getDocument(*txn, name, DbXml::DBXML_LAZY_DOCS) :
+		db->container.getDocument(name, DbXml::DBXML_LAZY_DOCS);
+	    DbXml::XmlValue value;
+	    if (doc.getMetaData(DCTERMS_URI, "created", value)) {
+		return value.asString();
+	    }
+	} catch (...) {
+	    ;
+	}
+	return "";
+    }
+
+    // set modified to now, and created to now if it is empty
+    static void c_dbxml_stamp(c_dbxml db, DbXml::XmlDocument &doc, std::string const &created)
+    {
+	if (!db->timestamps) {
+	    return;
+	}
+	std::string now = c_dbxml_now();
+	doc.setMetaData(DCTERMS_URI, "created", DbXml::XmlValue(created.size() ? created : now));
+	doc.setMetaData(DCTERMS_URI, "modified", DbXml::XmlValue(now));
+    }
+
+    // a new document with timestamps
+    static DbXml::XmlDocument c_dbxml_new_doc(c_dbxml db, char const *name, std::string const &created)
+    {
+	DbXml::XmlDocument doc = db->manager.createDocument();
+	doc.setName(name);
+	c_dbxml_stamp(db, doc, created);
+	return doc;
+    }
+
+    static bool c_dbxml_transforms(c_dbxml db)
+    {
+	return db->transform || !db->transformQuery.isNull() || !db->xinclude.isNull() || !db->strip.isNull();
+    }
+
+    /* Replace each xi:include element by the root element of the included document, recursively.
+       Only parse="xml" without xpointer is supported, xi:fallback is not used.
+     */
+    static char const *c_dbxml_xinclude_query =
+	"declare namespace xi = 'http://www.w3.org/2001/XInclude';\n"
+	"declare variable $base external;\n"
+	"declare function local:x($n as node(), $base as xs:string, $depth as xs:integer) as node()* {\n"
+	"  typeswitch ($n)\n"
+	"  case element(xi:include) return\n"
+	"    if ($depth > 50) then error((), 'XInclude nesting too deep')\n"
+	"    else if ($n/@parse and $n/@parse != 'xml') then error((), concat('XInclude parse not supported: ', $n/@parse))\n"
+	"    else if ($n/@xpointer) then error((), 'XInclude xpointer not supported')\n"
+	"    else let $uri := resolve-uri($n/@href, $base) return local:x(doc($uri)/*, $uri, $depth + 1)\n"
+	"  case element() return element { node-name($n) } { $n/@*, for $c in $n/node() return local:x($c, $base, $depth) }\n"
+	"  case document-node() return document { for $c in $n/node() return local:x($c, $base, $depth) }\n"
+	"  default return $n\n"
+	"};\n"
+	"local:x(., $base, 0)\n";
+
+    /* Remove text nodes with only whitespace, from elements that have no other text, unless xml:space is preserve.
+     */
+    static char const *c_dbxml_strip_query =
+	"declare function local:s($n as node()) as node()* {\n"
+	"  typeswitch ($n)\n"
+	"  case element() return\n"
+	"    if ($n/ancestor-or-self::*[@xml:space][1]/@xml:space = 'preserve') then $n\n"
+	"    else element { node-name($n) } { $n/@*, for $c in $n/node() return local:s($c) }\n"
+	"  case document-node() return document { for $c in $n/node() return local:s($c) }\n"
+	"  case text() return\n"
+	"    if (normalize-space($n) = '' and not($n/../text()[normalize-space(.) != ''])) then () else $n\n"
+	"  default return $n\n"
+	"};\n"
+	"local:s(.)\n";
+
+    // the document name as a file uri, relative to the current directory
+    static std::string c_dbxml_file_uri(std::string const &name)
+    {
+	std::string path = name;
+	if (path[0] != '/') {
+	    char buf[PATH_MAX];
+	    if (getcwd(buf, sizeof(buf))) {
+		path = std::string(buf) + "/" + path;
+	    }
+	}
+	return "file://" + path;
+    }
+
+    // run a transformation query with the content as context item, returns the first item of the result
+    static std::string c_dbxml_transform_query(c_dbxml db, DbXml::XmlQueryExpression &expr, std::string const &content, std::string const &base)
+    {
+	// a temporary document, not stored in the container
+	DbXml::XmlDocument input = db->manager.createDocument();
+	input.setContent(content);
+	DbXml::XmlQueryContext context = db->manager.createQueryContext();
+	if (base.size()) {
+	    context.setVariableValue("base", DbXml::XmlValue(base));
+	}
+	DbXml::XmlResults results = expr.execute(DbXml::XmlValue(input), context);
+	DbXml::XmlValue value;
+	if (!results.next(value)) {
+	    throw std::runtime_error("Transformation query returned no result");
+	}
+	return value.asString();
+    }
+
+    // replace the content of doc by the result of the transformations, throws on failure
+    // filename: the file the document was read from, for XInclude, 0 = the name of the document
+    static void c_dbxml_transform(c_dbxml db, DbXml::XmlDocument &doc, char const *filename = 0)
+    {
+	if (!c_dbxml_transforms(db)) {
+	    return;
+	}
+	std::string content;
+	doc.getContent(content);
+	if (!db->xinclude.isNull()) {
+	    content = c_dbxml_transform_query(db, db->xinclude, content, c_dbxml_file_uri(filename ? filename : doc.getName()));
+	}
+	if (!db->strip.isNull()) {
+	    content = c_dbxml_transform_query(db, db->strip, content, "");
+	}
+	if (!db->transformQuery.isNull()) {
+	    content = c_dbxml_transform_query(db, db->transformQuery, content, "");
+	}
+	if (db->transform) {
+	    char *result;
+	    unsigned long long size;
+	    int status = goTransform(db->transform, (char *) doc.getName().c_str(), (char *) content.data(), content.size(), &result, &size);
+	    content.assign(result, size);
+	    free(result);
+	    if (!status) {
+		throw std::runtime_error(content);
+	    }
+	}
+	doc.setContent(content);
+    }
+
+    c_dbxml_result c_dbxml_put_file(c_dbxml db, char const * filename, int replace)
+    {
+	return c_dbxml_put_file_named(db, filename, "", replace);
+    }
+
+    c_dbxml_result c_dbxml_put_file_named(c_dbxml db, char const *filename, char const *name, int replace)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+
+	if (!name[0]) {
+	    name = filename;
+	}
+	std::string created;
+	if (replace) {
+	    created = c_dbxml_created(db, 0, name);
+	    try {
+		db->container.deleteDocument(name, db->context);
+	    } catch (...) {
+		;
+	    }
+	}
+        try {
+            DbXml::XmlInputStream *is = db->manager.createLocalFileInputStream(filename);
+	    // the well-formed only parser would skip validation
+	    u_int32_t flags = db->config.getAllowValidation() ? 0 : DbXml::DBXML_WELL_FORMED_ONLY;
+	    if (db->timestamps || c_dbxml_transforms(db)) {
+		DbXml::XmlDocument doc = c_dbxml_new_doc(db, name, created);
+		doc.setContentAsXmlInputStream(is);
+		c_dbxml_transform(db, doc, filename);
+		db->container.putDocument(doc, db->context, flags);
+	    } else {
+		db->container.putDocument(name, is, db->context, flags);
+	    }
+	    r->result = name;
+	    r->error = false;
+        } catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+        }
+
+	return r;
+    }
+
+    static void c_dbxml_put_files_error(std::ostringstream &out, int i, c_dbxml_errstate const &info, std::string const &msg)
+    {
+	out << i << '\0' << info.code << '\0' << info.line << '\0' << info.column << '\0' << info.dberrno << '\0' << msg << '\0';
+    }
+
+    static void c_dbxml_txn_put_file(c_dbxml db, DbXml::XmlTransaction &txn, char const *filename, int replace)
+    {
+	std::string created;
+	if (replace) {
+	    created = c_dbxml_created(db, &txn, filename);
+	    try {
+		db->container.deleteDocument(txn, filename, db->context);
+	    } catch (DbXml::XmlException &xe) {
+		if (xe.getExceptionCode() != DbXml::XmlException::DOCUMENT_NOT_FOUND) {
+		    throw;
+		}
+	    }
+	}
+	DbXml::XmlInputStream *is = db->manager.createLocalFileInputStream(filename);
+	u_int32_t flags = db->config.getAllowValidation() ? 0 : DbXml::DBXML_WELL_FORMED_ONLY;
+	if (db->timestamps || c_dbxml_transforms(db)) {
+	    DbXml::XmlDocument doc = c_dbxml_new_doc(db, filename, created);
+	    doc.setContentAsXmlInputStream(is);
+	    c_dbxml_transform(db, doc);
+	    db->container.putDocument(txn, doc, db->context, flags);
+	} else {
+	    db->container.putDocument(txn, filename, is, db->context, flags);
+	}
+    }
+
+    c_dbxml_result c_dbxml_put_files(c_dbxml db, char const **filenames, int replace)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	std::ostringstream out;
+
+	if (!db->config.getTransactional()) {
+	    for (int i = 0; filenames[i]; i++) {
+		c_dbxml_result r1 = c_dbxml_put_file(db, filenames[i], replace);
+		if (r1->error) {
+		    c_dbxml_put_files_error(out, i, r1->info, r1->result);
+		}
+		delete r1;
+	    }
+	    r->result = out.str();
+	    r->error = false;
+	    return r;
+	}
+
+	DbXml::XmlTransaction txn;
+	try {
+	    txn = db->manager.createTransaction();
+	    for (int i = 0; filenames[i]; i++) {
+		try {
+		    c_dbxml_txn_put_file(db, txn, filenames[i], replace);
+		} catch (DbXml::XmlException &xe) {
+		    // a database error, such as a deadlock, must abort the transaction
+		    if (xe.getExceptionCode() == DbXml::XmlException::DATABASE_ERROR) {
+			throw;
+		    }
+		    c_dbxml_errstate info;
+		    c_dbxml_set_errinfo(info, xe);
+		    c_dbxml_put_files_error(out, i, info, xe.what());
+		}
+	    }
+	    txn.commit();
+	    r->result = out.str();
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_abort(txn);
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    // replace if replace != 0
+    c_dbxml_result c_dbxml_put_xml(c_dbxml db, char const *name, char const *data, int replace)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+
+	std::string created;
+	if (replace) {
+	    created = c_dbxml_created(db, 0, name);
+	    try {
+		db->container.deleteDocument(name, db->context);
+	    } catch (...) {
+		;
+	    }
+	}
+
+        try {
+	    if (db->timestamps || c_dbxml_transforms(db)) {
+		DbXml::XmlDocument doc = c_dbxml_new_doc(db, name, created);
+		doc.setContent(data);
+		c_dbxml_transform(db, doc);
+		db->container.putDocument(doc, db->context);
+	    } else {
+		db->container.putDocument(name, data, db->context);
+	    }
+	    r->error = false;
+        } catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+        }
+	return r;
+    }
+
+    // replace if replace != 0
+    c_dbxml_result c_dbxml_put_xml_bytes(c_dbxml db, char const *name, char const *data, unsigned long long size, int replace)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+
+	std::string created;
+	if (replace) {
+	    created = c_dbxml_created(db, 0, name);
+	    try {
+		db->container.deleteDocument(name, db->context);
+	    } catch (...) {
+		;
+	    }
+	}
+
+        try {
+	    // the buffer is not copied, the stream is consumed before this function returns
+            DbXml::XmlInputStream *is = db->manager.createMemBufInputStream(data, (unsigned int) size, name, false);
+	    if (db->timestamps || c_dbxml_transforms(db)) {
+		DbXml::XmlDocument doc = c_dbxml_new_doc(db, name, created);
+		doc.setContentAsXmlInputStream(is);
+		c_dbxml_transform(db, doc);
+		db->container.putDocument(doc, db->context);
+	    } else {
+		db->container.putDocument(name, is, db->context);
+	    }
+	    r->error = false;
+        } catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+        }
+	return r;
+    }
+
+    // replace if replace != 0
+    // remove all metadata, except the internal metadata, such as the document name
+    static void c_dbxml_clear_metadata(DbXml::XmlDocument &doc)
+    {
+	std::vector<std::pair<std::string, std::string> > old;
+	DbXml::XmlMetaDataIterator it = doc.getMetaDataIterator();
+	std::string uri, mdname;
+	DbXml::XmlValue value;
+	while (it.next(uri, mdname, value)) {
+	    if (uri != DBXML_URI) {
+		old.push_back(std::make_pair(uri, mdname));
+	    }
+	}
+	for (size_t i = 0; i < old.size(); i++) {
+	    doc.removeMetaData(old[i].first, old[i].second);
+	}
+    }
+
+    c_dbxml_result c_dbxml_put_reader(c_dbxml db, char const *name, unsigned long long handle, int replace)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+
+        try {
+	    DbXml::XmlDocument doc;
+	    bool exists = false;
 	    if (replace) {
 		try {
-		    db->container.deleteDocument(doc.getName(), db->context);
+		    doc = db->container.getDocument(name, DbXml::DBXML_LAZY_DOCS);
+		    exists = true;
 		} catch (DbXml::XmlException &xe) {
-		    ;
+		    if (xe.getExceptionCode() != DbXml::XmlException::DOCUMENT_NOT_FOUND) {
+			throw;
+		    }
+		}
+	    }
+	    // the stream is adopted by the document or by putDocument
+	    if (exists) {
+		// replaced in a single write operation, so the old document stays if reading the new one fails
+		std::string created = c_dbxml_created(db, 0, name);
+		c_dbxml_clear_metadata(doc);
+		doc.setContentAsXmlInputStream(new GoInputStream(handle));
+		c_dbxml_stamp(db, doc, created);
+		c_dbxml_transform(db, doc);
+		db->container.updateDocument(doc, db->context);
+	    } else if (db->timestamps || c_dbxml_transforms(db)) {
+		doc = c_dbxml_new_doc(db, name, "");
+		doc.setContentAsXmlInputStream(new GoInputStream(handle));
+		c_dbxml_transform(db, doc);
+		db->container.putDocument(doc, db->context);
+	    } else {
+		db->container.putDocument(name, new GoInputStream(handle), db->context);
+	    }
+	    r->error = false;
+        } catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+        }
+	return r;
+    }
+
+    // metadata: uri, name and value for each item, terminated by a null pointer
+    // replace if replace != 0
+    c_dbxml_result c_dbxml_put_xml_metadata(c_dbxml db, char const *name, char const *data, char const **metadata, int replace)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+
+	try {
+	    DbXml::XmlDocument doc;
+	    bool exists = false;
+	    if (replace) {
+		try {
+		    doc = db->container.getDocument(name);
+		    exists = true;
+		} catch (DbXml::XmlException &xe) {
+		    if (xe.getExceptionCode() != DbXml::XmlException::DOCUMENT_NOT_FOUND) {
+			throw;
+		    }
 		}
 	    }
+	    std::string created;
+	    if (exists) {
+		created = c_dbxml_created(db, 0, name);
+		c_dbxml_clear_metadata(doc);
+	    } else {
+		doc = db->manager.createDocument();
+		doc.setName(name);
+	    }
+	    doc.setContent(data);
+	    // timestamps in the metadata, for instance from db.Dump(), take precedence
+	    c_dbxml_stamp(db, doc, created);
+	    for (int i = 0; metadata[i]; i += 3) {
+		doc.setMetaData(metadata[i], metadata[i+1], DbXml::XmlValue(metadata[i+2]));
+	    }
+	    c_dbxml_transform(db, doc);
+	    // a single write operation, so the document never exists without its metadata
+	    if (exists) {
+		db->container.updateDocument(doc, db->context);
+	    } else {
+		db->container.putDocument(doc, db->context);
+	    }
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_put_xml_gen_name(c_dbxml db, char const *prefix, char const *data)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+
+        try {
+	    if (db->timestamps || c_dbxml_transforms(db)) {
+		DbXml::XmlDocument doc = c_dbxml_new_doc(db, prefix, "");
+		doc.setContent(data);
+		c_dbxml_transform(db, doc);
+		db->container.putDocument(doc, db->context, DbXml::DBXML_GEN_NAME);
+		r->result = doc.getName();
+	    } else {
+		r->result = db->container.putDocument(prefix, data, db->context, DbXml::DBXML_GEN_NAME);
+	    }
+	    r->error = false;
+        } catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+        }
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_update_xml(c_dbxml db, char const *name, char const *data)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+
+	try {
+	    DbXml::XmlDocument doc = db->container.getDocument(name);
+	    doc.setContent(data);
+	    c_dbxml_transform(db, doc);
+	    c_dbxml_stamp(db, doc, c_dbxml_created(db, 0, name));
+	    db->container.updateDocument(doc, db->context);
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    // replace if replace != 0
+    c_dbxml_result c_dbxml_merge(c_dbxml db, char const * dbxmlfile, int replace) {
+	return c_dbxml_merge_progress(db, dbxmlfile, replace, 0);
+    }
+
+    // if handle != 0, progress is reported to Go after each document, and Go can abort the merge
+    static void c_dbxml_merge_container(c_dbxml db, DbXml::XmlContainer &input, int replace, unsigned long long handle, c_dbxml_result r)
+    {
+	DbXml::XmlDocument doc;
+	DbXml::XmlResults it = input.getAllDocuments(DbXml::DBXML_LAZY_DOCS);
+	unsigned long long count = 0;
+	while (it.next(doc)) {
+	    // created is kept from the document that is replaced, or else from the source
+	    std::string created = c_dbxml_created(db, 0, doc.getName().c_str());
+	    if (replace) {
+		try {
+		    db->container.deleteDocument(doc.getName(), db->context);
+		} catch (...) {
+		    ;
+		}
+	    }
+	    DbXml::XmlValue value;
+	    if (created.empty() && db->timestamps && doc.getMetaData(DCTERMS_URI, "created", value)) {
+		created = value.asString();
+	    }
+	    c_dbxml_transform(db, doc);
+	    c_dbxml_stamp(db, doc, created);
+	    db->container.putDocument(doc, db->context);
+	    count++;
+	    if (handle && goMergeProgress(handle, count)) {
+		r->result = "Merge aborted";
+		r->info.code = 8;
+		r->error = true;
+		break;
+	    }
+	}
+    }
+
+    // replace if replace != 0
+    c_dbxml_result c_dbxml_merge_progress(c_dbxml db, char const * dbxmlfile, int replace, unsigned long long handle) {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	r->error = false;
+
+	try {
+	    DbXml::XmlContainer input = db->manager.openContainer(dbxmlfile);
+	    c_dbxml_merge_container(db, input, replace, handle, r);
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    // replace if replace != 0
+    c_dbxml_result c_dbxml_merge_from(c_dbxml db, c_dbxml src, int replace) {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	r->error = false;
+
+	try {
+	    c_dbxml_merge_container(db, src->container, replace, 0, r);
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_remove(c_dbxml db, char const * filename)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+
+	try {
+	    db->container.deleteDocument(filename, db->context);
+	    r->error = false;
+        } catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    // names is terminated by NULL
+    // result: for each document that was removed, its index in names, followed by a null byte
+    c_dbxml_result c_dbxml_remove_many(c_dbxml db, char const **names)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	DbXml::XmlTransaction txn;
+	std::string removed;
+	try {
+	    if (db->config.getTransactional()) {
+		txn = db->manager.createTransaction();
+	    }
+	    for (int i = 0; names[i]; i++) {
+		try {
+		    if (txn.isNull()) {
+			db->container.deleteDocument(names[i], db->context);
+		    } else {
+			db->container.deleteDocument(txn, names[i], db->context);
+		    }
+		} catch (DbXml::XmlException &xe) {
+		    if (xe.getExceptionCode() == DbXml::XmlException::DOCUMENT_NOT_FOUND) {
+			continue;
+		    }
+		    throw;
+		}
+		std::ostringstream index;
+		index << i;
+		removed.append(index.str());
+		removed.push_back('\0');
+	    }
+	    if (!txn.isNull()) {
+		txn.commit();
+	    }
+	    r->result = removed;
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_abort(txn);
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    static std::string c_dbxml_version_key(char const *prefix, long n)
+    {
+	std::ostringstream key;
+	key << prefix << n;
+	return key.str();
+    }
+
+    // the current revision of a document, 0 if the document is not versioned
+    static long c_dbxml_version_current(DbXml::XmlDocument &doc)
+    {
+	DbXml::XmlValue value;
+	if (!doc.getMetaData(VERSION_URI, "revision", value)) {
+	    return 0;
+	}
+	return std::atol(value.asString().c_str());
+    }
+
+    c_dbxml_result c_dbxml_put_version(c_dbxml db, char const *name, char const *data, char const *when)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+
+	try {
+	    DbXml::XmlDocument doc;
+	    bool exists = true;
+	    try {
+		doc = db->container.getDocument(name);
+	    } catch (DbXml::XmlException &xe) {
+		if (xe.getExceptionCode() != DbXml::XmlException::DOCUMENT_NOT_FOUND) {
+		    throw;
+		}
+		exists = false;
+	    }
+	    long rev = 0;
+	    if (exists) {
+		rev = c_dbxml_version_current(doc);
+		if (rev == 0) {
+		    // an existing document that was stored without versioning becomes revision 1
+		    rev = 1;
+		    doc.setMetaData(VERSION_URI, c_dbxml_version_key("t", rev), DbXml::XmlValue(""));
+		}
+		std::string content;
+		doc.getContent(content);
+		doc.setMetaData(VERSION_URI, c_dbxml_version_key("r", rev), DbXml::XmlValue(content));
+	    } else {
+		doc = db->manager.createDocument();
+		doc.setName(name);
+	    }
+	    rev++;
+	    doc.setContent(data);
+	    c_dbxml_transform(db, doc);
+	    c_dbxml_stamp(db, doc, exists ? c_dbxml_created(db, 0, name) : "");
+	    doc.setMetaData(VERSION_URI, "revision", DbXml::XmlValue(c_dbxml_version_key("", rev)));
+	    doc.setMetaData(VERSION_URI, c_dbxml_version_key("t", rev), DbXml::XmlValue(when));
+	    if (exists) {
+		db->container.updateDocument(doc, db->context);
+	    } else {
+		db->container.putDocument(doc, db->context);
+	    }
+	    r->result = c_dbxml_version_key("", rev);
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_get_version(c_dbxml db, char const *name, long n)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    DbXml::XmlDocument doc = db->container.getDocument(name);
+	    long rev = c_dbxml_version_current(doc);
+	    if (rev == 0) {
+		rev = 1;
+	    }
+	    DbXml::XmlValue value;
+	    if (n == rev) {
+		doc.getContent(r->result);
+		r->error = false;
+	    } else if (n > 0 && n < rev && doc.getMetaData(VERSION_URI, c_dbxml_version_key("r", n), value)) {
+		r->result = value.asString();
+		r->error = false;
+	    } else {
+		r->result = "Revision not found";
+		r->info.code = 1;
+		r->error = true;
+	    }
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_history(c_dbxml db, char const *name)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    DbXml::XmlDocument doc = db->container.getDocument(name, DbXml::DBXML_LAZY_DOCS);
+	    long rev = c_dbxml_version_current(doc);
+	    if (rev == 0) {
+		rev = 1;
+	    }
+	    // for each revision: number and time, separated by '\0'
+	    for (long i = 1; i <= rev; i++) {
+		DbXml::XmlValue value;
+		if (i < rev && !doc.getMetaData(VERSION_URI, c_dbxml_version_key("r", i), value)) {
+		    continue;
+		}
+		r->result.append(c_dbxml_version_key("", i));
+		r->result.push_back('\0');
+		if (doc.getMetaData(VERSION_URI, c_dbxml_version_key("t", i), value)) {
+		    r->result.append(value.asString());
+		}
+		r->result.push_back('\0');
+	    }
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_remove_query(c_dbxml db, char const *query, char const **namespaces, unsigned long long *count)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	DbXml::XmlTransaction txn;
+	int i;
+	*count = 0;
+	try {
+	    DbXml::XmlQueryContext context;
+	    DbXml::XmlValue value;
+	    std::set<std::string> names;
+	    context = db->manager.createQueryContext(DbXml::XmlQueryContext::LiveValues, DbXml::XmlQueryContext::Lazy);
+	    context.setDefaultCollection(db->alias);
+	    for (i = 0; namespaces[i]; i += 2) {
+		context.setNamespace(namespaces[i], namespaces[i+1]);
+	    }
+	    // query and delete in one transaction, all documents are removed or none
+	    if (db->config.getTransactional()) {
+		txn = db->manager.createTransaction();
+	    }
+	    // collect names first, don't delete documents while iterating over the results
+	    std::string q("collection('" + db->alias + "')" + query);
+	    DbXml::XmlResults it = txn.isNull() ?
+		db->manager.query(q, context, DbXml::DBXML_LAZY_DOCS) :
+		db->manager.query(txn, q, context, DbXml::DBXML_LAZY_DOCS);
+	    while (it.next(value)) {
+		if (value.isNode()) {
+		    names.insert(value.asDocument().getName());
+		}
+	    }
+	    it = DbXml::XmlResults();
+	    for (std::set<std::string>::iterator n = names.begin(); n != names.end(); n++) {
+		if (txn.isNull()) {
+		    db->container.deleteDocument(*n, db->context);
+		} else {
+		    db->container.deleteDocument(txn, *n, db->context);
+		}
+		(*count)++;
+	    }
+	    if (!txn.isNull()) {
+		txn.commit();
+	    }
+	    r->error = false;
+	    context.clearNamespaces(); // is this necessary?
+	} catch (...) {
+	    c_dbxml_abort(txn);
+	    c_dbxml_catch(r->result, r->error, r->info);
+	    if (!txn.isNull()) {
+		*count = 0;
+	    }
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_rename(c_dbxml db, char const *oldname, char const *newname)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	DbXml::XmlTransaction txn;
+
+	try {
+	    // put and delete in one transaction, so the document doesn't end up under both names, or neither
+	    if (db->config.getTransactional()) {
+		txn = db->manager.createTransaction();
+	    }
+	    // lazy, the content is only read when the document is stored under its new name
+	    DbXml::XmlDocument doc = txn.isNull() ?
+		db->container.getDocument(oldname, DbXml::DBXML_LAZY_DOCS) :
+		db->container.getDocument(txn, oldname, DbXml::DBXML_LAZY_DOCS);
+	    doc.setName(newname);
+	    // fails if newname exists
+	    if (txn.isNull()) {
+		db->container.putDocument(doc, db->context);
+		db->container.deleteDocument(oldname, db->context);
+	    } else {
+		db->container.putDocument(txn, doc, db->context);
+		db->container.deleteDocument(txn, oldname, db->context);
+		txn.commit();
+	    }
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_abort(txn);
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    // a hash of the content of each document, to find the documents that were changed by an update
+    static void c_dbxml_content_hashes(c_dbxml db, DbXml::XmlTransaction &txn, std::map<std::string, unsigned long long> &hashes)
+    {
+	DbXml::XmlQueryContext context = db->manager.createQueryContext(DbXml::XmlQueryContext::LiveValues, DbXml::XmlQueryContext::Lazy);
+	std::string query("collection('" + db->alias + "')");
+	DbXml::XmlResults it = txn.isNull() ?
+	    db->manager.query(query, context, DbXml::DBXML_LAZY_DOCS) :
+	    db->manager.query(txn, query, context, DbXml::DBXML_LAZY_DOCS);
+	DbXml::XmlDocument doc;
+	std::string content;
+	while (it.next(doc)) {
+	    doc.getContent(content);
+	    // FNV-1a
+	    unsigned long long h = 14695981039346656037ULL;
+	    for (std::string::size_type i = 0; i < content.size(); i++) {
+		h ^= (unsigned char) content[i];
+		h *= 1099511628211ULL;
+	    }
+	    hashes[doc.getName()] = h;
+	}
+    }
+
+    c_dbxml_result c_dbxml_update(c_dbxml db, char const *query, char const **namespaces, unsigned long long *n)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	DbXml::XmlTransaction txn;
+	*n = 0;
+	try {
+	    DbXml::XmlQueryContext context = db->manager.createQueryContext(DbXml::XmlQueryContext::LiveValues, DbXml::XmlQueryContext::Eager);
+	    context.setDefaultCollection(db->alias);
+	    for (int i = 0; namespaces[i]; i += 2) {
+		context.setNamespace(namespaces[i], namespaces[i+1]);
+	    }
+	    // compare and update in one transaction
+	    if (db->config.getTransactional()) {
+		txn = db->manager.createTransaction();
+	    }
+	    DbXml::XmlQueryExpression expr = txn.isNull() ? db->manager.prepare(query, context) : db->manager.prepare(txn, query, context);
+	    if (!expr.isUpdateExpression()) {
+		c_dbxml_abort(txn);
+		r->result = "Not an Update Expression";
+		r->error = true;
+		return r;
+	    }
+	    std::map<std::string, unsigned long long> before, after;
+	    c_dbxml_content_hashes(db, txn, before);
+	    if (txn.isNull()) {
+		expr.execute(context);
+	    } else {
+		expr.execute(txn, context);
+	    }
+	    c_dbxml_content_hashes(db, txn, after);
+	    if (!txn.isNull()) {
+		txn.commit();
+	    }
+	    for (std::map<std::string, unsigned long long>::iterator it = after.begin(); it != after.end(); ++it) {
+		std::map<std::string, unsigned long long>::iterator b = before.find(it->first);
+		if (b == before.end() || b->second != it->second) {
+		    (*n)++;
+		}
+	    }
+	    for (std::map<std::string, unsigned long long>::iterator it = before.begin(); it != before.end(); ++it) {
+		if (after.find(it->first) == after.end()) {
+		    (*n)++;
+		}
+	    }
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_abort(txn);
+	    c_dbxml_catch(r->result, r->error, r->info);
+	    *n = 0;
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_modify(c_dbxml db, char const *query, char const *count, char const **namespaces, unsigned long long *n)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	DbXml::XmlTransaction txn;
+	*n = 0;
+	try {
+	    DbXml::XmlQueryContext context = db->manager.createQueryContext(DbXml::XmlQueryContext::LiveValues, DbXml::XmlQueryContext::Eager);
+	    context.setDefaultCollection(db->alias);
+	    for (int i = 0; namespaces[i]; i += 2) {
+		context.setNamespace(namespaces[i], namespaces[i+1]);
+	    }
+	    // count and modify in one transaction
+	    if (db->config.getTransactional()) {
+		txn = db->manager.createTransaction();
+	    }
+	    DbXml::XmlQueryExpression counter = txn.isNull() ? db->manager.prepare(count, context) : db->manager.prepare(txn, count, context);
+	    DbXml::XmlResults results = txn.isNull() ? counter.execute(context) : counter.execute(txn, context);
+	    DbXml::XmlValue value;
+	    if (results.next(value)) {
+		*n = (unsigned long long) value.asNumber();
+	    }
+	    DbXml::XmlQueryExpression expr = txn.isNull() ? db->manager.prepare(query, context) : db->manager.prepare(txn, query, context);
+	    if (txn.isNull()) {
+		expr.execute(context);
+	    } else {
+		expr.execute(txn, context);
+		txn.commit();
+	    }
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_abort(txn);
+	    c_dbxml_catch(r->result, r->error, r->info);
+	    *n = 0;
+	}
+	return r;
+    }
+
+    // Close the container, run a maintenance operation on it, and open it again with the same configuration.
+    // kind: 0 = compact, 1 = truncate
+    static c_dbxml_result c_dbxml_maintain(c_dbxml db, int kind)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	r->error = false;
+	try {
+	    // this fails if the container is still referenced by open results
+	    db->container = DbXml::XmlContainer();
+	    if (kind == 0) {
+		db->manager.compactContainer(db->filename, db->context);
+	    } else {
+		db->manager.truncateContainer(db->filename, db->context);
+	    }
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	try {
+	    DbXml::XmlContainerConfig config = db->config;
+	    config.setAllowCreate(false);
+	    config.setExclusiveCreate(false);
+	    db->container = db->manager.openContainer(db->filename, config);
+	    db->container.addAlias(db->alias);
+	    for (std::vector<std::string>::size_type i = 0; i < db->aliases.size(); i++) {
+		db->container.addAlias(db->aliases[i]);
+	    }
+	} catch (...) {
+	    if (!r->error) {
+		c_dbxml_catch(r->result, r->error, r->info);
+	    }
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_compact(c_dbxml db)
+    {
+	return c_dbxml_maintain(db, 0);
+    }
+
+    c_dbxml_result c_dbxml_truncate(c_dbxml db)
+    {
+	return c_dbxml_maintain(db, 1);
+    }
+
+    c_dbxml_result c_dbxml_sync(c_dbxml db)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    db->container.sync();
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	if (!r->error && db->seqdb) {
+	    int ret = db->seqdb->sync(db->seqdb, 0);
+	    if (ret) {
+		r->result = db_strerror(ret);
+		c_dbxml_set_dberrno(r->info, ret);
+		r->error = true;
+	    }
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_set_durability(c_dbxml db, int nosync)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	r->error = false;
+	if (!db->config.getTransactional()) {
+	    // without a log, writes are always flushed by c_dbxml_sync or c_dbxml_close
+	    return r;
+	}
+	DB_ENV *dbenv = db->manager.getDB_ENV();
+	int ret = dbenv->set_flags(dbenv, DB_TXN_NOSYNC, nosync ? 1 : 0);
+	if (!ret && !nosync) {
+	    // commits that were not flushed become durable now
+	    ret = dbenv->log_flush(dbenv, 0);
+	}
+	if (ret) {
+	    r->result = db_strerror(ret);
+	    c_dbxml_set_dberrno(r->info, ret);
+	    r->error = true;
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_env_sync(c_dbxml_env env)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	r->error = false;
+	DB_ENV *dbenv = env->manager->getDB_ENV();
+	int ret = dbenv->memp_sync(dbenv, 0);
+	if (!ret && env->logging) {
+	    ret = dbenv->txn_checkpoint(dbenv, 0, 0, 0);
+	}
+	if (!ret && env->logging) {
+	    ret = dbenv->log_flush(dbenv, 0);
+	}
+	if (ret) {
+	    r->result = db_strerror(ret);
+	    c_dbxml_set_dberrno(r->info, ret);
+	    r->error = true;
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_backup(c_dbxml db, char const *target)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	r->error = false;
+	try {
+	    db->container.sync();
+	    DB_ENV *dbenv = db->manager.getDB_ENV();
+	    int ret = dbenv->dbbackup(dbenv, db->filename.c_str(), target, 0);
+	    if (ret) {
+		r->result = db_strerror(ret);
+		c_dbxml_set_dberrno(r->info, ret);
+		r->error = true;
+	    }
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_add_index(c_dbxml db, char const *uri, char const *name, char const *index)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    db->container.addIndex(uri, name, index, db->context);
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_suspend_indexes(c_dbxml db)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    if (!db->suspended) {
+		db->indexes = db->container.getIndexSpecification();
+		db->container.setIndexSpecification(DbXml::XmlIndexSpecification(), db->context);
+		db->suspended = true;
+	    }
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_resume_indexes(c_dbxml db)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    if (db->suspended) {
+		// re-indexes all documents
+		db->container.setIndexSpecification(db->indexes, db->context);
+		db->suspended = false;
+	    }
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_has_index(c_dbxml db, char const *uri, char const *name, char const *index, int *has)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	*has = 0;
+	try {
+	    std::string indexes;
+	    DbXml::XmlIndexSpecification spec = db->container.getIndexSpecification();
+	    if (spec.find(uri, name, indexes)) {
+		// indexes is a list of indexes, separated by spaces
+		std::string::size_type i = 0;
+		std::string idx(index);
+		while (i < indexes.size()) {
+		    std::string::size_type j = indexes.find(' ', i);
+		    if (j == std::string::npos) {
+			j = indexes.size();
+		    }
+		    if (indexes.compare(i, j - i, idx) == 0) {
+			*has = 1;
+			break;
+		    }
+		    i = j + 1;
+		}
+	    }
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_indexes(c_dbxml db)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    std::string uri, name, index;
+	    DbXml::XmlIndexSpecification spec = db->container.getIndexSpecification();
+	    while (spec.next(uri, name, index)) {
+		r->result.append(uri);
+		r->result.push_back('\0');
+		r->result.append(name);
+		r->result.push_back('\0');
+		r->result.append(index);
+		r->result.push_back('\0');
+	    }
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    int c_dbxml_read_only(c_dbxml db)
+    {
+	return db->config.getReadOnly() ? 1 : 0;
+    }
+
+    c_dbxml_result c_dbxml_stats(c_dbxml db, unsigned long long *values)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	for (int i = 0; i < 14; i++) {
+	    values[i] = 0;
+	}
+	DB_ENV *dbenv = db->manager.getDB_ENV();
+	DB_MPOOL_STAT *mstat;
+	int ret = dbenv->memp_stat(dbenv, &mstat, 0, 0);
+	if (ret) {
+	    r->result = db_strerror(ret);
+	    c_dbxml_set_dberrno(r->info, ret);
+	    r->error = true;
+	    return r;
+	}
+	values[0] = (unsigned long long) mstat->st_gbytes * 1073741824ULL + (unsigned long long) mstat->st_bytes;
+	values[1] = (unsigned long long) mstat->st_cache_hit;
+	values[2] = (unsigned long long) mstat->st_cache_miss;
+	values[3] = (unsigned long long) mstat->st_page_in;
+	values[4] = (unsigned long long) mstat->st_page_out;
+	free(mstat);
+
+	// locking and transactions are only available in some environments
+	DB_LOCK_STAT *lstat;
+	if (!dbenv->lock_stat(dbenv, &lstat, 0)) {
+	    values[5] = (unsigned long long) lstat->st_nrequests;
+	    values[6] = (unsigned long long) lstat->st_lock_wait;
+	    values[7] = (unsigned long long) lstat->st_ndeadlocks;
+	    values[8] = (unsigned long long) lstat->st_nlocktimeouts;
+	    values[9] = (unsigned long long) lstat->st_nlocks;
+	    free(lstat);
+	}
+	DB_TXN_STAT *tstat;
+	if (!dbenv->txn_stat(dbenv, &tstat, 0)) {
+	    values[10] = (unsigned long long) tstat->st_nbegins;
+	    values[11] = (unsigned long long) tstat->st_ncommits;
+	    values[12] = (unsigned long long) tstat->st_naborts;
+	    values[13] = (unsigned long long) tstat->st_nactive;
+	    free(tstat);
+	}
+	r->error = false;
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_ping(c_dbxml db)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    // a small read from the container file
+	    db->container.getIndexSpecification();
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_info(c_dbxml db, int *storage, int *indexnodes, unsigned int *pagesize, int *transactional, int *validation)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    *storage = db->container.getContainerType() == DbXml::XmlContainer::NodeContainer ? 1 : 2;
+	    *indexnodes = db->container.getIndexNodes() ? 1 : 0;
+	    *pagesize = db->container.getPageSize();
+	    *transactional = db->config.getTransactional() ? 1 : 0;
+	    *validation = db->config.getAllowValidation() ? 1 : 0;
+	    r->result = db->container.getName();
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_get(c_dbxml db, char const * name)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    DbXml::XmlDocument doc = db->container.getDocument(name);
+	    doc.getContent(r->result);
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    // names is terminated by NULL
+    // result: for each document that exists, its index in names and its content, each followed by a null byte
+    c_dbxml_result c_dbxml_get_many(c_dbxml db, char const **names)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	DbXml::XmlTransaction txn;
+	try {
+	    if (db->config.getTransactional()) {
+		txn = db->manager.createTransaction(db->snapshot ? DB_TXN_SNAPSHOT : 0);
+	    }
+	    std::string content;
+	    for (int i = 0; names[i]; i++) {
+		DbXml::XmlDocument doc;
+		try {
+		    doc = txn.isNull() ? db->container.getDocument(names[i]) : db->container.getDocument(txn, names[i]);
+		} catch (DbXml::XmlException &xe) {
+		    if (xe.getExceptionCode() == DbXml::XmlException::DOCUMENT_NOT_FOUND) {
+			continue;
+		    }
+		    throw;
+		}
+		doc.getContent(content);
+		std::ostringstream index;
+		index << i;
+		r->result.append(index.str());
+		r->result.push_back('\0');
+		r->result.append(content);
+		r->result.push_back('\0');
+	    }
+	    if (!txn.isNull()) {
+		txn.commit();
+	    }
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_abort(txn);
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_exists(c_dbxml db, char const *name, int *exists)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	*exists = 0;
+	try {
+	    db->container.getDocument(name, DbXml::DBXML_LAZY_DOCS);
+	    *exists = 1;
+	    r->error = false;
+	} catch (DbXml::XmlException &xe) {
+	    if (xe.getExceptionCode() == DbXml::XmlException::DOCUMENT_NOT_FOUND) {
+		r->error = false;
+	    } else {
+		c_dbxml_catch(r->result, r->error, r->info);
+	    }
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_size(c_dbxml db, unsigned long long *size)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	*size = 0;
+	try {
+	    *size = (unsigned long long) db->container.getNumDocuments();
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_docs c_dbxml_get_all(c_dbxml db)
+    {
+	c_dbxml_docs docs;
+	docs = new c_dbxml_docs_t;
+	docs->manager = &db->manager;
+	try {
+	    docs->it = db->container.getAllDocuments(DbXml::DBXML_LAZY_DOCS);
+	    docs->more = true;
+	    docs->error = false;
+	} catch (...) {
+	    docs->more = false;
+	    c_dbxml_catch(docs->errstring, docs->error, docs->info);
+	}
+	return docs;
+    }
+
+    c_dbxml_docs c_dbxml_get_all_names(c_dbxml db)
+    {
+	c_dbxml_docs docs;
+	docs = c_dbxml_get_all(db);
+	docs->namesOnly = true;
+	return docs;
+    }
+
+    // documents with names that start with prefix, in order of name, by a range lookup on the index of dbxml:name
+    static c_dbxml_docs c_dbxml_get_prefix(c_dbxml db, std::string const &prefix)
+    {
+	if (!prefix.size()) {
+	    return c_dbxml_get_all(db);
+	}
+	c_dbxml_docs docs;
+	docs = new c_dbxml_docs_t;
+	docs->manager = &db->manager;
+	try {
+	    docs->context = db->manager.createQueryContext(DbXml::XmlQueryContext::LiveValues, DbXml::XmlQueryContext::Lazy);
+	    DbXml::XmlIndexLookup lookup = db->manager.createIndexLookup(db->container,
+									 "http://www.sleepycat.com/2002/dbxml", "name",
+									 "unique-node-metadata-equality-string",
+									 DbXml::XmlValue(prefix), DbXml::XmlIndexLookup::GTE);
+	    // the upper bound is the prefix with its last byte incremented, dropping trailing bytes that can't be incremented
+	    std::string high = prefix;
+	    while (high.size() && (unsigned char) high[high.size() - 1] == 0xff) {
+		high.erase(high.size() - 1);
+	    }
+	    if (high.size()) {
+		high[high.size() - 1]++;
+		lookup.setHighBound(DbXml::XmlValue(high), DbXml::XmlIndexLookup::LT);
+	    }
+	    docs->it = lookup.execute(docs->context, DbXml::DBXML_LAZY_DOCS);
+	    docs->more = true;
+	    docs->error = false;
+	} catch (...) {
+	    docs->more = false;
+	    c_dbxml_catch(docs->errstring, docs->error, docs->info);
+	}
+	return docs;
+    }
+
+    c_dbxml_docs c_dbxml_get_names(c_dbxml db, char const *prefix)
+    {
+	c_dbxml_docs docs;
+	docs = c_dbxml_get_prefix(db, prefix);
+	docs->namesOnly = true;
+	return docs;
+    }
+
+    c_dbxml_docs c_dbxml_get_matching(c_dbxml db, char const *pattern)
+    {
+	c_dbxml_docs docs;
+	std::string p(pattern);
+	// only the names that start with the literal prefix of the pattern are read
+	docs = c_dbxml_get_prefix(db, p.substr(0, p.find_first_of("*?[\\")));
+	docs->pattern = p;
+	return docs;
+    }
+
+    // variables, as name and value pairs, may be NULL
+    static c_dbxml_query c_dbxml_prepare(DbXml::XmlManager &manager, std::string const &query, char const *defaultCollection, char const **namespaces, char const **variables, unsigned int timeout, std::string const &baseURI, bool snapshot)
+    {
+	int i;
+	c_dbxml_query q;
+	q = new c_dbxml_query_t;
+	q->manager = &manager;
+	q->snapshot = snapshot;
+	try {
+	    q->context = manager.createQueryContext(DbXml::XmlQueryContext::LiveValues, DbXml::XmlQueryContext::Lazy);
+	    if (defaultCollection) {
+		q->context.setDefaultCollection(defaultCollection);
+	    }
+	    if (timeout) {
+		q->context.setQueryTimeoutSeconds(timeout);
+	    }
+	    if (baseURI.size()) {
+		q->context.setBaseURI(baseURI);
+	    }
+	    for (i = 0; namespaces[i]; i += 2) {
+		q->context.setNamespace(namespaces[i], namespaces[i+1]);
+	    }
+	    // variables are set before the query is prepared, so they don't need to be declared in the query
+	    for (i = 0; variables && variables[i]; i += 2) {
+		q->context.setVariableValue(variables[i], DbXml::XmlValue(variables[i+1]));
+	    }
+	    q->expression = manager.prepare(query, q->context);
+	    q->error = false;
+	    if (q->expression.isUpdateExpression()) {
+		q->errstring = "Update Expressions are not allowed";
+		q->error = true;
+	    }
+	} catch (...) {
+	    c_dbxml_catch(q->errstring, q->error, q->info);
+	}
+	return q;
+    }
+
+    void c_dbxml_set_query_timeout(c_dbxml db, unsigned int seconds)
+    {
+	db->timeout = seconds;
+    }
+
+    void c_dbxml_set_base_uri(c_dbxml db, char const *uri)
+    {
+	db->baseURI = uri;
+    }
+
+    void c_dbxml_env_set_base_uri(c_dbxml_env env, char const *uri)
+    {
+	env->baseURI = uri;
+    }
+
+    void c_dbxml_env_set_default_collection(c_dbxml_env env, char const *collection)
+    {
+	env->defaultCollection = collection;
+    }
+
+    void c_dbxml_set_unordered(c_dbxml db, int unordered)
+    {
+	db->unordered = unordered ? true : false;
+    }
+
+    void c_dbxml_set_transform(c_dbxml db, unsigned long long handle)
+    {
+	db->transform = handle;
+    }
+
+    // prepare a transformation query, or remove it if query is ""
+    static c_dbxml_result c_dbxml_set_transform_expr(c_dbxml db, DbXml::XmlQueryExpression &expr, char const *query)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	r->error = false;
+	try {
+	    if (query[0]) {
+		DbXml::XmlQueryContext context = db->manager.createQueryContext();
+		expr = db->manager.prepare(query, context);
+	    } else {
+		expr = DbXml::XmlQueryExpression();
+	    }
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_set_xinclude(c_dbxml db, int xinclude)
+    {
+	return c_dbxml_set_transform_expr(db, db->xinclude, xinclude ? c_dbxml_xinclude_query : "");
+    }
+
+    c_dbxml_result c_dbxml_set_strip_whitespace(c_dbxml db, int strip)
+    {
+	return c_dbxml_set_transform_expr(db, db->strip, strip ? c_dbxml_strip_query : "");
+    }
+
+    c_dbxml_result c_dbxml_set_transform_query(c_dbxml db, char const *query)
+    {
+	return c_dbxml_set_transform_expr(db, db->transformQuery, query);
+    }
+
+    /* Add the ordering declaration to the prolog of a query, after the version declaration if there is one.
+     */
+    static std::string c_dbxml_unordered_query(std::string const &query)
+    {
+	std::string::size_type i = query.find_first_not_of(" \t\r\n");
+	if (i != std::string::npos && query.compare(i, 6, "xquery") == 0) {
+	    std::string::size_type v = query.find_first_not_of(" \t\r\n", i + 6);
+	    std::string::size_type j = query.find(';', i);
+	    if (v != std::string::npos && query.compare(v, 7, "version") == 0 && j != std::string::npos) {
+		return query.substr(0, j + 1) + " declare ordering unordered; " + query.substr(j + 1);
+	    }
+	}
+	return "declare ordering unordered; " + query;
+    }
+
+    c_dbxml_query c_dbxml_prepare_query(c_dbxml db, char const *query, int useImplicitCollection, char const **namespaces)
+    {
+	return c_dbxml_prepare_query_context(db, query, useImplicitCollection, namespaces, 0, "");
+    }
+
+    // the query as it is prepared for the database
+    static std::string c_dbxml_prepared_text(c_dbxml db, char const *query, int useImplicitCollection)
+    {
+	std::string q(useImplicitCollection ? "collection('" + db->alias + "')" + query : query);
+	if (db->unordered) {
+	    q = c_dbxml_unordered_query(q);
+	}
+	return q;
+    }
+
+    c_dbxml_result c_dbxml_query_text(c_dbxml db, char const *query, int useImplicitCollection)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	r->result = c_dbxml_prepared_text(db, query, useImplicitCollection);
+	r->error = false;
+	return r;
+    }
+
+    c_dbxml_query c_dbxml_prepare_query_context(c_dbxml db, char const *query, int useImplicitCollection, char const **namespaces, char const **variables, char const *baseURI)
+    {
+	return c_dbxml_prepare(db->manager,
+			       c_dbxml_prepared_text(db, query, useImplicitCollection),
+			       db->alias.c_str(),
+			       namespaces,
+			       variables,
+			       db->timeout,
+			       *baseURI ? std::string(baseURI) : db->baseURI,
+			       db->snapshot);
+    }
+
+    c_dbxml_query c_dbxml_env_prepare_query(c_dbxml_env env, char const *query, char const **namespaces)
+    {
+	return c_dbxml_prepare(*env->manager,
+			       query,
+			       env->defaultCollection.size() ? env->defaultCollection.c_str() : 0,
+			       namespaces,
+			       0,
+			       0,
+			       env->baseURI,
+			       env->multiversion);
+    }
+
+    // isolation: 0 = default, 1 = read committed, 2 = read uncommitted, 3 = snapshot
+    static u_int32_t c_dbxml_isolation_flags(int isolation)
+    {
+	switch (isolation) {
+	case 1:
+	    return DB_READ_COMMITTED;
+	case 2:
+	    return DB_READ_UNCOMMITTED;
+	case 3:
+	    return DB_TXN_SNAPSHOT;
+	}
+	return 0;
+    }
+
+    static bool c_dbxml_query_snapshot(c_dbxml_query query)
+    {
+	return query->isolation == 3 || (query->isolation == 0 && query->snapshot);
+    }
+
+    static u_int32_t c_dbxml_query_flags(c_dbxml_query query)
+    {
+	if (query->isolation == 1 || query->isolation == 2) {
+	    return query->flags | c_dbxml_isolation_flags(query->isolation);
+	}
+	return query->flags;
+    }
+
+    void c_dbxml_query_set_isolation(c_dbxml_query query, int isolation)
+    {
+	query->isolation = isolation;
+    }
+
+    c_dbxml_docs c_dbxml_run_query(c_dbxml_query query)
+    {
+	c_dbxml_docs docs;
+	docs = new c_dbxml_docs_t;
+	docs->more = true;
+	docs->context = query->context;
+	docs->manager = query->manager;
+	try {
+	    if (c_dbxml_query_snapshot(query)) {
+		docs->txn = query->manager->createTransaction(DB_TXN_SNAPSHOT);
+		docs->it = query->expression.execute(docs->txn, docs->context, c_dbxml_query_flags(query));
+	    } else {
+		docs->it = query->expression.execute(docs->context, c_dbxml_query_flags(query));
+	    }
+	    docs->error = false;
+	} catch (...) {
+	    docs->more = false;
+	    c_dbxml_catch(docs->errstring, docs->error, docs->info);
+	}
+
+	return docs;
+    }
+
+    c_dbxml_docs c_dbxml_docs_query(c_dbxml_docs docs, char const *query)
+    {
+	c_dbxml_docs sub;
+	sub = new c_dbxml_docs_t;
+	sub->more = false;
+	sub->error = true;
+	if (!docs->manager) {
+	    sub->errstring = "Queries are not supported on these results";
+	    return sub;
+	}
+	if (!docs->more) {
+	    sub->errstring = "No current result";
+	    return sub;
+	}
+	sub->context = docs->context;
+	sub->manager = docs->manager;
+	try {
+	    // the transaction of a snapshot query is shared, not owned, so it is not committed by c_dbxml_docs_free(sub)
+	    DbXml::XmlValue item(docs->validDoc ? DbXml::XmlValue(docs->doc) : docs->value);
+	    DbXml::XmlTransaction txn(docs->txn);
+	    if (txn.isNull()) {
+		DbXml::XmlQueryExpression expression(sub->manager->prepare(query, sub->context));
+		sub->it = expression.execute(item, sub->context, DbXml::DBXML_LAZY_DOCS);
+	    } else {
+		DbXml::XmlQueryExpression expression(sub->manager->prepare(txn, query, sub->context));
+		sub->it = expression.execute(txn, item, sub->context, DbXml::DBXML_LAZY_DOCS);
+	    }
+	    sub->more = true;
+	    sub->error = false;
+	} catch (...) {
+	    c_dbxml_catch_msg(sub->errstring, sub->info);
+	}
+	return sub;
+    }
+
+    int c_dbxml_get_query_error(c_dbxml_docs docs)
+    {
+	return docs->error ? 1 : 0;
+    }
+
+    char const *c_dbxml_get_query_errstring(c_dbxml_docs docs)
+    {
+	return docs->errstring.c_str();
+    }
+
+    int c_dbxml_get_prepared_error(c_dbxml_query query)
+    {
+	return query->error ? 1 : 0;
+    }
+
+    char const *c_dbxml_get_prepared_errstring(c_dbxml_query query)
+    {
+	return query->errstring.c_str();
+    }
+
+    static int c_dbxml_docs_advance(c_dbxml_docs docs);
+
+    // an error while retrieving a part of the current result ends the iteration, the error is reported by c_dbxml_get_query_error
+    // call this only in a catch block
+    static void c_dbxml_docs_fail(c_dbxml_docs docs)
+    {
+	c_dbxml_catch(docs->errstring, docs->error, docs->info);
+	docs->more = false;
+    }
+
+    int c_dbxml_docs_next(c_dbxml_docs docs)
+    {
+	while (c_dbxml_docs_advance(docs)) {
+	    if (!docs->pattern.size() || fnmatch(docs->pattern.c_str(), c_dbxml_docs_name(docs), FNM_PATHNAME) == 0) {
+		return 1;
+	    }
+	    docs->count--;
+	}
+	return 0;
+    }
+
+    static int c_dbxml_docs_advance(c_dbxml_docs docs)
+    {
+	if (docs->more && docs->skip) {
+	    // skip results for paging, without retrieving their content
+	    try {
+		while (docs->skip && docs->more) {
+		    docs->more = docs->it.next(docs->value);
+		    docs->skip--;
+		}
+	    } catch (...) {
+		c_dbxml_docs_fail(docs);
+	    }
+	    docs->skip = 0;
+	}
+
+	if (docs->more && docs->limit && docs->count == docs->limit) {
+	    docs->more = false;
+	}
+
+	if (docs->more) {
+
+	    // goal: advance to next result and get both doc and value
+	    // two times peek() and then next() to prevent a segment violation
+
+	    try {
+		docs->more = docs->it.peek(docs->value);
+	    } catch (...) {
+		// while there are more results, this should always succeed, as the result is always an XmlValue
+		c_dbxml_docs_fail(docs);
+	    }
+
+	    docs->validDoc = false;
+	    if (docs->more) {
+		try {
+		    // this would cause a segment violation if first peek() failed
+		    docs->it.peek(docs->doc);
+		    docs->validDoc = true;
+		} catch (...) {
+		    // result is not always of type document, but we don't know this until we try.
+		}
+
+		// repeat first peek() as next() to advance
+		try {
+		    docs->more = docs->it.next(docs->value);
+		} catch (...) {
+		    c_dbxml_docs_fail(docs);
+		}
+	    }
+
+	    docs->name.clear();
+	    docs->content.clear();
+	    docs->match.clear();
+	    docs->handle.clear();
+	    docs->result.clear();
+
+	    if (docs->more) {
+		docs->count++;
+	    }
+	}
+	return docs->more ? 1 : 0;
+    }
+
+    void c_dbxml_docs_set_page(c_dbxml_docs docs, unsigned long long offset, unsigned long long limit)
+    {
+	docs->offset = offset;
+	docs->skip = offset;
+	docs->limit = limit;
+	docs->count = 0;
+    }
+
+    char const * c_dbxml_docs_name(c_dbxml_docs docs)
+    {
+	if (docs->more && ! docs->name.size()) {
+	    try {
+		if (docs->validDoc)
+		    docs->name = docs->doc.getName();
+		else
+		    docs->name = "";
+	    } catch (...) {
+		docs->name.clear();
+		c_dbxml_docs_fail(docs);
+	    }
+	}
+
+	return docs->name.c_str();
+    }
+
+    char const * c_dbxml_docs_content(c_dbxml_docs docs)
+    {
+	if (docs->more && ! docs->content.size()) {
+	    try {
+		if (docs->validDoc && ! docs->namesOnly) {
+		    docs->doc.getContent(docs->content);
+		} else {
+		    docs->content = "";
+		}
+	    } catch (...) {
+		docs->content.clear();
+		c_dbxml_docs_fail(docs);
+	    }
+	}
+
+	return docs->content.c_str();
+    }
+
+    c_dbxml_result c_dbxml_docs_content_result(c_dbxml_docs docs)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	r->error = false;
+	if (docs->more && docs->validDoc && ! docs->namesOnly) {
+	    try {
+		docs->doc.getContent(r->result);
+	    } catch (...) {
+		c_dbxml_catch(r->result, r->error, r->info);
+	    }
+	}
+	return r;
+    }
+
+    char const * c_dbxml_docs_match(c_dbxml_docs docs)
+    {
+	if (docs->more && ! docs->match.size() && ! docs->namesOnly && docs->value.isNode()) {
+	    try {
+		docs->match = docs->value.asString();
+	    } catch (...) {
+		docs->match.clear();
+		c_dbxml_docs_fail(docs);
+	    }
+	}
+
+	return docs->match.c_str();
+    }
+
+    char const * c_dbxml_docs_node_handle(c_dbxml_docs docs)
+    {
+	if (docs->more && ! docs->handle.size() && ! docs->namesOnly && docs->value.isNode()) {
+	    try {
+		docs->handle = docs->value.getNodeHandle();
+	    } catch (...) {
+		// not a node from a container, such as a node constructed by the query
+		docs->handle.clear();
+	    }
+	}
+
+	return docs->handle.c_str();
+    }
+
+    c_dbxml_result c_dbxml_get_node(c_dbxml db, char const *handle)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    DbXml::XmlValue value = db->container.getNode(handle);
+	    r->result = value.asString();
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    char const * c_dbxml_docs_value(c_dbxml_docs docs)
+    {
+	if (docs->more && ! docs->result.size() && ! docs->namesOnly) {
+	    try {
+		docs->result = docs->value.asString();
+	    } catch (...) {
+		docs->result.clear();
+		c_dbxml_docs_fail(docs);
+	    }
+	}
+
+	return docs->result.c_str();
+    }
+
+    int c_dbxml_docs_next_n(c_dbxml_docs docs, int n, int match)
+    {
+	int i;
+	docs->batch.clear();
+	for (i = 0; i < n; i++) {
+	    if (!c_dbxml_docs_next(docs)) {
+		break;
+	    }
+	    docs->batch.append(c_dbxml_docs_name(docs));
+	    docs->batch.push_back('\0');
+	    if (match == 2) {
+		docs->batch.append(c_dbxml_docs_content(docs));
+		docs->batch.push_back('\0');
+		docs->batch.append(c_dbxml_docs_match(docs));
+		docs->batch.push_back('\0');
+		// for a node, the value is the same as the match
+		if (! docs->value.isNode()) {
+		    docs->batch.append(c_dbxml_docs_value(docs));
+		}
+	    } else {
+		docs->batch.append(match ? c_dbxml_docs_match(docs) : c_dbxml_docs_content(docs));
+	    }
+	    docs->batch.push_back('\0');
+	}
+	return i;
+    }
+
+    char const *c_dbxml_docs_batch(c_dbxml_docs docs)
+    {
+	return docs->batch.data();
+    }
+
+    unsigned long long c_dbxml_docs_batch_size(c_dbxml_docs docs)
+    {
+	return (unsigned long long) docs->batch.size();
+    }
+
+    // the metadata of the current document, as uri, name and value, each followed by a null byte
+    // returns the number of items, or -1 on error
+    int c_dbxml_docs_metadata(c_dbxml_docs docs)
+    {
+	int n = 0;
+	docs->batch.clear();
+	if (!(docs->more && docs->validDoc)) {
+	    return 0;
+	}
+	try {
+	    DbXml::XmlMetaDataIterator it = docs->doc.getMetaDataIterator();
+	    std::string uri, name;
+	    DbXml::XmlValue value;
+	    while (it.next(uri, name, value)) {
+		// skip internal metadata, such as the document name, and binary blobs
+		if (uri == DBXML_URI || uri == BLOB_URI) {
+		    continue;
+		}
+		docs->batch.append(uri);
+		docs->batch.push_back('\0');
+		docs->batch.append(name);
+		docs->batch.push_back('\0');
+		docs->batch.append(value.asString());
+		docs->batch.push_back('\0');
+		n++;
+	    }
+	} catch (...) {
+	    c_dbxml_catch_msg(docs->errstring, docs->info);
+	    return -1;
+	}
+	return n;
+    }
+
+    int c_dbxml_docs_eager(c_dbxml_docs docs)
+    {
+	try {
+	    return docs->it.getEvaluationType() == DbXml::XmlResults::Eager ? 1 : 0;
+	} catch (...) {
+	    return 0;
+	}
+    }
+
+    c_dbxml_result c_dbxml_docs_reset(c_dbxml_docs docs)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    docs->it.reset();
+	    docs->skip = docs->offset;
+	    docs->count = 0;
+	    docs->more = true;
+	    docs->error = false;
+	    docs->errstring.clear();
+	    docs->name.clear();
+	    docs->content.clear();
+	    docs->match.clear();
+	    docs->handle.clear();
+	    docs->result.clear();
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_result c_dbxml_docs_size(c_dbxml_docs docs, unsigned long long *size)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	*size = 0;
+	try {
+	    *size = (unsigned long long) docs->it.size();
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    void c_dbxml_docs_free(c_dbxml_docs docs)
+    {
+	if (!docs->txn.isNull() && !docs->sharedTxn) {
+	    // release the results before ending the snapshot transaction they were read in
+	    docs->doc = DbXml::XmlDocument();
+	    docs->value = DbXml::XmlValue();
+	    docs->it = DbXml::XmlResults();
+	    try {
+		docs->txn.commit();
+	    } catch (...) {
+		;
+	    }
+	}
+	delete docs;
+    }
+
+    void c_dbxml_query_free(c_dbxml_query query)
+    {
+	query->context.clearNamespaces(); // is this necessary?
+	delete query;
+    }
+
+    void c_dbxml_cancel_query(c_dbxml_query query)
+    {
+	try {
+	    query->context.interruptQuery();
+	} catch (...) {
+	    // nothing to report to, a query that is not interrupted runs to the end
+	    ;
+	}
+    }
+
+    c_dbxml_result c_dbxml_query_count(c_dbxml_query query, unsigned long long *count)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	*count = 0;
+	try {
+	    DbXml::XmlQueryContext context = query->context;
+	    DbXml::XmlTransaction txn;
+	    if (c_dbxml_query_snapshot(query)) {
+		txn = query->manager->createTransaction(DB_TXN_SNAPSHOT);
+	    }
+	    DbXml::XmlResults it = txn.isNull() ?
+		query->expression.execute(context, c_dbxml_query_flags(query) | DbXml::DBXML_LAZY_DOCS) :
+		query->expression.execute(txn, context, c_dbxml_query_flags(query) | DbXml::DBXML_LAZY_DOCS);
+	    DbXml::XmlValue value;
+	    while (it.next(value)) {
+		(*count)++;
+	    }
+	    it = DbXml::XmlResults();
+	    if (!txn.isNull()) {
+		txn.commit();
+	    }
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    void c_dbxml_query_set_eager(c_dbxml_query query, int eager)
+    {
+	try {
+	    query->context.setEvaluationType(eager ? DbXml::XmlQueryContext::Eager : DbXml::XmlQueryContext::Lazy);
+	} catch (...) {
+	    // keep the current evaluation type
+	    ;
+	}
+    }
+
+    // what: 0 = string value, 1 = xml document parsed from value, 2 = current item of docs
+    c_dbxml_result c_dbxml_query_set_variable(c_dbxml_query query, char const *name, int what, char const *value, c_dbxml_docs docs)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    switch (what) {
+	    case 0:
+		query->context.setVariableValue(name, DbXml::XmlValue(value));
+		break;
+	    case 1: {
+		DbXml::XmlDocument doc = query->manager->createDocument();
+		doc.setContent(value);
+		{
+		    // parse the document now, so an error is reported here, not when the query is run
+		    DbXml::XmlEventReader &reader = doc.getContentAsEventReader();
+		    try {
+			while (reader.hasNext()) {
+			    reader.next();
+			}
+		    } catch (...) {
+			reader.close();
+			throw;
+		    }
+		    reader.close();
+		}
+		query->context.setVariableValue(name, DbXml::XmlValue(doc));
+		break;
+	    }
+	    case 2:
+		if (!docs->more) {
+		    r->result = "No current result";
+		    r->error = true;
+		    return r;
+		}
+		query->context.setVariableValue(name, docs->value);
+		break;
+	    }
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    void c_dbxml_query_set_flags(c_dbxml_query query, int lazydocs, int projection, int wellformed)
+    {
+	query->flags = 0;
+	if (lazydocs) {
+	    query->flags |= DbXml::DBXML_LAZY_DOCS;
+	}
+	if (projection) {
+	    query->flags |= DbXml::DBXML_DOCUMENT_PROJECTION;
+	}
+	if (wellformed) {
+	    query->flags |= DbXml::DBXML_WELL_FORMED_ONLY;
+	}
+    }
+
+    c_dbxml_result c_dbxml_query_plan(c_dbxml_query query)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    r->result = query->expression.getQueryPlan();
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
+
+    c_dbxml_stream c_dbxml_get_stream(c_dbxml db, char const *name)
+    {
+	c_dbxml_stream s;
+	s = new c_dbxml_stream_t;
+	s->is = 0;
+	try {
+	    s->doc = db->container.getDocument(name, DbXml::DBXML_LAZY_DOCS);
+	    s->is = s->doc.getContentAsXmlInputStream();
+	    s->error = false;
+	} catch (...) {
+	    c_dbxml_catch(s->errstring, s->error, s->info);
+	}
+	return s;
+    }
+
+    c_dbxml_stream c_dbxml_docs_content_stream(c_dbxml_docs docs)
+    {
+	c_dbxml_stream s;
+	s = new c_dbxml_stream_t;
+	s->is = 0;
+	s->error = false;
+	if (docs->more && docs->validDoc) {
 	    try {
-		db->container.putDocument(doc, db->context);
-		r->error = false;
-	    } catch (DbXml::XmlException &xe) {
-		r->result = xe.what();
-		r->error = true;
-		return r;
+		s->doc = docs->doc;
+		s->is = s->doc.getContentAsXmlInputStream();
+	    } catch (...) {
+		c_dbxml_catch(s->errstring, s->error, s->info);
 	    }
 	}
-	return r;
+	return s;
     }
 
-    c_dbxml_result c_dbxml_remove(c_dbxml db, char const * filename)
+    int c_dbxml_stream_error(c_dbxml_stream s)
+    {
+	return s->error ? 1 : 0;
+    }
+
+    char const *c_dbxml_stream_errstring(c_dbxml_stream s)
+    {
+	return s->errstring.c_str();
+    }
+
+    long long c_dbxml_stream_read(c_dbxml_stream s, char *buf, unsigned int size)
+    {
+	if (s->error) {
+	    return -1;
+	}
+	if (!s->is) {
+	    return 0;
+	}
+	try {
+	    return (long long) s->is->readBytes(buf, size);
+	} catch (...) {
+	    c_dbxml_catch(s->errstring, s->error, s->info);
+	}
+	return -1;
+    }
+
+    void c_dbxml_stream_free(c_dbxml_stream s)
+    {
+	delete s->is;
+	delete s;
+    }
+
+    c_dbxml_result c_dbxml_verify(char const *filename)
     {
 	c_dbxml_result r;
 	r = new c_dbxml_result_t;
+	try {
+	    DbXml::XmlManager manager;
+	    std::ostringstream out;
+	    manager.verifyContainer(filename, &out);
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
 
+    c_dbxml_result c_dbxml_upgrade(char const *filename)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
 	try {
-	    db->container.deleteDocument(filename, db->context);
+	    DbXml::XmlManager manager;
+	    DbXml::XmlUpdateContext context = manager.createUpdateContext();
+	    manager.upgradeContainer(filename, context);
 	    r->error = false;
-        } catch (DbXml::XmlException &xe) {
-	    r->result = xe.what();
-	    r->error = true;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
 	}
 	return r;
     }
 
-    c_dbxml_result c_dbxml_get(c_dbxml db, char const * name)
+    c_dbxml_result c_dbxml_check(char const *query, char const **namespaces)
     {
 	c_dbxml_result r;
 	r = new c_dbxml_result_t;
+	int i;
 	try {
-	    DbXml::XmlDocument doc = db->container.getDocument(name);
-	    doc.getContent(r->result);
+	    DbXml::XmlManager manager;
+	    manager.registerResolver(c_dbxml_resolver);
+	    c_dbxml_set_logging(manager.getDB_ENV());
+	    DbXml::XmlQueryContext context;
+	    DbXml::XmlQueryExpression expr;
+	    context = manager.createQueryContext(DbXml::XmlQueryContext::LiveValues, DbXml::XmlQueryContext::Lazy);
+	    for (i = 0; namespaces[i]; i += 2) {
+		context.setNamespace(namespaces[i], namespaces[i+1]);
+	    }
+	    expr = manager.prepare(std::string(query), context);
 	    r->error = false;
-	} catch (DbXml::XmlException &xe) {
-	    r->result = xe.what();
-	    r->error = true;
+	    if (expr.isUpdateExpression()) {
+		r->result = "Update Expressions are not allowed";
+		r->error = true;
+	    }
+	    context.clearNamespaces(); // is this necessary?
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
 	}
 	return r;
     }
 
-    unsigned long long c_dbxml_size(c_dbxml db)
+    void c_dbxml_version(int *major, int *minor, int *patch)
     {
-	return (unsigned long long) db->container.getNumDocuments();
+	DbXml::dbxml_version(major, minor, patch);
     }
 
-    c_dbxml_docs c_dbxml_get_all(c_dbxml db)
+    char const *c_dbxml_version_string()
     {
-	c_dbxml_docs docs;
-	docs = new c_dbxml_docs_t;
-	docs->it = db->container.getAllDocuments(DbXml::DBXML_LAZY_DOCS);
-	docs->more = true;
-	docs->error = false;
-	return docs;
+	int major, minor, patch;
+	return DbXml::dbxml_version(&major, &minor, &patch);
     }
 
-    c_dbxml_query c_dbxml_prepare_query(c_dbxml db, char const *query, int useImplicitCollection, char const **namespaces)
+    char const *c_dbxml_db_version_string()
     {
-	int i;
-	c_dbxml_query q;
-	q = new c_dbxml_query_t;
+	int major, minor, patch;
+	return db_version(&major, &minor, &patch);
+    }
+
+    c_dbxml_result c_dbxml_container_version(c_dbxml db, int *version)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
 	try {
-	    q->context = db->manager.createQueryContext(DbXml::XmlQueryContext::LiveValues, DbXml::XmlQueryContext::Lazy);
-	    q->context.setDefaultCollection(ALIAS);
-	    for (i = 0; namespaces[i]; i += 2) {
-		q->context.setNamespace(namespaces[i], namespaces[i+1]);
-	    }
-	    q->expression = db->manager.prepare(useImplicitCollection ? std::string("collection('" ALIAS "')") + query : query, q->context);
-	    q->error = false;
-	    if (q->expression.isUpdateExpression()) {
-		q->errstring = "Update Expressions are not allowed";
-		q->error = true;
-	    }
-	} catch (DbXml::XmlException const &xe) {
-	    q->errstring = xe.what();
-	    q->error = true;
+	    // existsContainer returns the format version of an existing container
+	    *version = db->manager.existsContainer(db->container.getName());
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
 	}
-	return q;
+	return r;
     }
 
-    c_dbxml_docs c_dbxml_run_query(c_dbxml_query query)
+
+    c_dbxml_txn c_dbxml_txn_begin(c_dbxml db, int isolation)
     {
-	c_dbxml_docs docs;
-	docs = new c_dbxml_docs_t;
-	docs->more = true;
-	docs->context = query->context;
+	c_dbxml_txn txn;
+	txn = new c_dbxml_txn_t;
+	txn->db = db;
+	txn->error = false;
+	if (!db->config.getTransactional()) {
+	    txn->errstring = "Database is not transactional";
+	    txn->error = true;
+	    return txn;
+	}
 	try {
-	    docs->it = query->expression.execute(docs->context,
-						 DbXml::DBXML_LAZY_DOCS | DbXml::DBXML_WELL_FORMED_ONLY
-						 );
-	    docs->error = false;
-	} catch (DbXml::XmlException const &xe) {
-	    docs->more = false;
-	    docs->errstring = xe.what();
-	    docs->error = true;
+	    txn->txn = db->manager.createTransaction(c_dbxml_isolation_flags(isolation));
+	    txn->context = db->manager.createUpdateContext();
+	} catch (...) {
+	    c_dbxml_catch(txn->errstring, txn->error, txn->info);
 	}
-
-	return docs;
+	return txn;
     }
 
-    int c_dbxml_get_query_error(c_dbxml_docs docs)
+    int c_dbxml_txn_error(c_dbxml_txn txn)
     {
-	return docs->error ? 1 : 0;
+	return txn->error ? 1 : 0;
     }
 
-    char const *c_dbxml_get_query_errstring(c_dbxml_docs docs)
+    char const *c_dbxml_txn_errstring(c_dbxml_txn txn)
     {
-	return docs->errstring.c_str();
+	return txn->errstring.c_str();
     }
 
-    int c_dbxml_get_prepared_error(c_dbxml_query query)
+    c_dbxml_errinfo c_dbxml_errinfo_txn(c_dbxml_txn txn)
     {
-	return query->error ? 1 : 0;
+	return c_dbxml_get_errinfo(txn->info);
     }
 
-    char const *c_dbxml_get_prepared_errstring(c_dbxml_query query)
+    c_dbxml_result c_dbxml_txn_commit(c_dbxml_txn txn)
     {
-	return query->errstring.c_str();
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    txn->txn.commit();
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
     }
 
-    int c_dbxml_docs_next(c_dbxml_docs docs)
+    c_dbxml_result c_dbxml_txn_abort(c_dbxml_txn txn)
     {
-	if (docs->more) {
-
-	    // goal: advance to next result and get both doc and value
-	    // two times peek() and then next() to prevent a segment violation
-
-	    try {
-		docs->more = docs->it.peek(docs->value);
-	    } catch (DbXml::XmlException &xe) {
-		// while there are more results, this should always succeed, as the result is always an XmlValue
-		docs->errstring = xe.what();
-		docs->error = true;
-		docs->more = false;
-	    }
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    txn->txn.abort();
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
+    }
 
-	    docs->validDoc = false;
-	    if (docs->more) {
-		try {
-		    // this would cause a segment violation if first peek() failed
-		    docs->it.peek(docs->doc);
-		    docs->validDoc = true;
-		} catch (...) {
-		    // result is not always of type document, but we don't know this until we try.
-		}
+    void c_dbxml_txn_free(c_dbxml_txn txn)
+    {
+	delete txn;
+    }
 
-		// repeat first peek() as next() to advance
+    // replace if replace != 0
+    c_dbxml_result c_dbxml_txn_put_xml(c_dbxml_txn txn, char const *name, char const *data, int replace)
+    {
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    std::string created;
+	    if (replace) {
+		created = c_dbxml_created(txn->db, &txn->txn, name);
 		try {
-		    docs->more = docs->it.next(docs->value);
+		    txn->db->container.deleteDocument(txn->txn, name, txn->context);
 		} catch (DbXml::XmlException &xe) {
-		    docs->errstring = xe.what();
-		    docs->error = true;
-		    docs->more = false;
+		    // a deadlock must abort the transaction, a missing document is not an error
+		    if (xe.getExceptionCode() != DbXml::XmlException::DOCUMENT_NOT_FOUND) {
+			throw;
+		    }
 		}
 	    }
-
-	    docs->name.clear();
-	    docs->content.clear();
-	    docs->match.clear();
-	    docs->result.clear();
+	    if (txn->db->timestamps || c_dbxml_transforms(txn->db)) {
+		DbXml::XmlDocument doc = c_dbxml_new_doc(txn->db, name, created);
+		doc.setContent(data);
+		c_dbxml_transform(txn->db, doc);
+		txn->db->container.putDocument(txn->txn, doc, txn->context);
+	    } else {
+		txn->db->container.putDocument(txn->txn, name, data, txn->context);
+	    }
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
 	}
-	return docs->more ? 1 : 0;
+	return r;
     }
 
-    char const * c_dbxml_docs_name(c_dbxml_docs docs)
+    c_dbxml_docs c_dbxml_txn_query(c_dbxml_txn txn, char const *query, char const **namespaces)
     {
-	if (docs->more && ! docs->name.size()) {
-	    if (docs->validDoc)
-		docs->name = docs->doc.getName();
-	    else
-		docs->name = "";
+	c_dbxml_docs docs;
+	docs = new c_dbxml_docs_t;
+	docs->manager = &txn->db->manager;
+	docs->txn = txn->txn;
+	docs->sharedTxn = true;
+	c_dbxml_query q = c_dbxml_prepare_query(txn->db, query, 1, namespaces);
+	if (q->error) {
+	    docs->more = false;
+	    docs->errstring = q->errstring;
+	    docs->info = q->info;
+	    docs->error = true;
+	    c_dbxml_query_free(q);
+	    return docs;
 	}
-
-	return docs->name.c_str();
+	docs->context = q->context;
+	docs->expression = q->expression;
+	c_dbxml_query_free(q);
+	try {
+	    docs->it = docs->expression.execute(docs->txn, docs->context, DbXml::DBXML_LAZY_DOCS | DbXml::DBXML_WELL_FORMED_ONLY);
+	    docs->more = true;
+	    docs->error = false;
+	} catch (...) {
+	    docs->more = false;
+	    c_dbxml_catch(docs->errstring, docs->error, docs->info);
+	}
+	return docs;
     }
 
-    char const * c_dbxml_docs_content(c_dbxml_docs docs)
+    c_dbxml_docs c_dbxml_txn_get_all(c_dbxml_txn txn)
     {
-	if (docs->more && ! docs->content.size()) {
-	    if (docs->validDoc) {
-		docs->doc.getContent(docs->content);
-	    } else {
-		docs->content = "";
-	    }
+	c_dbxml_docs docs;
+	docs = new c_dbxml_docs_t;
+	docs->manager = &txn->db->manager;
+	docs->txn = txn->txn;
+	docs->sharedTxn = true;
+	try {
+	    docs->it = txn->db->container.getAllDocuments(docs->txn, DbXml::DBXML_LAZY_DOCS);
+	    docs->more = true;
+	    docs->error = false;
+	} catch (...) {
+	    docs->more = false;
+	    c_dbxml_catch(docs->errstring, docs->error, docs->info);
 	}
-
-	return docs->content.c_str();
+	return docs;
     }
 
-    char const * c_dbxml_docs_match(c_dbxml_docs docs)
+    c_dbxml_result c_dbxml_txn_get(c_dbxml_txn txn, char const *name)
     {
-	if (docs->more && ! docs->match.size() && docs->value.isNode()) {
-	    docs->match = docs->value.asString();
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    DbXml::XmlDocument doc = txn->db->container.getDocument(txn->txn, name);
+	    doc.getContent(r->result);
+	    r->error = false;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
 	}
-
-	return docs->match.c_str();
+	return r;
     }
 
-    char const * c_dbxml_docs_value(c_dbxml_docs docs)
+    /* Blobs are stored as binary metadata of the document, so they are part of the same write operations.
+       Throws on error, found is set to false if the blob doesn't exist.
+     */
+    static std::string c_dbxml_blob_op(c_dbxml db, DbXml::XmlTransaction &txn, DbXml::XmlUpdateContext &context,
+				       int op, char const *name, char const *key, char const *data, unsigned long long size, bool &found)
     {
-	if (docs->more && ! docs->result.size()) {
-	    docs->result = docs->value.asString();
+	std::string result;
+	DbXml::XmlDocument doc = txn.isNull() ? db->container.getDocument(name) : db->container.getDocument(txn, name);
+	DbXml::XmlData blob;
+	found = true;
+	switch (op) {
+	case 0:
+	    if (doc.getMetaData(BLOB_URI, key, blob)) {
+		result.assign((char const *) blob.get_data(), blob.get_size());
+	    } else {
+		found = false;
+	    }
+	    break;
+	case 1:
+	case 2:
+	    if (op == 1) {
+		doc.setMetaData(BLOB_URI, key, DbXml::XmlData((void *) data, (u_int32_t) size));
+	    } else if (doc.getMetaData(BLOB_URI, key, blob)) {
+		doc.removeMetaData(BLOB_URI, key);
+	    } else {
+		found = false;
+		break;
+	    }
+	    if (txn.isNull()) {
+		db->container.updateDocument(doc, context);
+	    } else {
+		db->container.updateDocument(txn, doc, context);
+	    }
+	    break;
+	case 3: {
+	    DbXml::XmlMetaDataIterator it = doc.getMetaDataIterator();
+	    std::string uri, mdname;
+	    DbXml::XmlValue value;
+	    while (it.next(uri, mdname, value)) {
+		if (uri == BLOB_URI) {
+		    result.append(mdname);
+		    result.push_back('\0');
+		}
+	    }
+	    break;
 	}
-
-	return docs->result.c_str();
+	}
+	return result;
     }
 
-    void c_dbxml_docs_free(c_dbxml_docs docs)
+    static void c_dbxml_blob_not_found(c_dbxml_result r)
     {
-	delete docs;
+	r->result = "Blob not found";
+	r->info = c_dbxml_errstate();
+	r->info.code = 12;
+	r->error = true;
     }
 
-    void c_dbxml_query_free(c_dbxml_query query)
+    c_dbxml_result c_dbxml_blob(c_dbxml db, int op, char const *name, char const *key, char const *data, unsigned long long size)
     {
-	query->context.clearNamespaces(); // is this necessary?
-	delete query;
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	DbXml::XmlTransaction txn;
+	try {
+	    // read and write the document in one transaction
+	    if ((op == 1 || op == 2) && db->config.getTransactional()) {
+		txn = db->manager.createTransaction();
+	    }
+	    bool found;
+	    r->result = c_dbxml_blob_op(db, txn, db->context, op, name, key, data, size, found);
+	    if (!txn.isNull()) {
+		txn.commit();
+	    }
+	    r->error = false;
+	    if (!found) {
+		c_dbxml_blob_not_found(r);
+	    }
+	} catch (...) {
+	    c_dbxml_abort(txn);
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
     }
 
-    void c_dbxml_cancel_query(c_dbxml_query query)
+    c_dbxml_result c_dbxml_txn_blob(c_dbxml_txn txn, int op, char const *name, char const *key, char const *data, unsigned long long size)
     {
-	query->context.interruptQuery();
+	c_dbxml_result r;
+	r = new c_dbxml_result_t;
+	try {
+	    bool found;
+	    r->result = c_dbxml_blob_op(txn->db, txn->txn, txn->context, op, name, key, data, size, found);
+	    r->error = false;
+	    if (!found) {
+		c_dbxml_blob_not_found(r);
+	    }
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
+	}
+	return r;
     }
 
-    c_dbxml_result c_dbxml_check(char const *query, char const **namespaces)
+    c_dbxml_result c_dbxml_txn_remove(c_dbxml_txn txn, char const *name)
     {
 	c_dbxml_result r;
 	r = new c_dbxml_result_t;
-	int i;
 	try {
-	    DbXml::XmlManager manager;
-	    DbXml::XmlQueryContext context;
-	    DbXml::XmlQueryExpression expr;
-	    context = manager.createQueryContext(DbXml::XmlQueryContext::LiveValues, DbXml::XmlQueryContext::Lazy);
-	    for (i = 0; namespaces[i]; i += 2) {
-		context.setNamespace(namespaces[i], namespaces[i+1]);
-	    }
-	    expr = manager.prepare(std::string(query), context);
+	    txn->db->container.deleteDocument(txn->txn, name, txn->context);
 	    r->error = false;
-	    if (expr.isUpdateExpression()) {
-		r->result = "Update Expressions are not allowed";
-		r->error = true;
-	    }
-	    context.clearNamespaces(); // is this necessary?
-	} catch (DbXml::XmlException const &xe) {
-	    r->result = xe.what();
-	    r->error = true;
+	} catch (...) {
+	    c_dbxml_catch(r->result, r->error, r->info);
 	}
 	return r;
     }
 
-    void c_dbxml_version(int *major, int *minor, int *patch)
+    void *c_dbxml_raw_manager(c_dbxml db)
     {
-	DbXml::dbxml_version(major, minor, patch);
+	return &db->manager;
+    }
+
+    void *c_dbxml_raw_container(c_dbxml db)
+    {
+	return &db->container;
+    }
+
+    void *c_dbxml_raw_results(c_dbxml_docs docs)
+    {
+	return &docs->it;
+    }
+
+    void *c_dbxml_raw_value(c_dbxml_docs docs)
+    {
+	return &docs->value;
     }
 
 }
@@ -13,62 +13,385 @@ extern "C" {
 
     typedef struct c_dbxml_query_t *c_dbxml_query;
 
-    c_dbxml c_dbxml_open(char const *filename, int, int);
+    typedef struct c_dbxml_env_t *c_dbxml_env;
+
+
+    typedef struct c_dbxml_stream_t *c_dbxml_stream;
+
+    typedef struct c_dbxml_txn_t *c_dbxml_txn;
+
+    /* code: 0 = other, 1 = document not found, 2 = uniqueness violated (document exists),
+             3 = container closed, 4 = container not found, 5 = container exists,
+             6 = query parser error, 7 = query evaluation error, 8 = interrupted, 9 = timeout (query or lock),
+             10 = document not well-formed or not valid, 11 = deadlock
+       line, column: position in query, 0 = unknown
+       dberrno: Berkeley DB error number, 0 = none
+     */
+    typedef struct {
+	int code;
+	int line;
+	int column;
+	int dberrno;
+    } c_dbxml_errinfo;
+
+    /* creation: 0 = create if missing, 1 = fail if exists, 2 = fail if missing
+       storage: 0 = default, 1 = node storage, 2 = whole document storage
+       compression: "" = default, "none", "default", or a name registered with c_dbxml_register_compression
+       cachesize, pagesize: 0 = default, pagesize is only used for a new container
+       password: "" = no encryption
+     */
+    c_dbxml c_dbxml_open(char const *filename, int readwrite, int read, int creation, int storage, int validate, char const *compression,
+			 unsigned long long cachesize, unsigned int pagesize, char const *password);
+    /* compression implemented by goCompress
+     */
+    void c_dbxml_register_compression(char const *name);
     void c_dbxml_free(c_dbxml db);
+    c_dbxml_result c_dbxml_close(c_dbxml db);
+
+    /* next value of a named sequence, stored in the file filename + ".seq"
+     */
+    c_dbxml_result c_dbxml_next_sequence(c_dbxml db, char const *name, unsigned long long *value);
+
+    /**** LOGGING ****/
+
+    /* level and category: bit masks of DbXml::LogLevel and DbXml::LogCategory
+     */
+    void c_dbxml_set_log_level(int level, int enabled);
+    void c_dbxml_set_log_category(int category, int enabled);
+
+    /**** ERRORS ****/
+
+    c_dbxml_errinfo c_dbxml_errinfo_db(c_dbxml db);
+    c_dbxml_errinfo c_dbxml_errinfo_result(c_dbxml_result r);
+    c_dbxml_errinfo c_dbxml_errinfo_docs(c_dbxml_docs docs);
+    c_dbxml_errinfo c_dbxml_errinfo_query(c_dbxml_query query);
+    c_dbxml_errinfo c_dbxml_errinfo_env(c_dbxml_env env);
+    c_dbxml_errinfo c_dbxml_errinfo_stream(c_dbxml_stream s);
 
     int c_dbxml_error(c_dbxml db);
     char const * c_dbxml_errstring(c_dbxml db);
 
+    /**** ENVIRONMENT ****/
+
+    /* cachesize: 0 = default
+       datadir, logdir: "" = default
+       locktimeout, txntimeout: in microseconds, 0 = no timeout
+       localhost: "" = no replication
+       remotehosts: NULL-terminated, with remoteports of same length
+       role: 0 = election, 1 = master, 2 = client
+       password: "" = no encryption, else new containers are encrypted
+       multiprocess: register the process, and run recovery if a process that used the environment died,
+                     multiprocess implies transactional
+       recovery: 0 = none, 1 = normal, 2 = catastrophic, recovery implies transactional,
+                 recovery messages are sent to the message callback
+     */
+    c_dbxml_env c_dbxml_env_open(char const *home, unsigned long long cachesize, char const *datadir, char const *logdir, int transactional, int multiversion,
+				 unsigned int locktimeout, unsigned int txntimeout,
+				 char const *localhost, unsigned int localport, char const **remotehosts, unsigned int *remoteports,
+				 int role, int priority, char const *password, int multiprocess, int recovery);
+    /* a manager without an explicit environment
+     */
+    c_dbxml_env c_dbxml_manager_new();
+    void c_dbxml_env_free(c_dbxml_env env);
+
+    int c_dbxml_env_is_master(c_dbxml_env env);
+    int c_dbxml_env_error(c_dbxml_env env);
+    char const * c_dbxml_env_errstring(c_dbxml_env env);
+
+    /* see: c_dbxml_open
+     */
+    c_dbxml c_dbxml_env_open_container(c_dbxml_env env, char const *filename, int readwrite, int read, int creation, int storage, int validate, char const *compression,
+				       unsigned int pagesize);
+
+    /* query over all containers opened in the environment, without a default collection
+     */
+    c_dbxml_query c_dbxml_env_prepare_query(c_dbxml_env env, char const *query, char const **namespaces);
+    void c_dbxml_env_set_base_uri(c_dbxml_env env, char const *uri);
+    /* for queries prepared after this call, "" = no default collection
+     */
+    void c_dbxml_env_set_default_collection(c_dbxml_env env, char const *collection);
+
     /**** RESULTS ****/
 
     void c_dbxml_result_free(c_dbxml_result r);
 
     int c_dbxml_result_error(c_dbxml_result r);
     char const *c_dbxml_result_string(c_dbxml_result r);
+    unsigned long long c_dbxml_result_size(c_dbxml_result r);
+
+    c_dbxml_result c_dbxml_add_alias(c_dbxml db, char const *alias);
 
     /**** WRITE ****/
 
+    /* if timestamps != 0, put operations set the metadata dcterms:created and dcterms:modified
+     */
+    void c_dbxml_set_timestamps(c_dbxml db, int timestamps);
+
     /* replace if replace != 0
      */
     c_dbxml_result c_dbxml_put_file(c_dbxml db, char const *filename, int replace);
+    /* name: the name of the document, "" = filename
+       result: the name of the document
+     */
+    c_dbxml_result c_dbxml_put_file_named(c_dbxml db, char const *filename, char const *name, int replace);
+    /* filenames: NULL-terminated
+       in a transactional environment, all files are put in one transaction
+       result: index, code, line, column, dberrno and message of each file that failed, each followed by '\0'
+     */
+    c_dbxml_result c_dbxml_put_files(c_dbxml db, char const **filenames, int replace);
 
     /* replace if replace != 0
      */
     c_dbxml_result c_dbxml_put_xml(c_dbxml db, char const *name, char const *data, int replace);
 
+    /* data doesn't need to be nul-terminated
+       replace if replace != 0
+     */
+    c_dbxml_result c_dbxml_put_xml_bytes(c_dbxml db, char const *name, char const *data, unsigned long long size, int replace);
+
+    /* read document from Go reader with handle
+       replace if replace != 0
+     */
+    c_dbxml_result c_dbxml_put_reader(c_dbxml db, char const *name, unsigned long long handle, int replace);
+
+    /* metadata: uri, name, value, ..., NULL
+       with replace, content and metadata of an existing document are replaced in a single update
+     */
+    c_dbxml_result c_dbxml_put_xml_metadata(c_dbxml db, char const *name, char const *data, char const **metadata, int replace);
+
+    /* name is used as prefix for a generated unique name, returned as result string
+     */
+    c_dbxml_result c_dbxml_put_xml_gen_name(c_dbxml db, char const *prefix, char const *data);
+
+    /* document must exist
+     */
+    c_dbxml_result c_dbxml_update_xml(c_dbxml db, char const *name, char const *data);
+
     /* replace if replace != 0
      */
     c_dbxml_result c_dbxml_merge(c_dbxml db, char const *dbxmlfile, int replace);
+    c_dbxml_result c_dbxml_merge_progress(c_dbxml db, char const *dbxmlfile, int replace, unsigned long long handle);
+    c_dbxml_result c_dbxml_merge_from(c_dbxml db, c_dbxml src, int replace);
 
     c_dbxml_result c_dbxml_remove(c_dbxml db, char const *name);
+    /* names is terminated by NULL, in one transaction if the database is transactional
+       result: for each document removed, its index in names, followed by a null byte
+     */
+    c_dbxml_result c_dbxml_remove_many(c_dbxml db, char const **names);
+
+    /* metadata is kept, fails if newname exists
+     */
+    c_dbxml_result c_dbxml_rename(c_dbxml db, char const *oldname, char const *newname);
+
+    /* versions: store data as a new revision, keeping the previous content in metadata
+       result is the new revision number; when is the time of the revision
+     */
+    c_dbxml_result c_dbxml_put_version(c_dbxml db, char const *name, char const *data, char const *when);
+    c_dbxml_result c_dbxml_get_version(c_dbxml db, char const *name, long n);
+    /* result: for each revision, number and time, each followed by '\0'
+     */
+    c_dbxml_result c_dbxml_history(c_dbxml db, char const *name);
+
+    /* remove all documents matched by query in the implicit collection, set count to number of removed documents
+     */
+    c_dbxml_result c_dbxml_remove_query(c_dbxml db, char const *query, char const **namespaces, unsigned long long *count);
+
+    /* query must be an XQuery Update expression, run in one transaction if the database is transactional
+       n: the number of documents that were changed
+     */
+    c_dbxml_result c_dbxml_update(c_dbxml db, char const *query, char const **namespaces, unsigned long long *n);
+
+    /**** MODIFY ****/
+
+    /* run the XQuery Update expression query with the database as default collection, in one transaction if the database is transactional
+       count: a query for the number of modifications, evaluated before the update, returned in n
+     */
+    c_dbxml_result c_dbxml_modify(c_dbxml db, char const *query, char const *count, char const **namespaces, unsigned long long *n);
 
     /**** READ ****/
 
+    c_dbxml_result c_dbxml_compact(c_dbxml db);
+    c_dbxml_result c_dbxml_truncate(c_dbxml db);
+    c_dbxml_result c_dbxml_backup(c_dbxml db, char const *target);
+    c_dbxml_result c_dbxml_sync(c_dbxml db);
+    /* nosync: 0 = each commit is flushed to the log on disk, 1 = commits are not flushed, for the whole environment
+     */
+    c_dbxml_result c_dbxml_set_durability(c_dbxml db, int nosync);
+    c_dbxml_result c_dbxml_env_sync(c_dbxml_env env);
+    c_dbxml_result c_dbxml_add_index(c_dbxml db, char const *uri, char const *name, char const *index);
+    /* remove all indexes during a bulk load, and restore them afterwards, re-indexing all documents
+     */
+    c_dbxml_result c_dbxml_suspend_indexes(c_dbxml db);
+    c_dbxml_result c_dbxml_resume_indexes(c_dbxml db);
+    c_dbxml_result c_dbxml_has_index(c_dbxml db, char const *uri, char const *name, char const *index, int *has);
+    /* result: uri, name and indexes of each index specification, each followed by '\0'
+     */
+    c_dbxml_result c_dbxml_indexes(c_dbxml db);
+    int c_dbxml_read_only(c_dbxml db);
+    /* values, 14 in total:
+       cache size, cache hits, cache misses, pages read, pages written,
+       lock requests, lock waits, deadlocks, lock timeouts, locks,
+       transactions begun, committed, aborted, active
+     */
+    c_dbxml_result c_dbxml_stats(c_dbxml db, unsigned long long *values);
+    c_dbxml_result c_dbxml_ping(c_dbxml db);
+    /* storage: 1 = node, 2 = wholedoc
+       result: name of the container
+     */
+    c_dbxml_result c_dbxml_info(c_dbxml db, int *storage, int *indexnodes, unsigned int *pagesize, int *transactional, int *validation);
     c_dbxml_result c_dbxml_get(c_dbxml db, char const * name);
+    /* names is terminated by NULL
+       result: for each document found, its index in names and its content, each followed by a null byte
+     */
+    c_dbxml_result c_dbxml_get_many(c_dbxml db, char const **names);
+    /* node by handle from c_dbxml_docs_node_handle(), result is the serialized node
+     */
+    c_dbxml_result c_dbxml_get_node(c_dbxml db, char const *handle);
+
+    /* exists is set to 1 if the document exists, 0 if it doesn't
+     */
+    c_dbxml_result c_dbxml_exists(c_dbxml db, char const *name, int *exists);
 
-    unsigned long long c_dbxml_size(c_dbxml db);
+    c_dbxml_result c_dbxml_size(c_dbxml db, unsigned long long *size);
 
     c_dbxml_docs c_dbxml_get_all(c_dbxml db);
+    /* content, match and value are always empty
+     */
+    c_dbxml_docs c_dbxml_get_all_names(c_dbxml db);
+    /* names only, of documents with names that start with prefix, in order of name
+     */
+    c_dbxml_docs c_dbxml_get_names(c_dbxml db, char const *prefix);
+    /* documents with names that match the pattern, as with fnmatch(3) with FNM_PATHNAME
+     */
+    c_dbxml_docs c_dbxml_get_matching(c_dbxml db, char const *pattern);
     int c_dbxml_get_query_error(c_dbxml_docs docs);
     char const *c_dbxml_get_query_errstring(c_dbxml_docs docs);
     int c_dbxml_docs_next(c_dbxml_docs docs);
+    void c_dbxml_docs_set_page(c_dbxml_docs docs, unsigned long long offset, unsigned long long limit);
     char const * c_dbxml_docs_name(c_dbxml_docs docs);
     char const * c_dbxml_docs_content(c_dbxml_docs docs);
+    /* content in a separate result, to be freed by caller
+     */
+    c_dbxml_result c_dbxml_docs_content_result(c_dbxml_docs docs);
     char const * c_dbxml_docs_match(c_dbxml_docs docs);
+    /* empty if the current item is not a node in a container
+     */
+    char const * c_dbxml_docs_node_handle(c_dbxml_docs docs);
     char const * c_dbxml_docs_value(c_dbxml_docs docs);
+    /* advance up to n times, returns number of steps
+       batch: for each step name and content, or name and match if match == 1, each followed by a nul byte
+       if match == 2: name, content, match, and value, where value is empty if it is a node
+     */
+    int c_dbxml_docs_next_n(c_dbxml_docs docs, int n, int match);
+    char const *c_dbxml_docs_batch(c_dbxml_docs docs);
+    unsigned long long c_dbxml_docs_batch_size(c_dbxml_docs docs);
+    int c_dbxml_docs_metadata(c_dbxml_docs docs);
+    int c_dbxml_docs_eager(c_dbxml_docs docs);
+    /* only for eager results
+     */
+    c_dbxml_result c_dbxml_docs_reset(c_dbxml_docs docs);
+    /* only for eager results
+     */
+    c_dbxml_result c_dbxml_docs_size(c_dbxml_docs docs, unsigned long long *size);
     void c_dbxml_docs_free(c_dbxml_docs docs);
+    /* for queries prepared after this call, 0 = no timeout
+     */
+    void c_dbxml_set_query_timeout(c_dbxml db, unsigned int seconds);
+    void c_dbxml_set_base_uri(c_dbxml db, char const *uri);
+    /* for queries prepared after this call, 0 = document order, 1 = unordered
+     */
+    void c_dbxml_set_unordered(c_dbxml db, int unordered);
+    /* the content of each document that is stored is transformed
+       handle: a Go function, 0 = none
+       query: run with the document as context item, "" = none
+     */
+    void c_dbxml_set_transform(c_dbxml db, unsigned long long handle);
+    c_dbxml_result c_dbxml_set_transform_query(c_dbxml db, char const *query);
+    /* resolve XInclude directives in each document that is stored, before the other transformations
+     */
+    c_dbxml_result c_dbxml_set_xinclude(c_dbxml db, int xinclude);
+    /* remove whitespace text nodes in each document that is stored, after XInclude processing
+     */
+    c_dbxml_result c_dbxml_set_strip_whitespace(c_dbxml db, int strip);
     c_dbxml_query c_dbxml_prepare_query(c_dbxml db, char const *query, int useImplicitCollection, char const **namespaces);
+    /* the query as it is prepared, with the implicit collection and other declarations that are added
+     */
+    c_dbxml_result c_dbxml_query_text(c_dbxml db, char const *query, int useImplicitCollection);
+    /* variables: name and value pairs, terminated by NULL, may be NULL
+       baseURI: "" = the base uri set with c_dbxml_set_base_uri()
+     */
+    c_dbxml_query c_dbxml_prepare_query_context(c_dbxml db, char const *query, int useImplicitCollection, char const **namespaces, char const **variables, char const *baseURI);
     c_dbxml_docs c_dbxml_run_query(c_dbxml_query query);
+    /* run a query with the current result as context item, in the query context of docs
+     */
+    c_dbxml_docs c_dbxml_docs_query(c_dbxml_docs docs, char const *query);
     void c_dbxml_cancel_query(c_dbxml_query query);
+    c_dbxml_result c_dbxml_query_count(c_dbxml_query query, unsigned long long *count);
+    void c_dbxml_query_set_eager(c_dbxml_query query, int eager);
+    void c_dbxml_query_set_isolation(c_dbxml_query query, int isolation);
+    /* what: 0 = string value, 1 = xml document parsed from value, 2 = current item of docs
+     */
+    c_dbxml_result c_dbxml_query_set_variable(c_dbxml_query query, char const *name, int what, char const *value, c_dbxml_docs docs);
+    void c_dbxml_query_set_flags(c_dbxml_query query, int lazydocs, int projection, int wellformed);
+    c_dbxml_result c_dbxml_query_plan(c_dbxml_query query);
     void c_dbxml_query_free(c_dbxml_query query);
     int c_dbxml_get_prepared_error(c_dbxml_query query);
     char const *c_dbxml_get_prepared_errstring(c_dbxml_query query);
 
+    /**** STREAMS ****/
+
+    c_dbxml_stream c_dbxml_get_stream(c_dbxml db, char const *name);
+    c_dbxml_stream c_dbxml_docs_content_stream(c_dbxml_docs docs);
+    int c_dbxml_stream_error(c_dbxml_stream s);
+    char const *c_dbxml_stream_errstring(c_dbxml_stream s);
+    /* returns number of bytes read, 0 at end, -1 on error
+     */
+    long long c_dbxml_stream_read(c_dbxml_stream s, char *buf, unsigned int size);
+    void c_dbxml_stream_free(c_dbxml_stream s);
+
     /**** CHECK ****/
 
+    c_dbxml_result c_dbxml_verify(char const *filename);
+    c_dbxml_result c_dbxml_upgrade(char const *filename);
     c_dbxml_result c_dbxml_check(char const *query, char const **namespaces);
 
     void c_dbxml_version(int *major, int *minor, int *patch);
+    char const *c_dbxml_version_string(void);
+    char const *c_dbxml_db_version_string(void);
+    c_dbxml_result c_dbxml_container_version(c_dbxml db, int *version);
+
+    /**** TRANSACTIONS ****/
+
+    /* isolation: 0 = default, 1 = read committed, 2 = read uncommitted, 3 = snapshot */
+    c_dbxml_txn c_dbxml_txn_begin(c_dbxml db, int isolation);
+    int c_dbxml_txn_error(c_dbxml_txn txn);
+    char const *c_dbxml_txn_errstring(c_dbxml_txn txn);
+    c_dbxml_errinfo c_dbxml_errinfo_txn(c_dbxml_txn txn);
+    c_dbxml_result c_dbxml_txn_commit(c_dbxml_txn txn);
+    c_dbxml_result c_dbxml_txn_abort(c_dbxml_txn txn);
+    void c_dbxml_txn_free(c_dbxml_txn txn);
+    c_dbxml_result c_dbxml_txn_put_xml(c_dbxml_txn txn, char const *name, char const *data, int replace);
+    c_dbxml_result c_dbxml_txn_get(c_dbxml_txn txn, char const *name);
+    /* the results are read in the transaction, and must be freed before the transaction ends
+     */
+    c_dbxml_docs c_dbxml_txn_query(c_dbxml_txn txn, char const *query, char const **namespaces);
+    c_dbxml_docs c_dbxml_txn_get_all(c_dbxml_txn txn);
+    c_dbxml_result c_dbxml_txn_remove(c_dbxml_txn txn, char const *name);
+
+    /* blobs: binary data attached to a document by key
+       op: 0 = get, 1 = put data, 2 = remove, 3 = list the keys, each followed by a nul byte
+       a missing blob is an error with code 12
+     */
+    c_dbxml_result c_dbxml_blob(c_dbxml db, int op, char const *name, char const *key, char const *data, unsigned long long size);
+    c_dbxml_result c_dbxml_txn_blob(c_dbxml_txn txn, int op, char const *name, char const *key, char const *data, unsigned long long size);
+
+    /* raw access to the DbXml objects, for use from other cgo code, see db.RawHandle() and docs.RawHandle()
+       results: DbXml::XmlManager *, DbXml::XmlContainer *, DbXml::XmlResults *, DbXml::XmlValue * for the current result
+     */
+    void *c_dbxml_raw_manager(c_dbxml db);
+    void *c_dbxml_raw_container(c_dbxml db);
+    void *c_dbxml_raw_results(c_dbxml_docs docs);
+    void *c_dbxml_raw_value(c_dbxml_docs docs);
 
 #ifdef __cplusplus
 }
@@ -0,0 +1,58 @@
+package dbxml
+
+//. Imports
+
+/*
+#include "c_dbxml.h"
+*/
+import "C"
+
+//. Conversion
+
+func newError(msg string, info C.c_dbxml_errinfo) error {
+	code := int(info.code)
+	if code == 10 {
+		return &DocumentError{
+			Line:   int(info.line),
+			Column: int(info.column),
+			Msg:    msg,
+		}
+	}
+	if code == 6 || code == 7 || info.line > 0 {
+		return &QueryError{
+			Line:   int(info.line),
+			Column: int(info.column),
+			Msg:    msg,
+			code:   code,
+		}
+	}
+	return &Error{
+		Msg:     msg,
+		code:    code,
+		dberrno: int(info.dberrno),
+	}
+}
+
+func dbError(db C.c_dbxml) error {
+	return newError(C.GoString(C.c_dbxml_errstring(db)), C.c_dbxml_errinfo_db(db))
+}
+
+func resultError(r C.c_dbxml_result) error {
+	return newError(C.GoString(C.c_dbxml_result_string(r)), C.c_dbxml_errinfo_result(r))
+}
+
+func docsError(docs C.c_dbxml_docs) error {
+	return newError(C.GoString(C.c_dbxml_get_query_errstring(docs)), C.c_dbxml_errinfo_docs(docs))
+}
+
+func queryError(query C.c_dbxml_query) error {
+	return newError(C.GoString(C.c_dbxml_get_prepared_errstring(query)), C.c_dbxml_errinfo_query(query))
+}
+
+func envError(env C.c_dbxml_env) error {
+	return newError(C.GoString(C.c_dbxml_env_errstring(env)), C.c_dbxml_errinfo_env(env))
+}
+
+func streamError(s C.c_dbxml_stream) error {
+	return newError(C.GoString(C.c_dbxml_stream_errstring(s)), C.c_dbxml_errinfo_stream(s))
+}
@@ -0,0 +1,170 @@
+// +build cgo
+
+/*
+A command-line tool for inspecting and editing a DbXml database.
+
+Usage:
+
+	dbxml [-r] file.dbxml command [args]
+
+Commands:
+
+	list                  list the names of all documents
+	get name              write a document to stdout
+	put name [file]       store a document from file, or from stdin, replacing an existing document
+	remove name           remove a document
+	query xquery          run a query with the database as default collection, write the matches to stdout
+	size                  show the number of documents
+	indexes               show the index specifications
+*/
+package main
+
+import (
+	"github.com/pebbe/dbxml"
+
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+var (
+	opt_r = flag.Bool("r", false, "open read-only")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `
+Usage: %s [-r] file.dbxml command [args]
+
+Commands:
+
+    list                  list the names of all documents
+    get name              write a document to stdout
+    put name [file]       store a document from file, or from stdin
+    remove name           remove a document
+    query xquery          run a query, write the matches to stdout
+    size                  show the number of documents
+    indexes               show the index specifications
+
+Options:
+
+    -r                    open read-only
+
+`, os.Args[0])
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	filename := flag.Arg(0)
+	cmd := flag.Arg(1)
+	args := flag.Args()[2:]
+
+	nargs := map[string][2]int{
+		"list":    {0, 0},
+		"get":     {1, 1},
+		"put":     {1, 2},
+		"remove":  {1, 1},
+		"query":   {1, 1},
+		"size":    {0, 0},
+		"indexes": {0, 0},
+	}
+	n, ok := nargs[cmd]
+	if !ok {
+		x(fmt.Errorf("Unknown command: %s", cmd))
+	}
+	if len(args) < n[0] || len(args) > n[1] {
+		x(fmt.Errorf("Wrong number of arguments for command %s", cmd))
+	}
+
+	x(run(filename, cmd, args))
+}
+
+func run(filename, cmd string, args []string) (err error) {
+	readonly := *opt_r || cmd != "put" && cmd != "remove"
+	creation := dbxml.MustExist
+	if cmd == "put" {
+		creation = dbxml.Create
+	}
+	db, err := dbxml.OpenWithConfig(filename, dbxml.Config{ReadOnly: readonly, Creation: creation})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := db.CloseErr(); err == nil {
+			err = e
+		}
+	}()
+
+	switch cmd {
+	case "list":
+		docs, err := db.AllNames()
+		if err != nil {
+			return err
+		}
+		for docs.Next() {
+			fmt.Println(docs.Name())
+		}
+		return docs.Error()
+	case "get":
+		_, err := db.GetTo(args[0], os.Stdout)
+		return err
+	case "put":
+		var data []byte
+		if len(args) == 2 {
+			data, err = ioutil.ReadFile(args[1])
+		} else {
+			data, err = ioutil.ReadAll(os.Stdin)
+		}
+		if err != nil {
+			return err
+		}
+		return db.PutXmlBytes(args[0], data, true)
+	case "remove":
+		return db.Remove(args[0])
+	case "query":
+		docs, err := db.Query(args[0])
+		if err != nil {
+			return err
+		}
+		for docs.Next() {
+			if name := docs.Name(); name != "" {
+				fmt.Printf("%s\t%s\n", name, docs.Match())
+			} else {
+				fmt.Println(docs.Value())
+			}
+		}
+		return docs.Error()
+	case "size":
+		size, err := db.Size()
+		if err != nil {
+			return err
+		}
+		fmt.Println(size)
+	case "indexes":
+		specs, err := db.Indexes()
+		if err != nil {
+			return err
+		}
+		for _, spec := range specs {
+			uri := spec.Uri
+			if uri == "" {
+				uri = "-"
+			}
+			fmt.Printf("%s\t%s\t%s\n", uri, spec.Name, spec.Index)
+		}
+	}
+	return nil
+}
+
+func x(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
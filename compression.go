@@ -0,0 +1,111 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"sync"
+	"unsafe"
+)
+
+//. Types
+
+// A compression of documents in a database with WholedocStorage, registered with RegisterCompression().
+//
+// The methods may be called concurrently. They must not panic.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+//. Constants
+
+const (
+	// No compression, for Config.Compression.
+	NoCompression = "none"
+
+	// The default compression of DbXml, using zlib, for Config.Compression.
+	DefaultCompression = "default"
+)
+
+//. Variables
+
+var (
+	compressors    = make(map[string]Compressor)
+	compressorLock sync.RWMutex
+)
+
+//. Register
+
+// Register a compression by name, for use with Config.Compression.
+//
+// The name is stored in a database that is created with this compression. A database that was created
+// with a registered compression can only be read if a compression with the same name is registered before it is opened.
+//
+// Example, with github.com/klauspost/compress/zstd:
+//
+//      type zstdCompressor struct {
+//          enc *zstd.Encoder
+//          dec *zstd.Decoder
+//      }
+//
+//      func (z zstdCompressor) Compress(b []byte) ([]byte, error)   { return z.enc.EncodeAll(b, nil), nil }
+//      func (z zstdCompressor) Decompress(b []byte) ([]byte, error) { return z.dec.DecodeAll(b, nil) }
+//
+//      enc, _ := zstd.NewWriter(nil)
+//      dec, _ := zstd.NewReader(nil)
+//      dbxml.RegisterCompression("zstd", zstdCompressor{enc, dec})
+//      db, err := dbxml.OpenWithConfig("corpus.dbxml", dbxml.Config{Storage: dbxml.WholedocStorage, Compression: "zstd"})
+func RegisterCompression(name string, c Compressor) error {
+	if name == "" || name == NoCompression || name == DefaultCompression {
+		return errors.New("Invalid compression name: " + name)
+	}
+	if c == nil {
+		return errors.New("Compressor is nil")
+	}
+
+	// Wait for databases that are being opened
+	lock.Lock()
+	defer lock.Unlock()
+
+	compressorLock.Lock()
+	compressors[name] = c
+	compressorLock.Unlock()
+
+	cs := C.CString(name)
+	defer C.free(unsafe.Pointer(cs))
+	C.c_dbxml_register_compression(cs)
+	return nil
+}
+
+//. Callbacks
+
+// Returns 1 on success, 0 on failure. Result memory is freed by the caller.
+//
+//export goCompress
+func goCompress(name *C.char, decompress C.int, data *C.char, size C.ulonglong, result **C.char, resultsize *C.ulonglong) C.int {
+	compressorLock.RLock()
+	c := compressors[C.GoString(name)]
+	compressorLock.RUnlock()
+	if c == nil {
+		return 0
+	}
+	b := C.GoBytes(unsafe.Pointer(data), C.int(size))
+	var out []byte
+	var err error
+	if decompress != 0 {
+		out, err = c.Decompress(b)
+	} else {
+		out, err = c.Compress(b)
+	}
+	if err != nil {
+		return 0
+	}
+	return setFunctionResult(out, result, resultsize, 1)
+}
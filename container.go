@@ -0,0 +1,309 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"os"
+	"unsafe"
+)
+
+//. Types
+
+// Statistics returned by db.Compact().
+type CompactStats struct {
+	SizeBefore int64 // The size of the database file in bytes before compaction, or 0 if unknown
+	SizeAfter  int64 // The size of the database file in bytes after compaction, or 0 if unknown
+}
+
+// Properties of a database, as returned by db.Info().
+type ContainerInfo struct {
+	Name          string
+	Storage       Storage // NodeStorage or WholedocStorage
+	IndexNodes    bool    // Indexes refer to nodes instead of documents
+	PageSize      int     // The page size of the database file in bytes
+	Documents     uint64  // The number of documents
+	Version       int     // The format version of the database file
+	ReadOnly      bool
+	Transactional bool
+	Validation    bool // Documents are validated against a schema or DTD when they are put into the database
+	Indexes       []IndexSpec
+}
+
+// Runtime statistics, as returned by db.Stats().
+//
+// All values except Documents and FileSize are for the Berkeley DB environment of the database,
+// which may be shared with other databases. Counters are cumulative since the environment was opened.
+// Lock and transaction statistics are 0 if the environment doesn't use locking or transactions.
+type Stats struct {
+	CacheSize    uint64 // Size of the cache in bytes
+	CacheHits    uint64 // Pages found in the cache
+	CacheMisses  uint64 // Pages not found in the cache
+	PagesRead    uint64 // Pages read into the cache
+	PagesWritten uint64 // Pages written from the cache
+
+	LockRequests uint64
+	LockWaits    uint64 // Lock requests that had to wait
+	Deadlocks    uint64
+	LockTimeouts uint64
+	Locks        uint64 // Locks currently held
+
+	TxnBegins  uint64
+	TxnCommits uint64
+	TxnAborts  uint64
+	TxnActive  uint64 // Transactions currently active
+
+	Documents uint64 // Number of documents in the database
+	FileSize  int64  // Size of the database file in bytes, 0 if unknown
+}
+
+//. Info
+
+// Get the properties of the database.
+//
+// Example:
+//
+//      info, err := db.Info()
+//      if err == nil && info.Storage != dbxml.NodeStorage {
+//          log.Printf("%s: not using node storage", info.Name)
+//      }
+func (db *Db) Info() (ContainerInfo, error) {
+	var info ContainerInfo
+	err := db.info(&info)
+	if err != nil {
+		return info, err
+	}
+	if info.Documents, err = db.Size(); err != nil {
+		return info, err
+	}
+	if info.Version, err = db.ContainerVersion(); err != nil {
+		return info, err
+	}
+	if info.Indexes, err = db.Indexes(); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+// Get runtime statistics of the database and its environment.
+//
+// Example, the cache hit rate:
+//
+//      st, err := db.Stats()
+//      if err == nil && st.CacheHits+st.CacheMisses > 0 {
+//          fmt.Printf("%.1f%%\n", 100*float64(st.CacheHits)/float64(st.CacheHits+st.CacheMisses))
+//      }
+func (db *Db) Stats() (Stats, error) {
+	var st Stats
+	err := db.stats(&st)
+	if err != nil {
+		return st, err
+	}
+	if st.Documents, err = db.Size(); err != nil {
+		return st, err
+	}
+	return st, nil
+}
+
+func (db *Db) stats(st *Stats) error {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	var v [14]C.ulonglong
+	r := C.c_dbxml_stats(db.db, &v[0])
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	st.CacheSize = uint64(v[0])
+	st.CacheHits = uint64(v[1])
+	st.CacheMisses = uint64(v[2])
+	st.PagesRead = uint64(v[3])
+	st.PagesWritten = uint64(v[4])
+	st.LockRequests = uint64(v[5])
+	st.LockWaits = uint64(v[6])
+	st.Deadlocks = uint64(v[7])
+	st.LockTimeouts = uint64(v[8])
+	st.Locks = uint64(v[9])
+	st.TxnBegins = uint64(v[10])
+	st.TxnCommits = uint64(v[11])
+	st.TxnAborts = uint64(v[12])
+	st.TxnActive = uint64(v[13])
+	st.FileSize = fileSize(db.path)
+	return nil
+}
+
+// Check that the database is usable, with a small read from the database file.
+//
+// This returns an error if the database is closed, if the database file was removed, or if
+// Berkeley DB reports a failure, such as an environment that needs recovery.
+func (db *Db) Ping() error {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	if _, err := os.Stat(db.path); err != nil {
+		return err
+	}
+	r := C.c_dbxml_ping(db.db)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
+
+func (db *Db) info(info *ContainerInfo) error {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	var storage, indexnodes, transactional, validation C.int
+	var pagesize C.uint
+	r := C.c_dbxml_info(db.db, &storage, &indexnodes, &pagesize, &transactional, &validation)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	info.Name = C.GoString(C.c_dbxml_result_string(r))
+	info.Storage = Storage(storage)
+	info.IndexNodes = indexnodes != 0
+	info.PageSize = int(pagesize)
+	info.ReadOnly = C.c_dbxml_read_only(db.db) != 0
+	info.Transactional = transactional != 0
+	info.Validation = validation != 0
+	return nil
+}
+
+//. Maintenance
+
+// Verify the integrity of a database file.
+//
+// The database must not be open.
+func Verify(filename string) error {
+	cs := C.CString(filename)
+	defer C.free(unsafe.Pointer(cs))
+	r := C.c_dbxml_verify(cs)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
+
+// Upgrade a database file that was created with an older version of DbXml to the current format.
+//
+// The database must not be open. Make a backup first: the upgrade can't be undone.
+func Upgrade(filename string) error {
+	cs := C.CString(filename)
+	defer C.free(unsafe.Pointer(cs))
+	r := C.c_dbxml_upgrade(cs)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
+
+// Compact the database, returning free pages to the file system.
+//
+// The database is closed and opened again. All queries prepared on the database are closed.
+// This fails if there are results of queries on the database that are not closed yet.
+func (db *Db) Compact() (CompactStats, error) {
+	var stats CompactStats
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return stats, errclosed
+	}
+	db.closeQueries()
+	stats.SizeBefore = fileSize(db.path)
+	r := C.c_dbxml_compact(db.db)
+	defer C.c_dbxml_result_free(r)
+	stats.SizeAfter = fileSize(db.path)
+	if C.c_dbxml_result_error(r) != 0 {
+		return stats, resultError(r)
+	}
+	return stats, nil
+}
+
+// Remove all documents from the database.
+//
+// This is much faster than removing documents one by one. Indexes are kept.
+//
+// The database is closed and opened again. All queries prepared on the database are closed.
+// This fails if there are results of queries on the database that are not closed yet.
+func (db *Db) Truncate() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	db.closeQueries()
+	r := C.c_dbxml_truncate(db.db)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	db.notify(ChangeEvent{Kind: ChangeMany})
+	return nil
+}
+
+// Flush all write operations on the database to disk, without closing it.
+func (db *Db) Sync() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	r := C.c_dbxml_sync(db.db)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
+
+// Make a copy of the database file in the directory destDir, while the database is open.
+//
+// The directory must exist. Write operations on the database wait until the backup is finished.
+// In an environment, writers in other processes can continue while the backup is made.
+func (db *Db) Backup(destDir string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	cs := C.CString(destDir)
+	defer C.free(unsafe.Pointer(cs))
+	r := C.c_dbxml_backup(db.db, cs)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
+
+func fileSize(filename string) int64 {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
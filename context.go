@@ -0,0 +1,110 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"context"
+)
+
+//. Context
+
+// Get all xml documents that match the XPATH query from the database.
+//
+// The query is interrupted when the context is cancelled or its deadline passes.
+// After that, docs.Next() returns false, and docs.Error() returns the error of the context.
+//
+// See: db.Query()
+func (db *Db) QueryContext(ctx context.Context, query string, namespaces ...Namespace) (*Docs, error) {
+	q, err := db.Prepare(query, namespaces...)
+	if err != nil {
+		return &Docs{}, err
+	}
+	docs, err := q.RunContext(ctx)
+	if err != nil {
+		q.Close()
+		return docs, err
+	}
+	stop := docs.cleanup
+	docs.cleanup = func() {
+		stop()
+		q.Close()
+	}
+	return docs, nil
+}
+
+// Run a prepared query, that is interrupted when the context is cancelled or its deadline passes.
+//
+// Note that this interrupts all running instances of the prepared query.
+func (query *Query) RunContext(ctx context.Context) (*Docs, error) {
+	if err := ctx.Err(); err != nil {
+		return &Docs{}, err
+	}
+	docs, err := query.Run()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return docs, err
+	}
+	done := make(chan bool)
+	go func() {
+		select {
+		case <-ctx.Done():
+			query.Cancel()
+		case <-done:
+		}
+	}()
+	docs.ctx = ctx
+	docs.cleanup = func() {
+		close(done)
+	}
+	return docs, nil
+}
+
+//. Channels
+
+// Get all xml documents that match the XPATH query from the database, as a channel.
+//
+// The query runs in a separate goroutine. When the context is cancelled, the query is interrupted,
+// and the error channel receives the error of the context.
+//
+// Both channels are closed when the query has finished. The error channel receives at most one error.
+//
+// Example:
+//
+//      docs, errs := db.QueryChan(ctx, xpath_query)
+//      for doc := range docs {
+//          fmt.Println(doc.Name, doc.Content)
+//      }
+//      if err := <-errs; err != nil {
+//          fmt.Println(err)
+//      }
+func (db *Db) QueryChan(ctx context.Context, query string, namespaces ...Namespace) (<-chan Document, <-chan error) {
+	docc := make(chan Document)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(docc)
+
+		docs, err := db.QueryContext(ctx, query, namespaces...)
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer docs.Close()
+		for docs.Next() {
+			select {
+			case docc <- Document{Name: docs.Name(), Content: docs.Content()}:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+		if err := docs.Error(); err != nil {
+			errc <- err
+		}
+	}()
+	return docc, errc
+}
@@ -0,0 +1,64 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+//. Types
+
+// A buffer for a nul-terminated string in Go memory, see cstring().
+type cbuf struct {
+	b []byte
+}
+
+//. Variables
+
+var (
+	cbufs = sync.Pool{
+		New: func() interface{} {
+			return &cbuf{b: make([]byte, 0, 256)}
+		},
+	}
+
+	// Buffers that grew larger than this are not reused
+	cbufMax = 4096
+
+	emptyCString = [1]C.char{0}
+)
+
+//. C strings
+
+// Get a nul-terminated copy of s in a reused Go buffer, for passing to a C function without malloc() and free().
+//
+// The C function must not keep the pointer after it returns, and the pointer must not be stored in Go memory
+// that is passed to C, such as an array of strings. Call buf.free() after the call.
+func cstring(s string) (*C.char, *cbuf) {
+	buf := cbufs.Get().(*cbuf)
+	buf.b = append(append(buf.b[:0], s...), 0)
+	return (*C.char)(unsafe.Pointer(&buf.b[0])), buf
+}
+
+func (buf *cbuf) free() {
+	if cap(buf.b) <= cbufMax {
+		cbufs.Put(buf)
+	}
+}
+
+// Get a pointer to the bytes of s, without a copy, for a C function that takes a pointer and a size.
+//
+// The C function must not modify the bytes, or keep the pointer after it returns.
+func stringData(s string) *C.char {
+	if len(s) == 0 {
+		return &emptyCString[0]
+	}
+	return (*C.char)(unsafe.Pointer((*reflect.StringHeader)(unsafe.Pointer(&s)).Data))
+}
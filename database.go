@@ -0,0 +1,55 @@
+package dbxml
+
+//. Types
+
+// The basic operations on a database, implemented by AsDatabase() for a *Db, by NewMemory(), and by ShardedDb.
+//
+// Code that only uses this interface can be tested with the in-memory database, which doesn't
+// need DbXml or cgo.
+type Database interface {
+	// Put an xml document into the database.
+	PutXml(name string, data string, replace bool) error
+
+	// Get an xml document by name.
+	Get(name string) (string, error)
+
+	// Remove an xml document.
+	Remove(name string) error
+
+	// Get the number of xml documents.
+	Size() (uint64, error)
+
+	// Get all xml documents.
+	All() (Documents, error)
+
+	// Run an XPATH query on the database.
+	Query(query string, namespaces ...Namespace) (Documents, error)
+
+	// Close the database.
+	Close() error
+}
+
+// An iterator over xml documents or query results, as returned by a Database.
+//
+// This is implemented by *Docs.
+type Documents interface {
+	Next() bool
+	Name() string
+	Content() string
+	Match() string
+	Value() string
+	Error() error
+	Close()
+}
+
+// An xml document, by name and content.
+type Document struct {
+	Name    string
+	Content string
+}
+
+// Namespaces for queries
+type Namespace struct {
+	Prefix string
+	Uri    string
+}
@@ -0,0 +1,61 @@
+// +build cgo
+
+package dbxml
+
+//. Types
+
+type database struct {
+	db *Db
+}
+
+//. Database
+
+// Open a database as a Database, like Open().
+func OpenDatabase(filename string) (Database, error) {
+	db, err := Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	return AsDatabase(db), nil
+}
+
+// Use an open database as a Database.
+func AsDatabase(db *Db) Database {
+	return database{db: db}
+}
+
+func (d database) PutXml(name string, data string, replace bool) error {
+	return d.db.PutXml(name, data, replace)
+}
+
+func (d database) Get(name string) (string, error) {
+	return d.db.Get(name)
+}
+
+func (d database) Remove(name string) error {
+	return d.db.Remove(name)
+}
+
+func (d database) Size() (uint64, error) {
+	return d.db.Size()
+}
+
+func (d database) All() (Documents, error) {
+	docs, err := d.db.All()
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+func (d database) Query(query string, namespaces ...Namespace) (Documents, error) {
+	docs, err := d.db.Query(query, namespaces...)
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+func (d database) Close() error {
+	return d.db.CloseErr()
+}
@@ -0,0 +1,18 @@
+// +build !cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"errors"
+)
+
+//. Database
+
+// Open a database as a Database.
+//
+// This package was built without cgo, so this always fails. Use NewMemory() instead.
+func OpenDatabase(filename string) (Database, error) {
+	return nil, errors.New("dbxml: built without cgo, DbXml is not available")
+}
@@ -8,62 +8,254 @@ package dbxml
 //. Imports
 
 /*
-#cgo LDFLAGS: -ldbxml
+#cgo LDFLAGS: -ldbxml -ldb
 #include <stdlib.h>
 #include "c_dbxml.h"
 */
 import "C"
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"os"
+	"path"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
 //. Types
 
 // A database connection.
+//
+// Read operations, such as db.Get(), db.Query() and db.All(), can run concurrently.
+// Write operations wait for all other operations to finish, and block them while running.
 type Db struct {
-	opened  bool
-	db      C.c_dbxml
-	lock    sync.Mutex
-	queries map[uint64]*Query
-	counter uint64
+	opened      bool
+	db          C.c_dbxml
+	lock        sync.RWMutex
+	qlock       sync.Mutex
+	queries     map[uint64]*Query
+	counter     uint64
+	txns        map[uint64]*Txn
+	env         *Env
+	id          uint64
+	output      Serialization
+	path        string
+	wlock       sync.Mutex
+	watchers    map[<-chan ChangeEvent]*watcher
+	slock       sync.Mutex
+	tempDir     string
+	jsonOptions JSONOptions
+	observer    atomic.Value
+	flags       QueryFlags
+	dlock       sync.Mutex
+	active      map[uint64]activeDocs
+	dcounter    uint64
+	detectLeaks bool
+	leaks       []Leak
+	transform   uint64
+}
+
+// A query result, by document name and matched subtree, as returned by docs.NextHits().
+type Hit struct {
+	Name  string
+	Match string
+}
+
+// The result of db.PutFiles().
+type PutReport struct {
+	Put    int         // The number of files that were put into the database
+	Failed []FileError // The files that failed, in the order they were given
+}
+
+// A file that could not be put into the database by db.PutFiles().
+type FileError struct {
+	Filename string
+	Err      error
 }
 
 // An iterator over xml documents in the database.
 type Docs struct {
-	started bool
-	opened  bool
-	docs    C.c_dbxml_docs
-	lock    sync.Mutex
-	err     error
+	started  bool
+	opened   bool
+	docs     C.c_dbxml_docs
+	lock     sync.Mutex
+	err      error
+	ctx      context.Context
+	cleanup  func()
+	output   Serialization
+	observer Observer
+	db       *Db
+	id       uint64
+	prefetch chan [][]string
+	pstop    chan struct{}
+	pending  [][]string
+	current  []string
+	text     string
+	limits   limits
 }
 
 // A prepared query that can be run multiple times and interrupted while running.
 type Query struct {
 	db     *Db
+	env    *Env
 	id     uint64
 	opened bool
 	query  C.c_dbxml_query
 	lock   sync.Mutex
+	output Serialization
+	text   string
+	limits limits
 }
 
-// Namespaces for queries
-type Namespace struct {
-	Prefix string
-	Uri    string
+// Options for opening a database with OpenWithConfig().
+type Config struct {
+	// Open the database in read-only mode, as with OpenRead().
+	ReadOnly bool
+
+	// What to do if the database does or doesn't exist.
+	Creation Creation
+
+	// The storage model. This is only used when a new database is created.
+	Storage Storage
+
+	// Allow validation of documents against a schema or DTD when they are put into the database.
+	//
+	// A document that refers to a schema or DTD and is not valid is rejected with a *DocumentError.
+	AllowValidation bool
+
+	// Set the metadata "created" and "modified" in the namespace DCTermsURI when a document is put, replaced or merged,
+	// as UTC time in the format "2006-01-02T15:04:05Z". When a document is replaced, "created" is kept.
+	// Changes made with an XQuery Update expression, by db.Update() or db.ApplyModify(), don't change the timestamps.
+	//
+	// Example, documents that changed since a given time:
+	//
+	//      docs, err := db.Query(`/*[dbxml:metadata("dc:modified") >= "2026-10-01T00:00:00Z"]`,
+	//          dbxml.Namespace{Prefix: "dc", Uri: dbxml.DCTermsURI})
+	Timestamps bool
+
+	// The compression of documents in a database with WholedocStorage. This is only used when a new database is created.
+	//
+	// This is NoCompression, DefaultCompression, or the name of a compression registered with RegisterCompression().
+	// If empty, the default of DbXml is used.
+	Compression string
+
+	// The size of the cache in bytes. If 0, the default of Berkeley DB is used.
+	//
+	// This is not used for a database in an environment. Use EnvConfig.CacheSize instead.
+	CacheSize uint64
+
+	// The page size of the database file in bytes, a power of 2 from 512 to 65536. If 0, the default of DbXml is used.
+	// This is only used when a new database is created.
+	//
+	// Larger pages can reduce I/O for large databases with NodeStorage.
+	PageSize int
+
+	// Encrypt the database with AES, using this password. If empty, there is no encryption.
+	// A new database is created encrypted. An existing encrypted database can only be opened with the password it was created with.
+	//
+	// This is not used for a database in an environment. Use EnvConfig.Password instead.
+	Password string
 }
 
+// How to deal with a database that does or doesn't exist yet.
+type Creation int
+
+const (
+	// Create the database if it doesn't exist.
+	Create Creation = iota
+
+	// Create the database, fail if it already exists.
+	Excl
+
+	// Fail if the database doesn't exist, instead of creating an empty database.
+	MustExist
+)
+
+// The storage model of a database.
+type Storage int
+
+const (
+	// Use the default storage model of DbXml.
+	DefaultStorage Storage = iota
+
+	// Store documents as individual nodes. This is faster for queries, and for retrieving fragments of documents.
+	NodeStorage
+
+	// Store documents as whole documents. This is faster for retrieving complete documents.
+	WholedocStorage
+)
+
+// Flags for running a query, set with query.SetFlags().
+type QueryFlags int
+
+const (
+	// Retrieve the content of documents only when it is needed.
+	LazyDocs QueryFlags = 1 << iota
+
+	// Load only the parts of documents that are needed to answer the query.
+	// This is only useful for databases with WholedocStorage. It saves reading and parsing the whole document
+	// for queries that only need a small part of it, such as one attribute. Use it for queries that return
+	// values, such as attribute values or counts, rather than nodes that are serialized with docs.Match().
+	DocumentProjection
+
+	// Parse documents with a faster parser that only checks well-formedness, ignoring any DTD or schema.
+	WellFormedOnly
+
+	// The flags that are used unless query.SetFlags() is called.
+	DefaultQueryFlags = LazyDocs | WellFormedOnly
+)
+
+// How the results of a query are evaluated.
+type Evaluation int
+
+const (
+	// Evaluate results one at a time, while iterating. Memory use stays flat. This is the default.
+	Lazy Evaluation = iota
+
+	// Evaluate all results when the query is run. This uses more memory, but results can be reset and counted.
+	Eager
+)
+
+// The order of the results of a query, set with db.SetOrdering().
+type Ordering int
+
+const (
+	// Return results in document order: documents in the order of their names, and matches
+	// within a document in the order in which they appear. This is the default.
+	DocumentOrder Ordering = iota
+
+	// Return results in any order. DbXml is free to return matches in index order, without sorting them first.
+	// This can be much faster when only some of the results are needed, as with db.QueryPaged().
+	// Which results are skipped or returned by a limit is not defined.
+	Unordered
+)
+
+//. Constants
+
+const (
+	// The namespace of the metadata set with Config.Timestamps.
+	DCTermsURI = "http://purl.org/dc/terms/"
+)
+
 //. Variables
 
 var (
-	errclosed      = errors.New("Database is closed")
+	errclosed      = ErrContainerClosed
 	errqueryclosed = errors.New("Query is closed")
+	errdocsclosed  = errors.New("Iterator is closed")
+	errnocurrent   = errors.New("No current result")
+	errprefetch    = errors.New("Iterator is prefetching")
 	errempty       = errors.New("Query is empty")
 	errbrackets    = errors.New("Query starts with '('")
+	errexcl        = errors.New("Exclusive creation of database in read-only mode")
 	lock           sync.Mutex
 )
 
@@ -73,37 +265,114 @@ var (
 //
 // Attempt to open the database in read+write mode. If that fails, open in read-only mode.
 //
+// If the database doesn't exist, an empty database is created.
+// Use OpenWithConfig() with config.Creation set to MustExist to prevent this.
+//
 // Call db.Close() to ensure all write operations to the database are finished, before terminating the program.
+//
+// A database opened this way has no locking between processes. It must not be opened by another process
+// at the same time, unless all processes only read. To share a database between processes, open it in an
+// environment with EnvConfig.MultiProcess in each process.
 func Open(filename string) (*Db, error) {
-	return open(filename, 1, 1)
+	return open(nil, filename, 1, 1, Config{})
 }
 
 // Open a database in read-only mode.
+//
+// Several processes can safely open the same database in read-only mode at the same time.
+// All write operations on the returned database fail.
 func OpenRead(filename string) (*Db, error) {
-	return open(filename, 0, 1)
+	return open(nil, filename, 0, 1, Config{Creation: MustExist})
 }
 
 // Open a database in read+write mode.
 //
 // Call db.Close() to ensure all write operations to the database are finished, before terminating the program.
 func OpenReadWrite(filename string) (*Db, error) {
-	return open(filename, 1, 0)
+	return open(nil, filename, 1, 0, Config{})
+}
+
+// Open a database with options.
+//
+// Like Open(), attempt to open the database in read+write mode. If that fails, open in read-only mode.
+// If config.ReadOnly is true, open in read-only mode only.
+// If config.Creation is Excl, there is no fallback to read-only mode.
+//
+// Call db.Close() to ensure all write operations to the database are finished, before terminating the program.
+func OpenWithConfig(filename string, config Config) (*Db, error) {
+	return openWithConfig(nil, filename, config)
+}
+
+// Open a new, empty database in a temporary directory, for scratch processing.
+//
+// The database is stored in a file rather than in memory, so its size is not limited by the cache.
+// The database and its directory are removed when the database is closed.
+// If the program terminates without closing the database, they are left in the directory for temporary files.
+func OpenTemp() (*Db, error) {
+	dir, err := os.MkdirTemp("", "dbxml")
+	if err != nil {
+		return &Db{}, err
+	}
+	db, err := open(nil, filepath.Join(dir, "temp.dbxml"), 1, 0, Config{Creation: Excl})
+	if err != nil {
+		os.RemoveAll(dir)
+		return db, err
+	}
+	db.tempDir = dir
+	return db, nil
+}
+
+func openWithConfig(env *Env, filename string, config Config) (*Db, error) {
+	if config.ReadOnly {
+		if config.Creation == Excl {
+			return &Db{}, errexcl
+		}
+		return open(env, filename, 0, 1, config)
+	}
+	if config.Creation == Excl {
+		return open(env, filename, 1, 0, config)
+	}
+	return open(env, filename, 1, 1, config)
 }
 
-func open(filename string, readwrite, read int) (*Db, error) {
+func open(env *Env, filename string, readwrite, read int, config Config) (*Db, error) {
 	lock.Lock()
 	defer lock.Unlock()
 	db := &Db{
 		queries: make(map[uint64]*Query),
+		txns:    make(map[uint64]*Txn),
+		path:    filename,
+		flags:   DefaultQueryFlags,
+		active:  make(map[uint64]activeDocs),
+	}
+	if env != nil {
+		db.path = env.dataPath(filename)
 	}
 	cs := C.CString(filename)
 	defer C.free(unsafe.Pointer(cs))
-	db.db = C.c_dbxml_open(cs, C.int(readwrite), C.int(read))
+	cscomp := C.CString(config.Compression)
+	defer C.free(unsafe.Pointer(cscomp))
+	cspw, pwfree := passwordCString(config.Password)
+	defer pwfree()
+	validate := C.int(0)
+	if config.AllowValidation {
+		validate = 1
+	}
+	if env == nil {
+		db.db = C.c_dbxml_open(cs, C.int(readwrite), C.int(read), C.int(config.Creation), C.int(config.Storage), validate, cscomp,
+			C.ulonglong(config.CacheSize), C.uint(config.PageSize), cspw)
+	} else {
+		db.db = C.c_dbxml_env_open_container(env.env, cs, C.int(readwrite), C.int(read), C.int(config.Creation), C.int(config.Storage), validate, cscomp,
+			C.uint(config.PageSize))
+	}
 	if C.c_dbxml_error(db.db) != 0 {
-		err := errors.New(C.GoString(C.c_dbxml_errstring(db.db)))
+		err := dbError(db.db)
 		C.c_dbxml_free(db.db)
 		return db, err
 	}
+	if config.Timestamps {
+		C.c_dbxml_set_timestamps(db.db, 1)
+	}
 	db.opened = true
 	runtime.SetFinalizer(db, (*Db).Close)
 	return db, nil
@@ -113,29 +382,103 @@ func open(filename string, readwrite, read int) (*Db, error) {
 //
 // This flushes all write operations to the database.
 //
-// This is called automaticly on garbage collection.
+// This is called automaticly on garbage collection, except for a database opened in an environment,
+// which stays open until the environment is closed.
 // Note that teminating the program does not call the garbage collector.
+//
+// Use db.CloseErr() to find out if flushing the database failed.
 func (db *Db) Close() {
+	db.CloseErr()
+}
+
+// Close the database, like db.Close(), and return an error if flushing the write operations failed.
+//
+// Closing a database that is already closed is not an error.
+func (db *Db) CloseErr() error {
+	// Lock order: environment, database, query
+	db.lock.RLock()
+	env := db.env
+	db.lock.RUnlock()
+	if env != nil {
+		env.lock.Lock()
+		defer env.lock.Unlock()
+	}
+	return db.close()
+}
+
+func (db *Db) close() error {
 	db.lock.Lock()
 	defer db.lock.Unlock()
-	if db.opened {
-		// Collect all the keys before starting to close, because closing will change the hash
-		keys := make([]uint64, 0, len(db.queries))
-		for key := range db.queries {
-			keys = append(keys, key)
-		}
-		for _, key := range keys {
-			db.queries[key].Close()
+	if !db.opened {
+		return nil
+	}
+	db.abortTxns()
+	db.closeQueries()
+	db.closeWatchers()
+	r := C.c_dbxml_close(db.db)
+	defer C.c_dbxml_result_free(r)
+	db.opened = false
+	if db.transform != 0 {
+		freeHandle(db.transform)
+		db.transform = 0
+	}
+	if db.env != nil {
+		delete(db.env.dbs, db.id)
+		db.env = nil
+	}
+	if C.c_dbxml_result_error(r) != 0 {
+		if db.tempDir != "" {
+			os.RemoveAll(db.tempDir)
 		}
-		C.c_dbxml_free(db.db)
-		db.opened = false
+		return resultError(r)
+	}
+	if db.tempDir != "" {
+		return os.RemoveAll(db.tempDir)
+	}
+	return nil
+}
+
+// Close all queries prepared on the database. The caller must hold the write lock.
+func (db *Db) closeQueries() {
+	// Collect all the keys before starting to close, because closing will change the hash
+	keys := make([]uint64, 0, len(db.queries))
+	for key := range db.queries {
+		keys = append(keys, key)
 	}
+	for _, key := range keys {
+		db.queries[key].close()
+	}
+}
+
+// Add an alias for the database.
+//
+// Queries prepared with db.PrepareRaw(), db.QueryRaw(), or in the environment of the database,
+// can refer to the database as collection('alias'), independent of its filename.
+func (db *Db) SetAlias(alias string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+
+	cs := C.CString(alias)
+	defer C.free(unsafe.Pointer(cs))
+	r := C.c_dbxml_add_alias(db.db, cs)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
 }
 
 //. Write
 
 // Put an xml file from disc into the database.
-func (db *Db) PutFile(filename string, replace bool) error {
+//
+// The name of the document is the filename, as given. Use db.PutFileNamed() for another name.
+func (db *Db) PutFile(filename string, replace bool) (err error) {
+	defer db.observe(OpPut, time.Now(), &err)
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -152,13 +495,151 @@ func (db *Db) PutFile(filename string, replace bool) error {
 	r := C.c_dbxml_put_file(db.db, cs, repl)
 	defer C.c_dbxml_result_free(r)
 	if C.c_dbxml_result_error(r) != 0 {
-		return errors.New(C.GoString(C.c_dbxml_result_string(r)))
+		return resultError(r)
+	}
+	db.notify(ChangeEvent{Kind: ChangePut, Name: filename})
+	return nil
+}
+
+// Put an xml file from disc into the database, as a document with the given name.
+//
+// If name is empty, the name is the filename, as given, like with db.PutFile(). Returns the name of the document.
+//
+// Example:
+//
+//      name, err := db.PutFileNamed(path, filepath.Base(path), false)
+func (db *Db) PutFileNamed(filename, name string, replace bool) (docname string, err error) {
+	defer db.observe(OpPut, time.Now(), &err)
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return "", errclosed
+	}
+
+	csfile := C.CString(filename)
+	defer C.free(unsafe.Pointer(csfile))
+	csname, buf := cstring(name)
+	defer buf.free()
+	repl := C.int(0)
+	if replace {
+		repl = 1
+	}
+	r := C.c_dbxml_put_file_named(db.db, csfile, csname, repl)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return "", resultError(r)
+	}
+	docname = C.GoString(C.c_dbxml_result_string(r))
+	db.notify(ChangeEvent{Kind: ChangePut, Name: docname})
+	return docname, nil
+}
+
+// Put xml documents from disc into the database, like db.PutFile(), with a single call into DbXml.
+//
+// In a transactional environment, all files are put in one transaction. A file that fails, for instance because
+// it is not well-formed or it exists and replace is false, is reported in PutReport.Failed, and the other files
+// are still put. If the transaction itself fails, for instance because of a deadlock, no files are put and an error is returned.
+//
+// Example:
+//
+//      filenames, _ := filepath.Glob("corpus/*.xml")
+//      report, err := db.PutFiles(filenames, false)
+//      if err == nil {
+//          for _, f := range report.Failed {
+//              fmt.Println(f.Filename, f.Err)
+//          }
+//      }
+func (db *Db) PutFiles(filenames []string, replace bool) (report PutReport, err error) {
+	defer db.observe(OpPut, time.Now(), &err)
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return report, errclosed
+	}
+
+	cs := make([]*C.char, len(filenames)+1)
+	for i, filename := range filenames {
+		cs[i] = C.CString(filename)
+	}
+	defer func() {
+		for i := range filenames {
+			C.free(unsafe.Pointer(cs[i]))
+		}
+	}()
+	repl := C.int(0)
+	if replace {
+		repl = 1
+	}
+	r := C.c_dbxml_put_files(db.db, &cs[0], repl)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return report, resultError(r)
+	}
+
+	failed := make(map[int]bool)
+	b := C.GoBytes(unsafe.Pointer(C.c_dbxml_result_string(r)), C.int(C.c_dbxml_result_size(r)))
+	for len(b) > 0 {
+		var item [6]string
+		for j := range item {
+			p := bytes.IndexByte(b, 0)
+			item[j] = string(b[:p])
+			b = b[p+1:]
+		}
+		var n [5]int
+		for j := range n {
+			n[j], _ = strconv.Atoi(item[j])
+		}
+		info := C.c_dbxml_errinfo{code: C.int(n[1]), line: C.int(n[2]), column: C.int(n[3]), dberrno: C.int(n[4])}
+		report.Failed = append(report.Failed, FileError{Filename: filenames[n[0]], Err: newError(item[5], info)})
+		failed[n[0]] = true
+	}
+
+	events := make([]ChangeEvent, 0, len(filenames))
+	for i, filename := range filenames {
+		if !failed[i] {
+			events = append(events, ChangeEvent{Kind: ChangePut, Name: filename})
+		}
+	}
+	report.Put = len(events)
+	db.notify(events...)
+	return report, nil
+}
+
+// Put an xml document from memory into the database.
+//
+// When this returns, the document is visible to all reads of the database. See: db.SetDurability()
+func (db *Db) PutXml(name string, data string, replace bool) (err error) {
+	defer db.observe(OpPut, time.Now(), &err)
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+
+	csname, buf := cstring(name)
+	defer buf.free()
+	repl := C.int(0)
+	if replace {
+		repl = 1
+	}
+	// The data is passed without a copy
+	r := C.c_dbxml_put_xml_bytes(db.db, csname, stringData(data), C.ulonglong(len(data)), repl)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
 	}
+	db.notify(ChangeEvent{Kind: ChangePut, Name: name})
 	return nil
 }
 
 // Put an xml document from memory into the database.
-func (db *Db) PutXml(name string, data string, replace bool) error {
+//
+// This is like db.PutXml(), but without converting the data to a string first.
+func (db *Db) PutXmlBytes(name string, data []byte, replace bool) (err error) {
+	defer db.observe(OpPut, time.Now(), &err)
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -166,24 +647,79 @@ func (db *Db) PutXml(name string, data string, replace bool) error {
 		return errclosed
 	}
 
-	csname := C.CString(name)
-	defer C.free(unsafe.Pointer(csname))
-	csdata := C.CString(data)
-	defer C.free(unsafe.Pointer(csdata))
+	csname, buf := cstring(name)
+	defer buf.free()
+	csdata := &emptyCString[0]
+	if len(data) > 0 {
+		csdata = (*C.char)(unsafe.Pointer(&data[0]))
+	}
 	repl := C.int(0)
 	if replace {
 		repl = 1
 	}
-	r := C.c_dbxml_put_xml(db.db, csname, csdata, repl)
+	r := C.c_dbxml_put_xml_bytes(db.db, csname, csdata, C.ulonglong(len(data)), repl)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	db.notify(ChangeEvent{Kind: ChangePut, Name: name})
+	return nil
+}
+
+// Put an xml document from memory into the database, with a generated unique name.
+//
+// The generated name starts with prefix. Returns the generated name.
+func (db *Db) PutXmlAutoName(prefix string, data string) (name string, err error) {
+	defer db.observe(OpPut, time.Now(), &err)
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return "", errclosed
+	}
+
+	csprefix := C.CString(prefix)
+	defer C.free(unsafe.Pointer(csprefix))
+	csdata := C.CString(data)
+	defer C.free(unsafe.Pointer(csdata))
+	r := C.c_dbxml_put_xml_gen_name(db.db, csprefix, csdata)
+	defer C.c_dbxml_result_free(r)
+	s := C.GoString(C.c_dbxml_result_string(r))
+	if C.c_dbxml_result_error(r) != 0 {
+		return "", resultError(r)
+	}
+	db.notify(ChangeEvent{Kind: ChangePut, Name: s})
+	return s, nil
+}
+
+// Replace the content of an existing xml document in the database.
+//
+// Unlike db.PutXml() with replace set to true, this keeps the metadata of the document.
+func (db *Db) UpdateXml(name string, data string) (err error) {
+	defer db.observe(OpPut, time.Now(), &err)
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+
+	csname := C.CString(name)
+	defer C.free(unsafe.Pointer(csname))
+	csdata := C.CString(data)
+	defer C.free(unsafe.Pointer(csdata))
+	r := C.c_dbxml_update_xml(db.db, csname, csdata)
 	defer C.c_dbxml_result_free(r)
 	if C.c_dbxml_result_error(r) != 0 {
-		return errors.New(C.GoString(C.c_dbxml_result_string(r)))
+		return resultError(r)
 	}
+	db.notify(ChangeEvent{Kind: ChangeUpdate, Name: name})
 	return nil
 }
 
 // Merge a database from disc into this database.
-func (db *Db) Merge(filename string, replace bool) error {
+func (db *Db) Merge(filename string, replace bool) (err error) {
+	defer db.observe(OpPut, time.Now(), &err)
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -199,14 +735,16 @@ func (db *Db) Merge(filename string, replace bool) error {
 	}
 	r := C.c_dbxml_merge(db.db, cs, repl)
 	defer C.c_dbxml_result_free(r)
+	db.notify(ChangeEvent{Kind: ChangeMany})
 	if C.c_dbxml_result_error(r) != 0 {
-		return errors.New(C.GoString(C.c_dbxml_result_string(r)))
+		return resultError(r)
 	}
 	return nil
 }
 
 // Remove an xml document from the database.
-func (db *Db) Remove(name string) error {
+func (db *Db) Remove(name string) (err error) {
+	defer db.observe(OpRemove, time.Now(), &err)
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -214,109 +752,630 @@ func (db *Db) Remove(name string) error {
 		return errclosed
 	}
 
-	cs := C.CString(name)
-	defer C.free(unsafe.Pointer(cs))
+	cs, buf := cstring(name)
+	defer buf.free()
 	r := C.c_dbxml_remove(db.db, cs)
 	defer C.c_dbxml_result_free(r)
 	if C.c_dbxml_result_error(r) != 0 {
-		return errors.New(C.GoString(C.c_dbxml_result_string(r)))
+		return resultError(r)
 	}
+	db.notify(ChangeEvent{Kind: ChangeRemove, Name: name})
 	return nil
 }
 
-//. Read
-
-// Get an xml document by name from the database.
-func (db *Db) Get(name string) (string, error) {
+// Remove several xml documents by name from the database, and return the number of documents that existed and were removed.
+//
+// Names of documents that don't exist are ignored. For a transactional database, all documents are removed
+// in one transaction, so either all of them are removed, or none if there is an error. Otherwise, documents
+// removed before an error remain removed.
+func (db *Db) RemoveMany(names []string) (n int, err error) {
+	defer db.observe(OpRemove, time.Now(), &err)
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
 	if !db.opened {
-		return "", errclosed
+		return 0, errclosed
 	}
 
-	cs := C.CString(name)
-	defer C.free(unsafe.Pointer(cs))
-
-	r := C.c_dbxml_get(db.db, cs)
+	cs := make([]*C.char, len(names)+1)
+	for i, name := range names {
+		cs[i] = C.CString(name)
+	}
+	defer func() {
+		for i := range names {
+			C.free(unsafe.Pointer(cs[i]))
+		}
+	}()
+	r := C.c_dbxml_remove_many(db.db, &cs[0])
 	defer C.c_dbxml_result_free(r)
-	s := C.GoString(C.c_dbxml_result_string(r))
 	if C.c_dbxml_result_error(r) != 0 {
-		return "", errors.New(s)
+		return 0, resultError(r)
 	}
-	return s, nil
+
+	events := make([]ChangeEvent, 0)
+	b := C.GoBytes(unsafe.Pointer(C.c_dbxml_result_string(r)), C.int(C.c_dbxml_result_size(r)))
+	for len(b) > 0 {
+		p := bytes.IndexByte(b, 0)
+		i, _ := strconv.Atoi(string(b[:p]))
+		b = b[p+1:]
+		events = append(events, ChangeEvent{Kind: ChangeRemove, Name: names[i]})
+	}
+	db.notify(events...)
+	return len(events), nil
 }
 
-// Get the number of xml documents in the database.
-func (db *Db) Size() (uint64, error) {
+// Rename an xml document in the database.
+//
+// The metadata of the document is kept. This fails if a document with the new name already exists.
+// For a transactional database, storing under the new name and removing the old name are done in one transaction.
+func (db *Db) Rename(oldName, newName string) (err error) {
+	defer db.observe(OpPut, time.Now(), &err)
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
 	if !db.opened {
-		return 0, errclosed
+		return errclosed
+	}
+
+	csold := C.CString(oldName)
+	defer C.free(unsafe.Pointer(csold))
+	csnew := C.CString(newName)
+	defer C.free(unsafe.Pointer(csnew))
+	r := C.c_dbxml_rename(db.db, csold, csnew)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
 	}
-	return uint64(C.c_dbxml_size(db.db)), nil
+	db.notify(ChangeEvent{Kind: ChangeRename, Name: newName, OldName: oldName})
+	return nil
 }
 
-// Get all xml documents from the database.
-//
-// Example:
+// Remove all xml documents that match the XPATH query from the database.
 //
-//      docs, err := db.All()
-//      if err != nil {
-//          fmt.Println(err)
-//      } else {
-//          for docs.Next() {
-//              fmt.Println(docs.Name(), docs.Content())
-//          }
-//          if err := docs.Error(); err != nil {
-//              fmt.Println(err)
-//          }
-//      }
-func (db *Db) All() (*Docs, error) {
-	docs := &Docs{}
+// Returns the number of removed documents. For a transactional database, the query and all removals are done
+// in one transaction, so either all matching documents are removed, or none if there is an error. Otherwise,
+// documents removed before the error occurred stay removed.
+func (db *Db) RemoveQuery(query string, namespaces ...Namespace) (n int, err error) {
+	defer db.observe(OpRemove, time.Now(), &err)
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return 0, errclosed
+	}
+
+	cs := C.CString(query)
+	defer C.free(unsafe.Pointer(cs))
+
+	ns := make([]*C.char, 2*len(namespaces)+1)
+	for i, n := range namespaces {
+		ns[2*i] = C.CString(n.Prefix)
+		ns[2*i+1] = C.CString(n.Uri)
+	}
+
+	var count C.ulonglong
+	r := C.c_dbxml_remove_query(db.db, cs, &ns[0], &count)
+
+	for i := range namespaces {
+		C.free(unsafe.Pointer(ns[2*i]))
+		C.free(unsafe.Pointer(ns[2*i+1]))
+	}
+
+	defer C.c_dbxml_result_free(r)
+	if count > 0 {
+		db.notify(ChangeEvent{Kind: ChangeMany})
+	}
+	if C.c_dbxml_result_error(r) != 0 {
+		return int(count), resultError(r)
+	}
+	return int(count), nil
+}
+
+// Run an XQuery Update expression on the database, and return the number of documents that were changed.
+//
+// The default collection is set to this database, so queries can use collection() to refer to it:
+//
+//      n, err := db.Update(`replace value of node collection()//node[@id="12"]/@lemma with "fiets"`)
+//
+// The changes are stored in the database. If the database is transactional, the update is run in one transaction.
+// DbXml doesn't report which documents are modified, so to count them, the content of all documents is compared
+// before and after the update. This takes about as long as reading the database twice.
+func (db *Db) Update(query string, namespaces ...Namespace) (int, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return 0, errclosed
+	}
+
+	cs := C.CString(query)
+	defer C.free(unsafe.Pointer(cs))
+
+	ns := make([]*C.char, 2*len(namespaces)+1)
+	for i, n := range namespaces {
+		ns[2*i] = C.CString(n.Prefix)
+		ns[2*i+1] = C.CString(n.Uri)
+	}
+
+	var n C.ulonglong
+	r := C.c_dbxml_update(db.db, cs, &ns[0], &n)
+
+	for i := range namespaces {
+		C.free(unsafe.Pointer(ns[2*i]))
+		C.free(unsafe.Pointer(ns[2*i+1]))
+	}
+
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return 0, resultError(r)
+	}
+	if n > 0 {
+		db.notify(ChangeEvent{Kind: ChangeMany})
+	}
+	return int(n), nil
+}
+
+//. Read
+
+// Get an xml document by name from the database.
+func (db *Db) Get(name string) (content string, err error) {
+	defer db.observe(OpGet, time.Now(), &err)
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return "", errclosed
+	}
+
+	cs, buf := cstring(name)
+	defer buf.free()
+
+	r := C.c_dbxml_get(db.db, cs)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return "", resultError(r)
+	}
+	s := C.GoStringN(C.c_dbxml_result_string(r), C.int(C.c_dbxml_result_size(r)))
+	return db.output.apply(s), nil
+}
+
+// Get an xml document by name from the database, as a byte slice.
+//
+// This is like db.Get(), but without converting the document to a string.
+func (db *Db) GetBytes(name string) (content []byte, err error) {
+	defer db.observe(OpGet, time.Now(), &err)
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return nil, errclosed
+	}
+
+	cs, buf := cstring(name)
+	defer buf.free()
+
+	r := C.c_dbxml_get(db.db, cs)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return nil, resultError(r)
+	}
+	if !db.output.isDefault() {
+		return []byte(db.output.apply(C.GoString(C.c_dbxml_result_string(r)))), nil
+	}
+	return C.GoBytes(unsafe.Pointer(C.c_dbxml_result_string(r)), C.int(C.c_dbxml_result_size(r))), nil
+}
+
+// Get several xml documents by name from the database, in one call and, for a transactional database, in one transaction.
+//
+// The documents are returned by name. Documents that don't exist are left out of the map.
+func (db *Db) GetMany(names []string) (contents map[string]string, err error) {
+	defer db.observe(OpGet, time.Now(), &err)
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return nil, errclosed
+	}
+
+	cs := make([]*C.char, len(names)+1)
+	for i, name := range names {
+		cs[i] = C.CString(name)
+	}
+	defer func() {
+		for i := range names {
+			C.free(unsafe.Pointer(cs[i]))
+		}
+	}()
+	r := C.c_dbxml_get_many(db.db, &cs[0])
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return nil, resultError(r)
+	}
+
+	contents = make(map[string]string)
+	b := C.GoBytes(unsafe.Pointer(C.c_dbxml_result_string(r)), C.int(C.c_dbxml_result_size(r)))
+	for len(b) > 0 {
+		var item [2]string
+		for j := range item {
+			p := bytes.IndexByte(b, 0)
+			item[j] = string(b[:p])
+			b = b[p+1:]
+		}
+		i, _ := strconv.Atoi(item[0])
+		contents[names[i]] = db.output.apply(item[1])
+	}
+	return contents, nil
+}
+
+// Check if an xml document with the given name exists in the database.
+//
+// The content of the document is not retrieved.
+func (db *Db) Exists(name string) (bool, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return false, errclosed
+	}
+
+	cs, buf := cstring(name)
+	defer buf.free()
+
+	var exists C.int
+	r := C.c_dbxml_exists(db.db, cs, &exists)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return false, resultError(r)
+	}
+	return exists != 0, nil
+}
+
+// Get the number of xml documents in the database.
+func (db *Db) Size() (uint64, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return 0, errclosed
+	}
+	var size C.ulonglong
+	r := C.c_dbxml_size(db.db, &size)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return 0, resultError(r)
+	}
+	return uint64(size), nil
+}
+
+// Get all xml documents from the database.
+//
+// Example:
+//
+//      docs, err := db.All()
+//      if err != nil {
+//          fmt.Println(err)
+//      } else {
+//          for docs.Next() {
+//              fmt.Println(docs.Name(), docs.Content())
+//          }
+//          if err := docs.Error(); err != nil {
+//              fmt.Println(err)
+//          }
+//      }
+func (db *Db) All() (*Docs, error) {
+	docs := &Docs{}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return docs, errclosed
+	}
+	docs.docs = C.c_dbxml_get_all(db.db)
+	if C.c_dbxml_get_query_error(docs.docs) != 0 {
+		defer C.c_dbxml_docs_free(docs.docs)
+		return docs, docsError(docs.docs)
+	}
+	docs.output = db.output
+	runtime.SetFinalizer(docs, (*Docs).Close)
+	docs.opened = true
+	db.track(docs, "db.All()")
+	return docs, nil
+}
+
+// Get the names of all xml documents from the database.
+//
+// This is like db.All(), but docs.Content(), docs.Match() and docs.Value() always return an empty string.
+// No content of documents is retrieved from the database.
+//
+// Example:
+//
+//      docs, err := db.AllNames()
+//      if err != nil {
+//          fmt.Println(err)
+//      } else {
+//          for docs.Next() {
+//              fmt.Println(docs.Name())
+//          }
+//      }
+func (db *Db) AllNames() (*Docs, error) {
+	docs := &Docs{}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return docs, errclosed
+	}
+	docs.docs = C.c_dbxml_get_all_names(db.db)
+	if C.c_dbxml_get_query_error(docs.docs) != 0 {
+		defer C.c_dbxml_docs_free(docs.docs)
+		return docs, docsError(docs.docs)
+	}
+	runtime.SetFinalizer(docs, (*Docs).Close)
+	docs.opened = true
+	db.track(docs, "db.AllNames()")
+	return docs, nil
+}
+
+// Get all xml documents with names that match a shell pattern, with the syntax of path.Match().
+//
+// As with path.Match(), '*' and '?' don't match '/'. The names are matched before any content is retrieved,
+// and only the names that start with the literal part of the pattern before the first '*', '?' or '[' are read
+// from the index on dbxml:name.
+//
+// Example:
+//
+//      docs, err := db.AllMatching("cgn/comp-a/*.xml")
+func (db *Db) AllMatching(pattern string) (*Docs, error) {
+	docs := &Docs{}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return docs, err
+	}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return docs, errclosed
+	}
+	cs := C.CString(pattern)
+	defer C.free(unsafe.Pointer(cs))
+	docs.docs = C.c_dbxml_get_matching(db.db, cs)
+	if C.c_dbxml_get_query_error(docs.docs) != 0 {
+		defer C.c_dbxml_docs_free(docs.docs)
+		return docs, docsError(docs.docs)
+	}
+	docs.output = db.output
+	runtime.SetFinalizer(docs, (*Docs).Close)
+	docs.opened = true
+	db.track(docs, "db.AllMatching("+quoteString(pattern)+")")
+	return docs, nil
+}
+
+// Get the names of the xml documents with names that start with prefix, in order of name.
+//
+// This is like db.AllNames(), but only the range of names with the prefix is read from the index on dbxml:name.
+// An empty prefix returns all names, like db.AllNames(), but not in order of name.
+//
+// Example:
+//
+//      docs, err := db.Names("cgn/comp-a/")
+func (db *Db) Names(prefix string) (*Docs, error) {
+	docs := &Docs{}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return docs, errclosed
+	}
+	cs := C.CString(prefix)
+	defer C.free(unsafe.Pointer(cs))
+	docs.docs = C.c_dbxml_get_names(db.db, cs)
+	if C.c_dbxml_get_query_error(docs.docs) != 0 {
+		defer C.c_dbxml_docs_free(docs.docs)
+		return docs, docsError(docs.docs)
+	}
+	runtime.SetFinalizer(docs, (*Docs).Close)
+	docs.opened = true
+	db.track(docs, "db.Names("+quoteString(prefix)+")")
+	return docs, nil
+}
+
+// Get all xml documents that match the XPATH query from the database.
+//
+// Results are returned in document order, unless db.SetOrdering() was called with Unordered.
+//
+// Queries are evaluated with XPATH 2.0 and XQUERY 1.0 semantics. DbXml has no XPATH 1.0 compatibility mode,
+// so a query written for XPATH 1.0 may need changes. For instance, contains(.//w, "kat") is an error if there is
+// more than one w element, where XPATH 1.0 uses the first, and arithmetic on a string needs number().
+//
+// Example:
+//
+//      docs, err := db.Query(xpath_query)
+//      if err != nil {
+//          fmt.Println(err)
+//      } else {
+//          for docs.Next() {
+//              fmt.Println(docs.Name(), docs.Content())
+//          }
+//          if err := docs.Error(); err != nil {
+//              fmt.Println(err)
+//          }
+//      }
+func (db *Db) Query(query string, namespaces ...Namespace) (*Docs, error) {
+	q, err := db.prepare(query, true, namespaces...)
+	if err != nil {
+		return &Docs{}, err
+	}
+	return q.Run()
+}
+
+// Run an XPATH query on the default collection, and return at most limit results, after skipping the first offset results.
+//
+// The skipped results are not retrieved from the database. A limit of 0 means no limit.
+//
+// Example, page 37 with 20 results per page:
+//
+//      docs, err := db.QueryPaged("//s", 36*20, 20)
+func (db *Db) QueryPaged(query string, offset, limit uint64, namespaces ...Namespace) (*Docs, error) {
+	q, err := db.prepare(query, true, namespaces...)
+	if err != nil {
+		return &Docs{}, err
+	}
+	return q.RunPaged(offset, limit)
+}
+
+// Count the results of an XPATH query on the default collection.
+//
+// The results are counted without retrieving their content.
+func (db *Db) QueryCount(query string, namespaces ...Namespace) (uint64, error) {
+	q, err := db.prepare(query, true, namespaces...)
+	if err != nil {
+		return 0, err
+	}
+	defer q.Close()
+	return q.Count()
+}
+
+// Run an XPATH query on a single document, and return its matches.
+//
+// The document is selected by name with the index on dbxml:name, so the query doesn't scan the other documents in the database.
+// Without matches, or if the document doesn't exist, no results are returned.
+//
+// Example:
+//
+//      docs, err := db.QueryDoc("doc1.xml", "//node[@rel='su']")
+func (db *Db) QueryDoc(name, query string, namespaces ...Namespace) (*Docs, error) {
+	q, err := db.prepare("[dbxml:metadata('dbxml:name') = "+quoteString(name)+"]"+query, true, namespaces...)
+	if err != nil {
+		return &Docs{}, err
+	}
+	return q.Run()
+}
+
+// TODO: Get all... what?
+func (db *Db) QueryRaw(query string, namespaces ...Namespace) (*Docs, error) {
+	q, err := db.prepare(query, false, namespaces...)
+	if err != nil {
+		return &Docs{}, err
+	}
+	return q.Run()
+}
+
+// Set a timeout for queries on the database.
+//
+// A query that runs longer than the timeout is interrupted, and results in an error.
+// The timeout is rounded up to whole seconds. A timeout of 0 means no timeout.
+//
+// This is used for all queries that are prepared after this call, including queries by db.Query() and db.QueryRaw().
+func (db *Db) SetQueryTimeout(d time.Duration) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	var seconds C.uint
+	if d > 0 {
+		seconds = C.uint((d + time.Second - 1) / time.Second)
+	}
+	C.c_dbxml_set_query_timeout(db.db, seconds)
+	return nil
+}
+
+// Get the query plan for an XPATH query on the default collection, as an xml string.
+//
+// Use this to find out if the indexes of the database are used by the query.
+func (db *Db) Explain(query string, namespaces ...Namespace) (string, error) {
+	q, err := db.prepare(query, true, namespaces...)
+	if err != nil {
+		return "", err
+	}
+	defer q.Close()
+	return q.Plan()
+}
+
+// Set the base uri for queries on the database.
+//
+// Relative uris in queries, as in doc('file.xml'), and in module imports, are resolved against the base uri.
+//
+// This is used for all queries that are prepared after this call. An empty string resets the base uri to the default.
+//
+// Example:
+//
+//      err := db.SetBaseURI("file:///home/user/corpus/")
+func (db *Db) SetBaseURI(uri string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	cs := C.CString(uri)
+	defer C.free(unsafe.Pointer(cs))
+	C.c_dbxml_set_base_uri(db.db, cs)
+	return nil
+}
+
+// Set the flags for running queries on the database.
+//
+// This is used for all queries that are prepared after this call, including queries by db.Query() and db.QueryRaw().
+// The default is DefaultQueryFlags.
+//
+// Example, for a database with WholedocStorage, where most queries only read a few attributes of each document:
+//
+//      err := db.SetQueryFlags(dbxml.DefaultQueryFlags | dbxml.DocumentProjection)
+func (db *Db) SetQueryFlags(flags QueryFlags) error {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
 	if !db.opened {
-		return docs, errclosed
+		return errclosed
 	}
-	docs.docs = C.c_dbxml_get_all(db.db)
-	runtime.SetFinalizer(docs, (*Docs).Close)
-	docs.opened = true
-	return docs, nil
+	db.flags = flags
+	return nil
 }
 
-// Get all xml documents that match the XPATH query from the database.
+// Set the order of the results of queries on the database.
+//
+// This is used for all queries that are prepared after this call, including queries by db.Query() and db.QueryRaw().
+// For an unordered query, the ordering is declared in the prolog of the query, after the version declaration if there is one.
+// Parts of a query can still be ordered with ordered { ... }, or sorted with order by.
 //
 // Example:
 //
-//      docs, err := db.Query(xpath_query)
-//      if err != nil {
-//          fmt.Println(err)
-//      } else {
-//          for docs.Next() {
-//              fmt.Println(docs.Name(), docs.Content())
-//          }
-//          if err := docs.Error(); err != nil {
-//              fmt.Println(err)
-//          }
-//      }
-func (db *Db) Query(query string, namespaces ...Namespace) (*Docs, error) {
-	q, err := db.prepare(query, true, namespaces...)
-	if err != nil {
-		return &Docs{}, err
+//      err := db.SetOrdering(dbxml.Unordered)
+//      docs, err := db.QueryPaged("//s[@cat='smain']", 0, 50)
+func (db *Db) SetOrdering(ordering Ordering) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
 	}
-	return q.Run()
+	var unordered C.int
+	if ordering == Unordered {
+		unordered = 1
+	}
+	C.c_dbxml_set_unordered(db.db, unordered)
+	return nil
 }
 
-// TODO: Get all... what?
-func (db *Db) QueryRaw(query string, namespaces ...Namespace) (*Docs, error) {
-	q, err := db.prepare(query, false, namespaces...)
-	if err != nil {
-		return &Docs{}, err
+// Set options for the output of xml documents by db.Get(), db.GetBytes(), docs.Content() and docs.NextBatch().
+//
+// This is used for queries that are prepared after this call, and for db.All().
+// It is not used for streaming output, such as db.GetTo().
+//
+// Example:
+//
+//      err := db.SetSerialization(dbxml.Serialization{Indent: "  ", OmitDeclaration: true})
+func (db *Db) SetSerialization(s Serialization) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
 	}
-	return q.Run()
+	db.output = s
+	return nil
 }
 
 // Prepare an XPATH query that runs on the default collection.
@@ -328,21 +1387,35 @@ func (db *Db) Prepare(query string, namespaces ...Namespace) (*Query, error) {
 
 // Prepare an XPATH query without setting the default collection.
 //
+// The database is still the default collection, so collection() without argument refers to it.
+//
 // The query can be run multiple times, and a running query can be cancelled by query.Cancel()
 func (db *Db) PrepareRaw(query string, namespaces ...Namespace) (*Query, error) {
 	return db.prepare(query, false, namespaces...)
 }
 
 func (db *Db) prepare(query string, useImplicitCollection bool, namespaces ...Namespace) (*Query, error) {
+	return db.prepareContext(query, useImplicitCollection, nil, "", namespaces...)
+}
+
+// The query as it was prepared, so the line and column of a query error match the query in the error.
+// The caller must hold the lock.
+func (db *Db) queryText(query *C.char, useImplicitCollection C.int) string {
+	r := C.c_dbxml_query_text(db.db, query, useImplicitCollection)
+	defer C.c_dbxml_result_free(r)
+	return C.GoString(C.c_dbxml_result_string(r))
+}
+
+func (db *Db) prepareContext(query string, useImplicitCollection bool, variables map[string]string, baseURI string, namespaces ...Namespace) (*Query, error) {
 	q := &Query{}
-	db.lock.Lock()
-	defer db.lock.Unlock()
+	db.lock.RLock()
+	defer db.lock.RUnlock()
 
 	if !db.opened {
 		return q, errclosed
 	}
-	cs := C.CString(query)
-	defer C.free(unsafe.Pointer(cs))
+	cs, buf := cstring(query)
+	defer buf.free()
 
 	ns := make([]*C.char, 2*len(namespaces)+1)
 	for i, n := range namespaces {
@@ -350,28 +1423,47 @@ func (db *Db) prepare(query string, useImplicitCollection bool, namespaces ...Na
 		ns[2*i+1] = C.CString(n.Uri)
 	}
 
+	vars := make([]*C.char, 0, 2*len(variables)+1)
+	for name, value := range variables {
+		vars = append(vars, C.CString(name), C.CString(value))
+	}
+	vars = append(vars, nil)
+
 	var ci C.int
 	if useImplicitCollection {
 		ci = 1
 	}
 
-	q.query = C.c_dbxml_prepare_query(db.db, cs, ci, &ns[0])
+	csbase := C.CString(baseURI)
+	defer C.free(unsafe.Pointer(csbase))
+
+	q.query = C.c_dbxml_prepare_query_context(db.db, cs, ci, &ns[0], &vars[0], csbase)
 
 	for i := range namespaces {
 		C.free(unsafe.Pointer(ns[2*i]))
 		C.free(unsafe.Pointer(ns[2*i+1]))
 	}
+	for _, v := range vars {
+		C.free(unsafe.Pointer(v))
+	}
 
 	if C.c_dbxml_get_prepared_error(q.query) != 0 {
 		defer C.c_dbxml_query_free(q.query)
-		return q, errors.New(C.GoString(C.c_dbxml_get_prepared_errstring(q.query)))
+		return q, withQuery(queryError(q.query), db.queryText(cs, ci))
+	}
+	if db.flags != DefaultQueryFlags {
+		setQueryFlags(q.query, db.flags)
 	}
 	// No finalizer: query will be closed when database gets closed
 	q.opened = true
 	q.db = db
+	q.output = db.output
+	q.text = db.queryText(cs, ci)
+	db.qlock.Lock()
 	q.id = db.counter
 	db.counter++
 	db.queries[q.id] = q
+	db.qlock.Unlock()
 	return q, nil
 }
 
@@ -384,16 +1476,64 @@ func (query *Query) Run() (*Docs, error) {
 	if !query.opened {
 		return docs, errqueryclosed
 	}
+	var observer Observer
+	if query.db != nil {
+		observer = query.db.getObserver()
+	}
+	start := time.Now()
 	docs.docs = C.c_dbxml_run_query(query.query)
 	if C.c_dbxml_get_query_error(docs.docs) != 0 {
 		defer C.c_dbxml_docs_free(docs.docs)
-		return docs, errors.New(C.GoString(C.c_dbxml_get_query_errstring(docs.docs)))
+		err := withQuery(docsError(docs.docs), query.text)
+		if observer != nil {
+			observer(OpQuery, time.Since(start), err)
+		}
+		return docs, err
+	}
+	if observer != nil {
+		observer(OpQuery, time.Since(start), nil)
 	}
+	docs.output = query.output
+	docs.observer = observer
+	docs.text = query.text
+	docs.limits = query.limits
 	runtime.SetFinalizer(docs, (*Docs).Close)
 	docs.opened = true
+	if query.db != nil {
+		query.db.track(docs, query.text)
+	}
+	return docs, nil
+}
+
+// Run a prepared query, and return at most limit results, after skipping the first offset results.
+//
+// See: db.QueryPaged()
+func (query *Query) RunPaged(offset, limit uint64) (*Docs, error) {
+	docs, err := query.Run()
+	if err != nil {
+		return docs, err
+	}
+	C.c_dbxml_docs_set_page(docs.docs, C.ulonglong(offset), C.ulonglong(limit))
 	return docs, nil
 }
 
+// Run a prepared query, and count the results without retrieving their content.
+func (query *Query) Count() (uint64, error) {
+	query.lock.Lock()
+	defer query.lock.Unlock()
+
+	if !query.opened {
+		return 0, errqueryclosed
+	}
+	var count C.ulonglong
+	r := C.c_dbxml_query_count(query.query, &count)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return 0, resultError(r)
+	}
+	return uint64(count), nil
+}
+
 // Cancel a running query.
 func (query *Query) Cancel() {
 	query.lock.Lock()
@@ -403,37 +1543,269 @@ func (query *Query) Cancel() {
 	}
 }
 
+// Set the evaluation type for the results of the query.
+//
+// This is used when the query is run with query.Run(), and has no effect on results that already exist.
+func (query *Query) SetEvaluation(evaluation Evaluation) error {
+	query.lock.Lock()
+	defer query.lock.Unlock()
+
+	if !query.opened {
+		return errqueryclosed
+	}
+	var eager C.int
+	if evaluation == Eager {
+		eager = 1
+	}
+	C.c_dbxml_query_set_eager(query.query, eager)
+	return nil
+}
+
+// Set the flags for running the query.
+//
+// This is used when the query is run with query.Run(). The default is the flags set with db.SetQueryFlags().
+//
+// Example:
+//
+//      err := query.SetFlags(dbxml.DefaultQueryFlags | dbxml.DocumentProjection)
+func (query *Query) SetFlags(flags QueryFlags) error {
+	query.lock.Lock()
+	defer query.lock.Unlock()
+
+	if !query.opened {
+		return errqueryclosed
+	}
+	setQueryFlags(query.query, flags)
+	return nil
+}
+
+func setQueryFlags(query C.c_dbxml_query, flags QueryFlags) {
+	var lazydocs, projection, wellformed C.int
+	if flags&LazyDocs != 0 {
+		lazydocs = 1
+	}
+	if flags&DocumentProjection != 0 {
+		projection = 1
+	}
+	if flags&WellFormedOnly != 0 {
+		wellformed = 1
+	}
+	C.c_dbxml_query_set_flags(query, lazydocs, projection, wellformed)
+}
+
+// Get the query plan of a prepared query, as an xml string.
+//
+// The plan shows which indexes are used by the query.
+func (query *Query) Plan() (string, error) {
+	query.lock.Lock()
+	defer query.lock.Unlock()
+
+	if !query.opened {
+		return "", errqueryclosed
+	}
+	r := C.c_dbxml_query_plan(query.query)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return "", resultError(r)
+	}
+	return C.GoString(C.c_dbxml_result_string(r)), nil
+}
+
 // Iterate to the next xml document in the list, that was returned by db.All(), db.Query(query), or query.Run().
 func (docs *Docs) Next() bool {
+	if docs.prefetch != nil {
+		return docs.nextPrefetched()
+	}
 	docs.lock.Lock()
 	defer docs.lock.Unlock()
 	if !docs.opened {
 		return false
 	}
 	docs.err = nil
+	var start time.Time
+	if docs.observer != nil {
+		start = time.Now()
+	}
 	if C.c_dbxml_docs_next(docs.docs) == 0 {
 		if C.c_dbxml_get_query_error(docs.docs) != 0 {
-			docs.err = errors.New(C.GoString(C.c_dbxml_get_query_errstring(docs.docs)))
+			docs.err = withQuery(docsError(docs.docs), docs.text)
+			if docs.ctx != nil && docs.ctx.Err() != nil {
+				docs.err = docs.ctx.Err()
+			}
+			if docs.observer != nil {
+				docs.observer(OpNext, time.Since(start), docs.err)
+			}
+		}
+		// Eager results are kept, so they can be reset
+		if C.c_dbxml_docs_eager(docs.docs) == 0 {
+			docs.close()
 		}
-		docs.close()
 		docs.started = false
 		return false
 	}
+	if !docs.countResult() {
+		return false
+	}
 	docs.started = true
+	if docs.observer != nil {
+		docs.observer(OpNext, time.Since(start), nil)
+	}
 	return true
 }
 
+// Iterate over up to n xml documents at once.
+//
+// This is faster than calling docs.Next(), docs.Name() and docs.Content() for each document.
+// After this, the current document is the last document in the batch, unless the end was reached.
+//
+// Returns an empty slice if there are no more documents. Like docs.Next(), this closes the iterator
+// when the end is reached, unless the results were evaluated eagerly.
+//
+// Example:
+//
+//      docs, _ := db.All()
+//      for {
+//          batch := docs.NextBatch(1000)
+//          if len(batch) == 0 {
+//              break
+//          }
+//          for _, doc := range batch {
+//              fmt.Println(doc.Name, doc.Content)
+//          }
+//      }
+//      if err := docs.Error(); err != nil {
+//          fmt.Println(err)
+//      }
+func (docs *Docs) NextBatch(n int) []Document {
+	docs.lock.Lock()
+	defer docs.lock.Unlock()
+	pairs := docs.nextBatch(n, 0)
+	batch := make([]Document, len(pairs))
+	for i, p := range pairs {
+		batch[i] = Document{Name: p[0], Content: docs.output.apply(p[1])}
+	}
+	return batch
+}
+
+// Get up to n next query results at once, with the document name and the matched subtree.
+//
+// This is like docs.NextBatch(), but without the content of the whole document.
+func (docs *Docs) NextHits(n int) []Hit {
+	docs.lock.Lock()
+	defer docs.lock.Unlock()
+	pairs := docs.nextBatch(n, 1)
+	batch := make([]Hit, len(pairs))
+	for i, p := range pairs {
+		batch[i] = Hit{Name: p[0], Match: p[1]}
+	}
+	return batch
+}
+
+// Advance up to n times, get name and content or match, or all for match == 2. The caller must hold the lock.
+func (docs *Docs) nextBatch(n int, match C.int) [][]string {
+	if !docs.opened || n < 1 {
+		return [][]string{}
+	}
+	docs.err = nil
+	var start time.Time
+	if docs.observer != nil {
+		start = time.Now()
+	}
+	fields := 2
+	if match == 2 {
+		fields = 4
+	}
+	count := int(C.c_dbxml_docs_next_n(docs.docs, C.int(n), match))
+	batch := make([][]string, 0, count)
+	if count > 0 {
+		b := C.GoBytes(unsafe.Pointer(C.c_dbxml_docs_batch(docs.docs)), C.int(C.c_dbxml_docs_batch_size(docs.docs)))
+		for i := 0; i < count; i++ {
+			item := make([]string, fields)
+			for j := range item {
+				p := bytes.IndexByte(b, 0)
+				item[j] = string(b[:p])
+				b = b[p+1:]
+			}
+			batch = append(batch, item)
+		}
+	}
+	for i, item := range batch {
+		size := 0
+		for _, part := range item {
+			size += len(part)
+		}
+		if !docs.countResult() || !docs.countBytes(size) {
+			// as with docs.Next(), exceeding a limit is not reported as an error
+			docs.observeBatch(i, start, nil)
+			return batch[:i]
+		}
+	}
+	if count < n {
+		if C.c_dbxml_get_query_error(docs.docs) != 0 {
+			docs.err = withQuery(docsError(docs.docs), docs.text)
+			if docs.ctx != nil && docs.ctx.Err() != nil {
+				docs.err = docs.ctx.Err()
+			}
+		}
+		docs.observeBatch(count, start, docs.err)
+		// Eager results are kept, so they can be reset
+		if C.c_dbxml_docs_eager(docs.docs) == 0 {
+			docs.close()
+		}
+		docs.started = false
+		return batch
+	}
+	docs.started = true
+	docs.observeBatch(count, start, nil)
+	return batch
+}
+
+// Report each of n results of a batch as OpNext, as docs.Next() does, with an equal share of the duration.
+// An error is reported as one more OpNext.
+func (docs *Docs) observeBatch(n int, start time.Time, err error) {
+	if docs.observer == nil {
+		return
+	}
+	calls := n
+	if err != nil {
+		calls++
+	}
+	if calls == 0 {
+		return
+	}
+	d := time.Since(start) / time.Duration(calls)
+	for i := 0; i < n; i++ {
+		docs.observer(OpNext, d, nil)
+	}
+	if err != nil {
+		docs.observer(OpNext, d, err)
+	}
+}
+
 // Get name of current xml document after call to docs.Next().
 func (docs *Docs) Name() string {
 	return docs.getNameContent(1)
 }
 
 // Get content of current xml document after call to docs.Next().
+//
+// The content is retrieved from the database when this is called, not by docs.Next(), so a loop
+// that filters on docs.Name() only pays for the content of the documents it uses:
+//
+//      for docs.Next() {
+//          if strings.HasPrefix(docs.Name(), "wiki-") {
+//              process(docs.Content())
+//          }
+//      }
+//
+// This is not so after docs.Prefetch(), and docs.NextBatch() retrieves the content of all documents in the batch.
 func (docs *Docs) Content() string {
 	return docs.getNameContent(2)
 }
 
 // Get matched subtree from current xml document after call to docs.Next().
+//
+// Only the matched subtree is retrieved, not the content of the whole document.
 func (docs *Docs) Match() string {
 	return docs.getNameContent(3)
 }
@@ -444,27 +1816,92 @@ func (docs *Docs) Value() string {
 }
 
 func (docs *Docs) getNameContent(what int) string {
+	if docs.prefetch != nil {
+		return docs.prefetched(what)
+	}
 	docs.lock.Lock()
 	defer docs.lock.Unlock()
 	if !(docs.opened && docs.started) {
 		return ""
 	}
+	var s string
 	switch what {
 	case 1:
-		return C.GoString(C.c_dbxml_docs_name(docs.docs))
+		s = C.GoString(C.c_dbxml_docs_name(docs.docs))
 	case 2:
-		return C.GoString(C.c_dbxml_docs_content(docs.docs))
+		s = C.GoString(C.c_dbxml_docs_content(docs.docs))
 	case 3:
-		return C.GoString(C.c_dbxml_docs_match(docs.docs))
+		s = C.GoString(C.c_dbxml_docs_match(docs.docs))
 	case 4:
-		return C.GoString(C.c_dbxml_docs_value(docs.docs))
+		s = C.GoString(C.c_dbxml_docs_value(docs.docs))
+	case 5:
+		return C.GoString(C.c_dbxml_docs_node_handle(docs.docs))
+	default:
+		return ""
+	}
+	if !docs.countBytes(len(s)) {
+		return ""
+	}
+	if what == 2 {
+		return docs.output.apply(s)
+	}
+	return s
+}
+
+// Run an XPATH query on the current result of the iterator, without retrieving its content.
+//
+// The current document, or the current value if the result is not a document, is the context item of the query.
+// The query uses the namespaces of the original query. Iterate the returned results before calling docs.Next() again.
+//
+// Example:
+//
+//      docs, _ := db.Query("/treebank[.//node[@cat='smain']]")
+//      for docs.Next() {
+//          words, err := docs.Query("//node[@word]/@word/string()")
+//          if err != nil {
+//              fmt.Println(err)
+//              break
+//          }
+//          for words.Next() {
+//              fmt.Println(docs.Name(), words.Value())
+//          }
+//      }
+func (docs *Docs) Query(query string) (*Docs, error) {
+	docs.lock.Lock()
+	defer docs.lock.Unlock()
+
+	sub := &Docs{}
+	if !docs.opened {
+		return sub, errdocsclosed
+	}
+	if !docs.started {
+		return sub, errnocurrent
+	}
+	cs := C.CString(query)
+	defer C.free(unsafe.Pointer(cs))
+	sub.docs = C.c_dbxml_docs_query(docs.docs, cs)
+	if C.c_dbxml_get_query_error(sub.docs) != 0 {
+		defer C.c_dbxml_docs_free(sub.docs)
+		return sub, withQuery(docsError(sub.docs), query)
+	}
+	sub.output = docs.output
+	sub.observer = docs.observer
+	sub.text = query
+	runtime.SetFinalizer(sub, (*Docs).Close)
+	sub.opened = true
+	if docs.db != nil {
+		docs.db.track(sub, query)
 	}
-	return ""
+	return sub, nil
 }
 
 // Close iterator over xml documents in the database, that was returned by db.All(), db.Query(query), or query.Run().
 //
-// This is called automaticly if docs.Next() reaches false, but you can also call it inside a loop to exit it prematurely:
+// For results that are evaluated lazily, this is called automaticly if docs.Next() reaches false.
+// Results that are evaluated eagerly are kept until this is called, or until garbage collection,
+// so they can be iterated again after docs.Reset().
+//
+// You can also call it inside a loop to exit it prematurely:
 //
 //      docs, _ := db.All()
 //      for docs.Next() {
@@ -474,6 +1911,7 @@ func (docs *Docs) getNameContent(what int) string {
 //          }
 //      }
 func (docs *Docs) Close() {
+	docs.stopPrefetch()
 	docs.lock.Lock()
 	defer docs.lock.Unlock()
 	docs.close()
@@ -483,7 +1921,57 @@ func (docs *Docs) close() {
 	if docs.opened {
 		C.c_dbxml_docs_free(docs.docs)
 		docs.opened = false
+		if docs.db != nil {
+			docs.db.untrack(docs)
+		}
+		if docs.cleanup != nil {
+			docs.cleanup()
+			docs.cleanup = nil
+		}
+	}
+}
+
+// Rewind the iterator, so the results can be iterated again without running the query again.
+//
+// This is only available for results that are evaluated eagerly.
+func (docs *Docs) Reset() error {
+	docs.lock.Lock()
+	defer docs.lock.Unlock()
+	if !docs.opened {
+		return errdocsclosed
+	}
+	if docs.prefetch != nil {
+		return errprefetch
+	}
+	r := C.c_dbxml_docs_reset(docs.docs)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	docs.started = false
+	docs.err = nil
+	docs.limits.results = 0
+	docs.limits.bytes = 0
+	return nil
+}
+
+// Get the total number of items in the iterator.
+//
+// This is only available for results that are evaluated eagerly.
+// For paged results, this is the number of items before paging.
+func (docs *Docs) Size() (uint64, error) {
+	docs.lock.Lock()
+	defer docs.lock.Unlock()
+	if !docs.opened {
+		return 0, errdocsclosed
+	}
+	var size C.ulonglong
+	r := C.c_dbxml_docs_size(docs.docs, &size)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return 0, resultError(r)
 	}
+	return uint64(size), nil
 }
 
 // Get the error, if any, after docs.Next() returned false.
@@ -495,14 +1983,39 @@ func (docs *Docs) Error() error {
 
 // Close a query that was created with Prepare()
 //
-// This is called automaticly when the database is closed.
+// This is called automaticly when the database or environment is closed.
 func (query *Query) Close() {
+	// Lock order: environment, database, query
+	query.lock.Lock()
+	db := query.db
+	env := query.env
+	query.lock.Unlock()
+	if env != nil {
+		env.lock.Lock()
+		defer env.lock.Unlock()
+	}
+	if db != nil {
+		db.lock.RLock()
+		defer db.lock.RUnlock()
+	}
+	query.close()
+}
+
+func (query *Query) close() {
 	query.lock.Lock()
 	defer query.lock.Unlock()
 	if query.opened {
 		C.c_dbxml_query_free(query.query)
-		delete(query.db.queries, query.id)
-		query.db = nil
+		if query.db != nil {
+			query.db.qlock.Lock()
+			delete(query.db.queries, query.id)
+			query.db.qlock.Unlock()
+			query.db = nil
+		}
+		if query.env != nil {
+			delete(query.env.queries, query.id)
+			query.env = nil
+		}
 		query.opened = false
 	}
 }
@@ -536,7 +2049,7 @@ func Check(query string, namespaces ...Namespace) error {
 
 	defer C.c_dbxml_result_free(r)
 	if C.c_dbxml_result_error(r) != 0 {
-		return errors.New(C.GoString(C.c_dbxml_result_string(r)))
+		return resultError(r)
 	}
 	return nil
 }
@@ -547,3 +2060,32 @@ func Version() (major, minor, patch int) {
 	C.c_dbxml_version(&majorp, &minorp, &patchp)
 	return int(majorp), int(minorp), int(patchp)
 }
+
+// Get the full version strings of DbXml and of the Berkeley DB library it uses.
+//
+// Example:
+//
+//      dbxmlVersion, dbVersion := dbxml.VersionString()
+//      log.Printf("Using %s with %s", dbxmlVersion, dbVersion)
+func VersionString() (dbxmlVersion, berkeleyDBVersion string) {
+	return C.GoString(C.c_dbxml_version_string()), C.GoString(C.c_dbxml_db_version_string())
+}
+
+// Get the format version of the database file.
+//
+// A database with an older format version than the one used by the current DbXml library must be upgraded with Upgrade().
+func (db *Db) ContainerVersion() (int, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return 0, errclosed
+	}
+	var version C.int
+	r := C.c_dbxml_container_version(db.db, &version)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return 0, resultError(r)
+	}
+	return int(version), nil
+}
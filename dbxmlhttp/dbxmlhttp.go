@@ -0,0 +1,262 @@
+// +build cgo
+
+/*
+Package dbxmlhttp provides an http.Handler for querying a DbXml database.
+
+A query is given in the parameter query, with GET or POST. The results are streamed to the client,
+as xml, or as json with the parameter format=json.
+
+Xml output, with the matched subtree of each result, or the value for results that are not nodes:
+
+	<results>
+	  <result name="doc1.xml"><node word="kat"/></result>
+	  <result name="doc2.xml">3</result>
+	  <truncated/>
+	</results>
+
+Json output:
+
+	{"results":[
+	{"name":"doc1.xml","match":"<node word=\"kat\"/>"},
+	{"name":"doc2.xml","value":"3"}
+	],"truncated":true}
+
+If an error occurs before the first result, the response has status 400 for an invalid query,
+504 for a timeout, or 500 for other errors. After that, the error is added at the end of the results,
+as an error element, or as the field "error".
+
+Queries come from the client, and they can do anything an XQuery can do. Unless Config.AllowExternal is set,
+NewHandler() installs a resolver with dbxml.SetResolver() that refuses documents, schemas and external entities,
+and sets dbxml.SetEntityPolicy(dbxml.ForbidEntities), so a query can't read local files or fetch urls
+with doc('file:///etc/passwd') or doc('http://internal/...'). These settings are global, so they apply to
+all databases in the program.
+
+Example:
+
+	db, _ := dbxml.Open("corpus.dbxml")
+	http.Handle("/query", dbxmlhttp.NewHandler(db, dbxmlhttp.Config{MaxResults: 1000, Timeout: 10 * time.Second}))
+	log.Fatal(http.ListenAndServe(":8080", nil))
+*/
+package dbxmlhttp
+
+//. Imports
+
+import (
+	"github.com/pebbe/dbxml"
+
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//. Types
+
+// Limits and settings for a Handler.
+type Config struct {
+	MaxResults     int               // Maximum number of results, 0 = no limit
+	MaxBytes       int               // Maximum number of bytes of the results, 0 = no limit
+	Timeout        time.Duration     // Maximum duration of a query, 0 = no limit
+	MaxQueryLength int               // Maximum length of a query in bytes, 0 = no limit
+	FlushEvery     int               // Flush the output after this many results, 0 = 100
+	Namespaces     []dbxml.Namespace // Namespaces for all queries
+	AllowExternal  bool              // Don't install a resolver that refuses doc(), schemas and external entities
+}
+
+type handler struct {
+	db     *dbxml.Db
+	config Config
+}
+
+type jsonResult struct {
+	Name  string  `json:"name"`
+	Match string  `json:"match,omitempty"`
+	Value *string `json:"value,omitempty"` // nil for nodes, so an empty value is still written
+}
+
+//. Handler
+
+// Create a handler that runs queries on the database.
+//
+// The handler doesn't close the database.
+func NewHandler(db *dbxml.Db, config Config) http.Handler {
+	if config.FlushEvery < 1 {
+		config.FlushEvery = 100
+	}
+	if !config.AllowExternal {
+		dbxml.SetEntityPolicy(dbxml.ForbidEntities)
+		dbxml.SetResolver(refuseExternal)
+	}
+	return &handler{db: db, config: config}
+}
+
+// Resolver that refuses all resources, so queries from clients can't read files or urls.
+func refuseExternal(kind dbxml.Resource, uri string) ([]byte, bool, error) {
+	return nil, false, errors.New("External resource not allowed: " + uri)
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.FormValue("query")
+	if query == "" {
+		http.Error(w, "Missing query", http.StatusBadRequest)
+		return
+	}
+	if h.config.MaxQueryLength > 0 && len(query) > h.config.MaxQueryLength {
+		http.Error(w, "Query too long", http.StatusRequestEntityTooLarge)
+		return
+	}
+	asJSON := r.FormValue("format") == "json"
+
+	// The query is interrupted when the client disconnects
+	ctx := r.Context()
+	if h.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.config.Timeout)
+		defer cancel()
+	}
+
+	docs, err := h.db.QueryContext(ctx, query, h.config.Namespaces...)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer docs.Close()
+	if h.config.MaxBytes > 0 {
+		docs.SetLimits(0, uint64(h.config.MaxBytes))
+	}
+
+	// Get the first result before writing, so an early error can have its own status
+	more := docs.Next()
+	if !more {
+		if err := docs.Error(); err != nil {
+			httpError(w, err)
+			return
+		}
+	}
+
+	if asJSON {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	}
+	flusher, _ := w.(http.Flusher)
+
+	begin(w, asJSON)
+	n := 0
+	truncated := false
+	for more {
+		if h.config.MaxResults > 0 && n == h.config.MaxResults {
+			truncated = true
+			break
+		}
+		name, match, value := docs.Name(), docs.Match(), docs.Value()
+		if errors.Is(docs.Error(), dbxml.ErrLimitExceeded) {
+			break
+		}
+		writeResult(w, asJSON, n, name, match, value)
+		n++
+		if flusher != nil && n%h.config.FlushEvery == 0 {
+			flusher.Flush()
+		}
+		more = docs.Next()
+	}
+	err = docs.Error()
+	if errors.Is(err, dbxml.ErrLimitExceeded) {
+		truncated = true
+		err = nil
+	}
+	end(w, asJSON, truncated, err)
+}
+
+//. Output
+
+func begin(w io.Writer, asJSON bool) {
+	if asJSON {
+		io.WriteString(w, "{\"results\":[\n")
+	} else {
+		io.WriteString(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<results>\n")
+	}
+}
+
+func writeResult(w io.Writer, asJSON bool, i int, name, match, value string) {
+	match = stripDeclaration(match)
+	if asJSON {
+		r := jsonResult{Name: name}
+		if match != "" {
+			r.Match = match
+		} else {
+			r.Value = &value
+		}
+		b, _ := json.Marshal(r)
+		if i > 0 {
+			io.WriteString(w, ",\n")
+		}
+		w.Write(b)
+		return
+	}
+	io.WriteString(w, "  <result name=\"")
+	xml.EscapeText(w, []byte(name))
+	io.WriteString(w, "\">")
+	if match != "" {
+		io.WriteString(w, match)
+	} else {
+		xml.EscapeText(w, []byte(value))
+	}
+	io.WriteString(w, "</result>\n")
+}
+
+func end(w io.Writer, asJSON bool, truncated bool, err error) {
+	if asJSON {
+		io.WriteString(w, "\n]")
+		if truncated {
+			io.WriteString(w, ",\"truncated\":true")
+		}
+		if err != nil {
+			b, _ := json.Marshal(err.Error())
+			io.WriteString(w, ",\"error\":")
+			w.Write(b)
+		}
+		io.WriteString(w, "}\n")
+		return
+	}
+	if truncated {
+		io.WriteString(w, "  <truncated/>\n")
+	}
+	if err != nil {
+		io.WriteString(w, "  <error>")
+		xml.EscapeText(w, []byte(err.Error()))
+		io.WriteString(w, "</error>\n")
+	}
+	io.WriteString(w, "</results>\n")
+}
+
+// A matched document node can start with an xml declaration, which can't be nested
+func stripDeclaration(s string) string {
+	if strings.HasPrefix(s, "<?xml ") {
+		if i := strings.Index(s, "?>"); i > 0 {
+			return strings.TrimLeft(s[i+2:], " \t\r\n")
+		}
+	}
+	return s
+}
+
+func httpError(w http.ResponseWriter, err error) {
+	var qerr *dbxml.QueryError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, dbxml.ErrTimeout):
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+	case errors.As(err, &qerr):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
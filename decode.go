@@ -0,0 +1,54 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+//. Decode
+
+// Decode the current xml document into v, with encoding/xml, after call to docs.Next().
+//
+// Example:
+//
+//      type Sentence struct {
+//          Id   string `xml:"id,attr"`
+//          Text string `xml:"sentence"`
+//      }
+//
+//      for docs.Next() {
+//          var s Sentence
+//          if err := docs.Decode(&s); err != nil {
+//              return err
+//          }
+//          ...
+//      }
+func (docs *Docs) Decode(v interface{}) error {
+	return xml.NewDecoder(strings.NewReader(docs.getNameContent(2))).Decode(v)
+}
+
+// Decode the matched subtree from the current xml document into v, with encoding/xml, after call to docs.Next().
+func (docs *Docs) DecodeMatch(v interface{}) error {
+	return xml.NewDecoder(strings.NewReader(docs.getNameContent(3))).Decode(v)
+}
+
+// Get an xml document by name from the database, and decode it into v, with encoding/xml.
+//
+// The document is decoded while it is retrieved, without reading all of it into memory first.
+func (db *Db) GetInto(name string, v interface{}) error {
+	// Decode while the document is retrieved
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := db.GetTo(name, pw)
+		pw.CloseWithError(err)
+	}()
+	err := xml.NewDecoder(pr).Decode(v)
+	// Stop retrieving if the decoder didn't read all
+	pr.Close()
+	return err
+}
@@ -0,0 +1,121 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+//. Types
+
+// The first record of a dump.
+type dumpHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+// A document in a dump.
+type dumpRecord struct {
+	Name     string         `json:"name"`
+	MetaData []dumpMetaData `json:"metadata,omitempty"`
+	Content  string         `json:"content"`
+}
+
+type dumpMetaData struct {
+	Uri   string `json:"uri"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+//. Variables
+
+const (
+	dumpFormat  = "dbxml-dump"
+	dumpVersion = 1
+)
+
+var (
+	errdump = errors.New("Not a dump of a database")
+)
+
+//. Dump & Load
+
+// Write all documents in the database, with their metadata, to w.
+//
+// The output is a portable archive, that can be restored with Load(),
+// also with a different version of DbXml or on a different architecture.
+// The format is a sequence of JSON objects, one per line: a header, followed by one object per document.
+func (db *Db) Dump(w io.Writer) error {
+	docs, err := db.All()
+	if err != nil {
+		return err
+	}
+	defer docs.Close()
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(dumpHeader{Format: dumpFormat, Version: dumpVersion}); err != nil {
+		return err
+	}
+	for docs.Next() {
+		docs.lock.Lock()
+		md, err := docs.metaData()
+		docs.lock.Unlock()
+		if err != nil {
+			return err
+		}
+		rec := dumpRecord{
+			Name:    docs.Name(),
+			Content: docs.Content(),
+		}
+		for _, m := range md {
+			rec.MetaData = append(rec.MetaData, dumpMetaData{Uri: m.Uri, Name: m.Name, Value: m.Value})
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return docs.Error()
+}
+
+// Create a new database from a dump that was written by db.Dump().
+//
+// The database must not exist yet.
+func Load(r io.Reader, filename string) error {
+	dec := json.NewDecoder(r)
+	var header dumpHeader
+	if err := dec.Decode(&header); err != nil || header.Format != dumpFormat {
+		return errdump
+	}
+	if header.Version > dumpVersion {
+		return errors.New("Dump version not supported")
+	}
+
+	db, err := OpenWithConfig(filename, Config{Creation: Excl})
+	if err != nil {
+		return err
+	}
+	for {
+		var rec dumpRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			db.Close()
+			return err
+		}
+		md := make([]MetaData, len(rec.MetaData))
+		for i, m := range rec.MetaData {
+			md[i] = MetaData{Uri: m.Uri, Name: m.Name, Value: m.Value}
+		}
+		if err := db.PutXmlWithMetaData(rec.Name, rec.Content, md, false); err != nil {
+			db.Close()
+			return err
+		}
+	}
+	return db.CloseErr()
+}
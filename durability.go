@@ -0,0 +1,63 @@
+package dbxml
+
+//. Imports
+
+/*
+#include "c_dbxml.h"
+*/
+import "C"
+
+//. Types
+
+// The durability of commits, set with db.SetDurability().
+type Durability int
+
+//. Constants
+
+const (
+	// Each commit is flushed to disk before it returns. This is the default.
+	Durable Durability = iota
+
+	// Commits are not flushed to disk, until env.Sync() is called,
+	// or the durability is set back to Durable, or the environment is closed.
+	// This is faster for bulk loads, but after a crash, the most recent commits can be lost.
+	NoSync
+)
+
+//. Durability
+
+// Set the durability of commits, for the whole environment of the database.
+//
+// This changes the environment, not just this database: it applies to all databases in the environment,
+// and to their transactions, including bulk loads.
+// It doesn't change what reads see: with both settings, a document is visible to db.Get(), db.Query() and other reads
+// as soon as db.PutXml() or another write operation returns, or when its transaction is committed.
+//
+// This is only used in a transactional environment.
+// Databases that are not transactional are written to disk by db.Sync() and db.Close(), with both settings.
+//
+// Example:
+//
+//      db.SetDurability(dbxml.NoSync)
+//      for _, name := range names {
+//          db.PutXml(name, data[name], false)
+//      }
+//      err := db.SetDurability(dbxml.Durable) // flushes the commits
+func (db *Db) SetDurability(d Durability) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	var nosync C.int
+	if d == NoSync {
+		nosync = 1
+	}
+	r := C.c_dbxml_set_durability(db.db, nosync)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
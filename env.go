@@ -0,0 +1,413 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+//. Types
+
+// A Berkeley DB environment, that can be shared by several databases.
+type Env struct {
+	opened   bool
+	env      C.c_dbxml_env
+	lock     sync.Mutex
+	dbs      map[uint64]*Db
+	counter  uint64
+	queries  map[uint64]*Query
+	qcounter uint64
+	home     string
+	dataDir  string
+}
+
+// A manager for several databases, that can be queried together.
+//
+// A Manager is an Env without a home directory. Its environment is private to this process.
+type Manager struct {
+	*Env
+}
+
+// Options for opening an environment with OpenEnv().
+type EnvConfig struct {
+	// The size of the shared cache in bytes. If 0, the default of Berkeley DB is used.
+	CacheSize uint64
+
+	// The directory for database files, relative to the home directory. If empty, the home directory is used.
+	DataDir string
+
+	// The directory for log files, relative to the home directory. If empty, the home directory is used.
+	LogDir string
+
+	// Make databases opened in the environment transactional, so they can be used with db.Begin().
+	// Write operations outside a transaction are committed on their own.
+	Transactional bool
+
+	// Use multiversion concurrency control. Queries read from a snapshot, so long running queries
+	// don't block write operations, and write operations don't block queries.
+	//
+	// This implies Transactional.
+	// This uses more cache, because pages that are modified during a query are copied.
+	Multiversion bool
+
+	// The maximum time to wait for a lock. If 0, wait forever.
+	// An operation that times out fails with an error for which errors.Is(err, ErrTimeout) is true.
+	// The maximum is about 71 minutes.
+	LockTimeout time.Duration
+
+	// The maximum duration of a transaction. If 0, there is no limit. The maximum is about 71 minutes.
+	// An operation in a transaction that times out fails with an error for which errors.Is(err, ErrTimeout) is true.
+	TxnTimeout time.Duration
+
+	// Join a replication group. If nil, there is no replication.
+	//
+	// This implies Transactional.
+	Replication *ReplicationConfig
+
+	// Share the environment with other processes, such as an ingester and a query server that use the same databases.
+	// All processes must open the environment with the same home directory and with MultiProcess set.
+	//
+	// Each process registers itself with the environment. If a process dies without closing the environment,
+	// the next process that opens it runs recovery. The other processes must then close and reopen the
+	// environment, because their operations fail until they do.
+	//
+	// This implies Transactional, so every write operation can be recovered.
+	MultiProcess bool
+
+	// Encrypt the environment and the databases in it with AES, using this password. If empty, there is no encryption.
+	//
+	// Databases that are created in an encrypted environment are encrypted. An existing environment
+	// can only be opened with the password it was created with.
+	Password string
+
+	// Run recovery when the environment is opened, for instance after a crash. The default is NoRecovery.
+	//
+	// This implies Transactional. No other process may use the environment while it is opened with recovery,
+	// so this can't be combined with MultiProcess, which runs recovery by itself when it is needed.
+	// Progress messages of the recovery are written to stdout, or to the logger set with SetLogger(), as info messages.
+	// If recovery fails, OpenEnv() returns an error that starts with "Recovery failed".
+	Recovery Recovery
+}
+
+// The kind of recovery for EnvConfig.Recovery.
+type Recovery int
+
+const (
+	// Don't run recovery when the environment is opened.
+	NoRecovery Recovery = iota
+
+	// Run normal recovery, which restores the databases to a consistent state from the log files,
+	// after an application or system crash.
+	NormalRecovery
+
+	// Run catastrophic recovery, which replays all log files that are available, for instance
+	// after the database files were restored from a backup, or when normal recovery fails.
+	CatastrophicRecovery
+)
+
+//. Variables
+
+var (
+	errenvclosed = errors.New("Environment is closed")
+	errrecovery  = errors.New("Invalid recovery")
+	errrecovermp = errors.New("Recovery can't be combined with MultiProcess")
+)
+
+//. Open & Close
+
+// Open a Berkeley DB environment.
+//
+// The home directory must exist. The files for the environment are created in this directory.
+//
+// Call env.Close() to ensure all write operations to the databases in the environment are finished,
+// before terminating the program.
+func OpenEnv(home string, config EnvConfig) (*Env, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	env := &Env{
+		dbs:     make(map[uint64]*Db),
+		queries: make(map[uint64]*Query),
+		home:    home,
+		dataDir: config.DataDir,
+	}
+	rhost, rport, rhosts, rports, rrole, rprio, rfree, err := config.Replication.cArgs()
+	if err != nil {
+		return env, err
+	}
+	defer rfree()
+	cshome := C.CString(home)
+	defer C.free(unsafe.Pointer(cshome))
+	csdata := C.CString(config.DataDir)
+	defer C.free(unsafe.Pointer(csdata))
+	cslog := C.CString(config.LogDir)
+	defer C.free(unsafe.Pointer(cslog))
+	cspw, pwfree := passwordCString(config.Password)
+	defer pwfree()
+	var tx, mv, mp C.int
+	if config.Transactional {
+		tx = 1
+	}
+	if config.Multiversion {
+		mv = 1
+	}
+	if config.MultiProcess {
+		mp = 1
+	}
+	if config.Recovery < NoRecovery || config.Recovery > CatastrophicRecovery {
+		return env, errrecovery
+	}
+	if config.MultiProcess && config.Recovery != NoRecovery {
+		return env, errrecovermp
+	}
+	env.env = C.c_dbxml_env_open(cshome, C.ulonglong(config.CacheSize), csdata, cslog, tx, mv,
+		microseconds(config.LockTimeout), microseconds(config.TxnTimeout),
+		rhost, rport, &rhosts[0], &rports[0], rrole, rprio, cspw, mp, C.int(config.Recovery))
+	if C.c_dbxml_env_error(env.env) != 0 {
+		err := envError(env.env)
+		C.c_dbxml_env_free(env.env)
+		return env, err
+	}
+	env.opened = true
+	// No finalizer: the environment and its databases refer to each other, so it would never run
+	return env, nil
+}
+
+// Create a manager for several databases.
+//
+// Call m.Close() to ensure all write operations to the databases are finished, before terminating the program.
+func NewManager() (*Manager, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	env := &Env{
+		dbs:     make(map[uint64]*Db),
+		queries: make(map[uint64]*Query),
+	}
+	env.env = C.c_dbxml_manager_new()
+	if C.c_dbxml_env_error(env.env) != 0 {
+		err := envError(env.env)
+		C.c_dbxml_env_free(env.env)
+		return &Manager{env}, err
+	}
+	env.opened = true
+	// No finalizer: the environment and its databases refer to each other, so it would never run
+	return &Manager{env}, nil
+}
+
+// Open a database in the environment.
+//
+// Like Open(), attempt to open the database in read+write mode. If that fails, open in read-only mode.
+//
+// The database is closed when the environment is closed.
+func (env *Env) OpenContainer(filename string) (*Db, error) {
+	return env.OpenContainerWithConfig(filename, Config{})
+}
+
+// Open a database in the environment, with options.
+//
+// See: OpenWithConfig()
+//
+// The database is closed when the environment is closed.
+func (env *Env) OpenContainerWithConfig(filename string, config Config) (*Db, error) {
+	env.lock.Lock()
+	defer env.lock.Unlock()
+
+	if !env.opened {
+		return &Db{}, errenvclosed
+	}
+	db, err := openWithConfig(env, filename, config)
+	if err != nil {
+		return db, err
+	}
+	db.env = env
+	db.id = env.counter
+	env.counter++
+	env.dbs[db.id] = db
+	return db, nil
+}
+
+// Close the environment, and all databases and queries opened in it.
+//
+// An environment that is not closed stays open until the program ends, even if it is no longer used.
+// Note that teminating the program does not close it.
+func (env *Env) Close() {
+	env.lock.Lock()
+	defer env.lock.Unlock()
+	if env.opened {
+		// Collect all the keys before starting to close, because closing will change the hash
+		keys := make([]uint64, 0, len(env.queries))
+		for key := range env.queries {
+			keys = append(keys, key)
+		}
+		for _, key := range keys {
+			env.queries[key].close()
+		}
+		keys = make([]uint64, 0, len(env.dbs))
+		for key := range env.dbs {
+			keys = append(keys, key)
+		}
+		for _, key := range keys {
+			env.dbs[key].close()
+		}
+		C.c_dbxml_env_free(env.env)
+		env.opened = false
+	}
+}
+
+// Convert a timeout for Berkeley DB, rounded up to whole microseconds.
+func microseconds(d time.Duration) C.uint {
+	if d <= 0 {
+		return 0
+	}
+	us := (d + time.Microsecond - 1) / time.Microsecond
+	if us > math.MaxUint32 {
+		us = math.MaxUint32
+	}
+	return C.uint(us)
+}
+
+// A C copy of a password. The returned function overwrites the copy with zeros before freeing it.
+func passwordCString(password string) (*C.char, func()) {
+	cs := C.CString(password)
+	return cs, func() {
+		b := (*[1 << 30]byte)(unsafe.Pointer(cs))[:len(password):len(password)]
+		for i := range b {
+			b[i] = 0
+		}
+		C.free(unsafe.Pointer(cs))
+	}
+}
+
+// The path of a database file in the environment.
+func (env *Env) dataPath(filename string) string {
+	if filepath.IsAbs(filename) {
+		return filename
+	}
+	if filepath.IsAbs(env.dataDir) {
+		return filepath.Join(env.dataDir, filename)
+	}
+	return filepath.Join(env.home, env.dataDir, filename)
+}
+
+//. Query
+
+// Run an XQUERY over the databases opened in the environment.
+//
+// There is no default collection, unless it was set with env.SetDefaultCollection().
+// A database is referred to by the filename that was used to open it:
+//
+//      docs, err := env.Query(`collection('part1.dbxml')//s | collection('part2.dbxml')//s`)
+func (env *Env) Query(query string, namespaces ...Namespace) (*Docs, error) {
+	q, err := env.Prepare(query, namespaces...)
+	if err != nil {
+		return &Docs{}, err
+	}
+	return q.Run()
+}
+
+// Flush all dirty pages of the environment to disk, and write a checkpoint to the log.
+//
+// After this, recovery only needs the log records written after the checkpoint.
+func (env *Env) Sync() error {
+	env.lock.Lock()
+	defer env.lock.Unlock()
+
+	if !env.opened {
+		return errenvclosed
+	}
+	r := C.c_dbxml_env_sync(env.env)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
+
+// Set the base uri for queries in the environment.
+//
+// See: db.SetBaseURI()
+func (env *Env) SetBaseURI(uri string) error {
+	env.lock.Lock()
+	defer env.lock.Unlock()
+
+	if !env.opened {
+		return errenvclosed
+	}
+	cs := C.CString(uri)
+	defer C.free(unsafe.Pointer(cs))
+	C.c_dbxml_env_set_base_uri(env.env, cs)
+	return nil
+}
+
+// Set the default collection for queries in the environment, so collection() without argument refers to that database.
+//
+// The database is referred to by the filename that was used to open it. An empty string means no default collection.
+// This is used for all queries that are prepared after this call.
+//
+// Example:
+//
+//      err := env.SetDefaultCollection("part1.dbxml")
+//      docs, err := env.Query(`collection()//s | collection('part2.dbxml')//s`)
+func (env *Env) SetDefaultCollection(filename string) error {
+	env.lock.Lock()
+	defer env.lock.Unlock()
+
+	if !env.opened {
+		return errenvclosed
+	}
+	cs := C.CString(filename)
+	defer C.free(unsafe.Pointer(cs))
+	C.c_dbxml_env_set_default_collection(env.env, cs)
+	return nil
+}
+
+// Prepare an XQUERY over the databases opened in the environment.
+//
+// The query can be run multiple times, and a running query can be cancelled by query.Cancel()
+func (env *Env) Prepare(query string, namespaces ...Namespace) (*Query, error) {
+	q := &Query{}
+	env.lock.Lock()
+	defer env.lock.Unlock()
+
+	if !env.opened {
+		return q, errenvclosed
+	}
+	cs := C.CString(query)
+	defer C.free(unsafe.Pointer(cs))
+
+	ns := make([]*C.char, 2*len(namespaces)+1)
+	for i, n := range namespaces {
+		ns[2*i] = C.CString(n.Prefix)
+		ns[2*i+1] = C.CString(n.Uri)
+	}
+
+	q.query = C.c_dbxml_env_prepare_query(env.env, cs, &ns[0])
+
+	for i := range namespaces {
+		C.free(unsafe.Pointer(ns[2*i]))
+		C.free(unsafe.Pointer(ns[2*i+1]))
+	}
+
+	if C.c_dbxml_get_prepared_error(q.query) != 0 {
+		defer C.c_dbxml_query_free(q.query)
+		return q, withQuery(queryError(q.query), query)
+	}
+	// No finalizer: query will be closed when environment gets closed
+	q.opened = true
+	q.env = env
+	q.text = query
+	q.id = env.qcounter
+	env.qcounter++
+	env.queries[q.id] = q
+	return q, nil
+}
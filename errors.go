@@ -0,0 +1,190 @@
+package dbxml
+
+//. Imports
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//. Types
+
+// An error reported by DbXml.
+//
+// Use errors.Is() to check for specific errors:
+//
+//      if errors.Is(err, dbxml.ErrDocumentNotFound) {
+//          ...
+//      }
+type Error struct {
+	Msg     string
+	code    int
+	dberrno int
+}
+
+// An error in a query, with the position of the error in the query.
+//
+// Use errors.As() to get the position:
+//
+//      var qerr *dbxml.QueryError
+//      if errors.As(err, &qerr) {
+//          fmt.Println(qerr.Line, qerr.Column)
+//          fmt.Println(qerr.Excerpt)
+//          fmt.Println(strings.Repeat(" ", qerr.Column-1) + "^")
+//      }
+//
+// The position is in qerr.Query, counting from 1. This is the query as it was prepared, so for db.Query()
+// it includes the implicit collection in front of the query, and for a query built by this package,
+// such as the query in db.QueryDoc(), it is the query that was built.
+type QueryError struct {
+	Line    int    // 0 if unknown
+	Column  int    // 0 if unknown
+	Query   string // The query as it was prepared, including an implicit collection, empty if unknown
+	Excerpt string // The line of the query with the error, empty if unknown
+	Msg     string
+	code    int
+}
+
+// An error in a document that could not be parsed or validated, with the position of the error in the document.
+//
+// Use errors.As() to get the position:
+//
+//      var derr *dbxml.DocumentError
+//      if errors.As(err, &derr) {
+//          fmt.Println(derr.Line, derr.Column)
+//      }
+type DocumentError struct {
+	Line   int // 0 if unknown
+	Column int // 0 if unknown
+	Msg    string
+}
+
+// The error of an iterator that was ended because it exceeded a limit set with query.SetLimits() or docs.SetLimits().
+//
+// Use errors.Is(err, dbxml.ErrLimitExceeded) to check for this error, or errors.As() to get the limit:
+//
+//      var lerr *dbxml.LimitError
+//      if errors.As(docs.Error(), &lerr) {
+//          fmt.Println(lerr.Limit, lerr.Max)
+//      }
+type LimitError struct {
+	Limit string // "results" or "bytes"
+	Max   uint64
+}
+
+// An error of a query run by db.QueryTrace() without a writer, with the trace output of DbXml.
+//
+// Use errors.As() to get the trace:
+//
+//      var terr *dbxml.TraceError
+//      if errors.As(err, &terr) {
+//          fmt.Println(terr.Trace)
+//      }
+type TraceError struct {
+	Err   error
+	Trace string
+}
+
+//. Variables
+
+var (
+	ErrDocumentNotFound  = errors.New("Document not found")
+	ErrDocumentExists    = errors.New("Document exists")
+	ErrContainerClosed   = errors.New("Database is closed")
+	ErrContainerNotFound = errors.New("Database not found")
+	ErrContainerExists   = errors.New("Database exists")
+	ErrInterrupted       = errors.New("Operation interrupted")
+	ErrTimeout           = errors.New("Operation timed out")
+	ErrInvalidDocument   = errors.New("Invalid document")
+	ErrDeadlock          = errors.New("Deadlock")
+	ErrBlobNotFound      = errors.New("Blob not found")
+	ErrLimitExceeded     = errors.New("Limit exceeded")
+)
+
+//. Methods
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// For use with errors.Is()
+func (e *Error) Is(target error) bool {
+	return isCode(e.code, target)
+}
+
+func (e *QueryError) Error() string {
+	return e.Msg
+}
+
+// For use with errors.Is()
+func (e *QueryError) Is(target error) bool {
+	return isCode(e.code, target)
+}
+
+func (e *DocumentError) Error() string {
+	return e.Msg
+}
+
+// For use with errors.Is()
+func (e *DocumentError) Is(target error) bool {
+	return target == ErrInvalidDocument
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("Limit exceeded: more than %d %s", e.Max, e.Limit)
+}
+
+// For use with errors.Is()
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+func (e *TraceError) Error() string {
+	return e.Err.Error()
+}
+
+// For use with errors.Is() and errors.As()
+func (e *TraceError) Unwrap() error {
+	return e.Err
+}
+
+// Add the query to a query error, and the line of the query with the error if the position is known.
+func withQuery(err error, query string) error {
+	qerr, ok := err.(*QueryError)
+	if !ok || query == "" || qerr.Query != "" {
+		return err
+	}
+	qerr.Query = query
+	if qerr.Line > 0 {
+		lines := strings.Split(query, "\n")
+		if qerr.Line <= len(lines) {
+			qerr.Excerpt = strings.TrimRight(lines[qerr.Line-1], "\r")
+		}
+	}
+	return err
+}
+
+func isCode(code int, target error) bool {
+	switch target {
+	case ErrDocumentNotFound:
+		return code == 1
+	case ErrDocumentExists:
+		return code == 2
+	case ErrContainerClosed:
+		return code == 3
+	case ErrContainerNotFound:
+		return code == 4
+	case ErrContainerExists:
+		return code == 5
+	case ErrInterrupted:
+		return code == 8
+	case ErrTimeout:
+		return code == 9
+	case ErrDeadlock:
+		return code == 11
+	case ErrBlobNotFound:
+		return code == 12
+	}
+	return false
+}
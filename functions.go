@@ -0,0 +1,119 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+//. Types
+
+// A Go function that can be called from queries, registered with RegisterFunction().
+//
+// Each argument is a sequence of values, converted to strings.
+// The result is a sequence of strings.
+type Function func(args [][]string) ([]string, error)
+
+//. Variables
+
+var (
+	functions    = make(map[string]uint64)
+	functionLock sync.Mutex
+)
+
+//. Register
+
+// Register a Go function as an XQUERY external function, for all queries in all databases.
+//
+// The function must be declared as external in the query, with the same namespace uri, name and number of arguments:
+//
+//      dbxml.RegisterFunction("http://example.com/ling", "lemma", 1, func(args [][]string) ([]string, error) {
+//          result := make([]string, len(args[0]))
+//          for i, s := range args[0] {
+//              result[i] = lemma(s)
+//          }
+//          return result, nil
+//      })
+//
+//      docs, err := db.QueryRaw(`
+//          declare namespace ling = "http://example.com/ling";
+//          declare function ling:lemma($s as xs:string*) as xs:string* external;
+//          ling:lemma(collection()//node/@word)`)
+//
+// Functions are resolved when a query is prepared. Registering a function with the same
+// uri, name and number of arguments replaces the previous function. A nil function removes it.
+//
+// The function may be called concurrently by different queries. It must not panic.
+func RegisterFunction(uri, name string, nargs int, fn Function) {
+	key := functionKey(uri, name, nargs)
+	functionLock.Lock()
+	defer functionLock.Unlock()
+	if h, ok := functions[key]; ok {
+		freeHandle(h)
+		delete(functions, key)
+	}
+	if fn != nil {
+		functions[key] = newHandle(fn)
+	}
+}
+
+func functionKey(uri, name string, nargs int) string {
+	return fmt.Sprintf("%s\x00%s\x00%d", uri, name, nargs)
+}
+
+//. Callbacks
+
+//export goResolveFunction
+func goResolveFunction(uri, name *C.char, nargs C.int) C.ulonglong {
+	functionLock.Lock()
+	defer functionLock.Unlock()
+	return C.ulonglong(functions[functionKey(C.GoString(uri), C.GoString(name), int(nargs))])
+}
+
+// Arguments and results are strings, each followed by a null byte. Result memory is freed by the caller.
+//
+//export goCallFunction
+func goCallFunction(handle C.ulonglong, args *C.char, size C.ulonglong, counts *C.int, nargs C.int, result **C.char, resultsize *C.ulonglong) C.int {
+	fn, ok := getHandle(uint64(handle)).(Function)
+	if !ok {
+		return setFunctionResult([]byte("External function is no longer registered"), result, resultsize, 1)
+	}
+
+	data := cBytes(unsafe.Pointer(args), int(size))
+	cnts := (*[1 << 28]C.int)(unsafe.Pointer(counts))[:int(nargs):int(nargs)]
+	a := make([][]string, int(nargs))
+	for i, n := range cnts {
+		a[i] = make([]string, int(n))
+		for j := range a[i] {
+			k := bytes.IndexByte(data, 0)
+			a[i][j] = string(data[:k])
+			data = data[k+1:]
+		}
+	}
+
+	values, err := fn(a)
+	if err != nil {
+		return setFunctionResult([]byte(err.Error()), result, resultsize, 1)
+	}
+	var buf bytes.Buffer
+	for _, v := range values {
+		buf.WriteString(v)
+		buf.WriteByte(0)
+	}
+	return setFunctionResult(buf.Bytes(), result, resultsize, 0)
+}
+
+func setFunctionResult(b []byte, result **C.char, resultsize *C.ulonglong, status C.int) C.int {
+	*result = (*C.char)(C.CBytes(b))
+	*resultsize = C.ulonglong(len(b))
+	return status
+}
@@ -0,0 +1,79 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+//. Types
+
+type activeDocs struct {
+	what  string
+	start time.Time
+	stack string
+}
+
+//. Graceful close
+
+// Close the database, after waiting for open iterators to be closed, for at most the timeout.
+//
+// An iterator is closed when docs.Next() returns false for results that are evaluated lazily, or when docs.Close() is called.
+// Other operations that are running are always finished before the database is closed.
+//
+// If iterators are still open after the timeout, the database is not closed, and the error lists the open iterators,
+// with their query and how long they have been open. Call db.Close() to close the database anyway.
+func (db *Db) CloseGracefully(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		db.dlock.Lock()
+		n := len(db.active)
+		db.dlock.Unlock()
+		if n == 0 {
+			return db.CloseErr()
+		}
+		if !time.Now().Before(deadline) {
+			return db.activeError()
+		}
+		wait := time.Until(deadline)
+		if wait > 10*time.Millisecond {
+			wait = 10 * time.Millisecond
+		}
+		time.Sleep(wait)
+	}
+}
+
+func (db *Db) activeError() error {
+	db.dlock.Lock()
+	defer db.dlock.Unlock()
+	now := time.Now()
+	open := make([]string, 0, len(db.active))
+	for _, a := range db.active {
+		open = append(open, fmt.Sprintf("%s (open for %v)", a.what, now.Sub(a.start).Round(time.Millisecond)))
+	}
+	sort.Strings(open)
+	return fmt.Errorf("Database not closed, %d open iterators: %s", len(open), strings.Join(open, "; "))
+}
+
+// Register an open iterator on the database. The iterator is registered by id, not by pointer,
+// so an iterator that is not closed can still be closed by its finalizer.
+func (db *Db) track(docs *Docs, what string) {
+	docs.db = db
+	db.dlock.Lock()
+	db.dcounter++
+	docs.id = db.dcounter
+	db.active[docs.id] = activeDocs{what: what, start: time.Now()}
+	db.trackLeak(docs)
+	db.dlock.Unlock()
+}
+
+func (db *Db) untrack(docs *Docs) {
+	db.dlock.Lock()
+	delete(db.active, docs.id)
+	db.dlock.Unlock()
+}
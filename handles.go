@@ -0,0 +1,39 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"sync"
+)
+
+//. Handles
+
+// Go values that are referred to from C by a numeric handle, for use in callbacks.
+
+var (
+	handles       = make(map[uint64]interface{})
+	handleCounter uint64
+	handleLock    sync.Mutex
+)
+
+func newHandle(v interface{}) uint64 {
+	handleLock.Lock()
+	defer handleLock.Unlock()
+	handleCounter++
+	handles[handleCounter] = v
+	return handleCounter
+}
+
+func getHandle(h uint64) interface{} {
+	handleLock.Lock()
+	defer handleLock.Unlock()
+	return handles[h]
+}
+
+func freeHandle(h uint64) {
+	handleLock.Lock()
+	defer handleLock.Unlock()
+	delete(handles, h)
+}
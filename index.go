@@ -0,0 +1,172 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unsafe"
+)
+
+//. Types
+
+// The indexes of an element or attribute, as returned by db.Indexes().
+type IndexSpec struct {
+	Uri  string
+	Name string
+
+	// Index descriptions, separated by spaces.
+	Index string
+}
+
+//. Constants
+
+const (
+	// The index used by db.Search(), for substring searches in the text of elements.
+	SubstringIndex = "node-element-substring-string"
+)
+
+//. Index
+
+// Add an index to the database.
+//
+// The uri and name are the namespace uri and the local name of the element or attribute.
+// The index is a DbXml index description, for instance "node-element-equality-string".
+//
+// Existing documents are re-indexed, which may take a long time for a large database.
+func (db *Db) AddIndex(uri, name, index string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+
+	csuri := C.CString(uri)
+	defer C.free(unsafe.Pointer(csuri))
+	csname := C.CString(name)
+	defer C.free(unsafe.Pointer(csname))
+	csindex := C.CString(index)
+	defer C.free(unsafe.Pointer(csindex))
+	r := C.c_dbxml_add_index(db.db, csuri, csname, csindex)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
+
+// Check if the database has an index.
+//
+// See: db.AddIndex()
+func (db *Db) HasIndex(uri, name, index string) (bool, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return false, errclosed
+	}
+
+	csuri := C.CString(uri)
+	defer C.free(unsafe.Pointer(csuri))
+	csname := C.CString(name)
+	defer C.free(unsafe.Pointer(csname))
+	csindex := C.CString(index)
+	defer C.free(unsafe.Pointer(csindex))
+	var has C.int
+	r := C.c_dbxml_has_index(db.db, csuri, csname, csindex, &has)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return false, resultError(r)
+	}
+	return has != 0, nil
+}
+
+// Get the index specifications of the database.
+func (db *Db) Indexes() ([]IndexSpec, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return nil, errclosed
+	}
+
+	r := C.c_dbxml_indexes(db.db)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return nil, resultError(r)
+	}
+	b := C.GoBytes(unsafe.Pointer(C.c_dbxml_result_string(r)), C.int(C.c_dbxml_result_size(r)))
+	specs := make([]IndexSpec, 0)
+	for len(b) > 0 {
+		var item [3]string
+		for j := range item {
+			p := bytes.IndexByte(b, 0)
+			item[j] = string(b[:p])
+			b = b[p+1:]
+		}
+		specs = append(specs, IndexSpec{Uri: item[0], Name: item[1], Index: item[2]})
+	}
+	return specs, nil
+}
+
+//. Search
+
+// Find all elements with the given name that contain the substring in their text.
+//
+// The substring index for the element is added to the database if it doesn't exist yet,
+// unless the database was opened read-only. Adding the index can take a long time for a large database.
+//
+// An element name with a prefix needs a namespace for that prefix.
+//
+// Example:
+//
+//      docs, err := db.Search("sentence", "de kat")
+func (db *Db) Search(element, substring string, namespaces ...Namespace) (*Docs, error) {
+	if !validName(element) {
+		return &Docs{}, errelement
+	}
+
+	uri := ""
+	name := element
+	if i := strings.Index(element, ":"); i > 0 {
+		prefix := element[:i]
+		name = element[i+1:]
+		found := false
+		for _, n := range namespaces {
+			if n.Prefix == prefix {
+				uri = n.Uri
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &Docs{}, errors.New("No namespace for prefix " + prefix)
+		}
+	}
+
+	has, err := db.HasIndex(uri, name, SubstringIndex)
+	if err != nil {
+		return &Docs{}, err
+	}
+	if !has && !db.readOnly() {
+		if err := db.AddIndex(uri, name, SubstringIndex); err != nil {
+			return &Docs{}, err
+		}
+	}
+
+	return db.Query("//"+element+"[contains(., "+quoteString(substring)+")]", namespaces...)
+}
+
+func (db *Db) readOnly() bool {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	return db.opened && C.c_dbxml_read_only(db.db) != 0
+}
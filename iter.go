@@ -0,0 +1,77 @@
+//go:build go1.23 && cgo
+// +build go1.23,cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"iter"
+)
+
+//. Iterators
+
+// Iterate over all xml documents that match the XPATH query, as pairs of name and content.
+//
+// Example:
+//
+//      for name, content := range db.Documents(xpath_query) {
+//          fmt.Println(name, content)
+//      }
+//
+// Errors are ignored. Use db.DocumentsErr() if you need them.
+func (db *Db) Documents(query string, namespaces ...Namespace) iter.Seq2[string, string] {
+	seq, _ := db.DocumentsErr(query, namespaces...)
+	return seq
+}
+
+// Iterate over all xml documents that match the XPATH query, as pairs of name and content.
+//
+// The returned function gives the error, if any, after the loop has finished.
+//
+// Example:
+//
+//      docs, errfunc := db.DocumentsErr(xpath_query)
+//      for name, content := range docs {
+//          fmt.Println(name, content)
+//      }
+//      if err := errfunc(); err != nil {
+//          fmt.Println(err)
+//      }
+func (db *Db) DocumentsErr(query string, namespaces ...Namespace) (iter.Seq2[string, string], func() error) {
+	var err error
+	seq := func(yield func(string, string) bool) {
+		err = nil
+		docs, e := db.Query(query, namespaces...)
+		if e != nil {
+			err = e
+			return
+		}
+		defer docs.Close()
+		for docs.Next() {
+			if !yield(docs.Name(), docs.Content()) {
+				return
+			}
+		}
+		err = docs.Error()
+	}
+	return seq, func() error { return err }
+}
+
+// Iterate over all xml documents in the database, as pairs of name and content.
+//
+// Errors are ignored.
+func (db *Db) AllDocuments() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		docs, err := db.All()
+		if err != nil {
+			return
+		}
+		defer docs.Close()
+		for docs.Next() {
+			if !yield(docs.Name(), docs.Content()) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+//. Types
+
+// Options for the conversion of xml to JSON, set with db.SetJSONOptions().
+//
+// An element is converted to an object, with its attributes and child elements as keys. Child elements
+// with the same name are collected in an array. An element without attributes and child elements is
+// converted to a string with its text. Namespace prefixes are dropped.
+//
+// Example, with the default options:
+//
+//      <node cat="np"><node rel="det">de</node><node rel="hd">kat</node></node>
+//
+//      {"node":{"@cat":"np","node":[{"@rel":"det","#text":"de"},{"@rel":"hd","#text":"kat"}]}}
+type JSONOptions struct {
+	// The prefix for attribute names. If empty, "@" is used.
+	AttrPrefix string
+
+	// The key for the text of an element that also has attributes or child elements. If empty, "#text" is used.
+	TextKey string
+
+	// Always put child elements in an array, even if there is only one with that name.
+	AlwaysArray bool
+}
+
+type jsonNode struct {
+	name     string
+	attr     []xml.Attr
+	children []*jsonNode
+	text     strings.Builder
+}
+
+//. JSON
+
+// Set the options for db.QueryJSON().
+func (db *Db) SetJSONOptions(options JSONOptions) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	db.jsonOptions = options
+	return nil
+}
+
+// Run an XPATH query, and return the results as a JSON array.
+//
+// Each matched element is returned as an object with the name of the document and the converted element:
+//
+//      [{"name":"doc1.xml","match":{"sentence":"De kat zit op de mat."}}]
+//
+// For a result that is not an element, such as the result of count(), the object has a value instead:
+//
+//      [{"value":"42"}]
+//
+// See JSONOptions for the conversion of xml to JSON.
+func (db *Db) QueryJSON(query string, namespaces ...Namespace) ([]byte, error) {
+	db.lock.RLock()
+	options := db.jsonOptions
+	db.lock.RUnlock()
+
+	docs, err := db.Query(query, namespaces...)
+	if err != nil {
+		return nil, err
+	}
+	defer docs.Close()
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	first := true
+	for docs.Next() {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		if match := docs.Match(); strings.HasPrefix(match, "<") {
+			var m bytes.Buffer
+			if err := options.convert(&m, strings.NewReader(match)); err == nil {
+				buf.WriteString(`{"name":`)
+				writeJSONString(&buf, docs.Name())
+				buf.WriteString(`,"match":`)
+				buf.Write(m.Bytes())
+				buf.WriteByte('}')
+				continue
+			}
+		}
+		buf.WriteString(`{"value":`)
+		writeJSONString(&buf, docs.Value())
+		buf.WriteByte('}')
+	}
+	if err := docs.Error(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// Convert an xml document to JSON, as an object with the name of the root element as key.
+//
+// See JSONOptions for the conversion.
+func ToJSON(data string, options JSONOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := options.convert(&buf, strings.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//. Conversion
+
+func (o JSONOptions) convert(buf *bytes.Buffer, r io.Reader) error {
+	doc := &jsonNode{}
+	stack := []*jsonNode{doc}
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &jsonNode{name: t.Name.Local, attr: t.Attr}
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			stack[len(stack)-1].text.Write(t)
+		}
+	}
+	if len(doc.children) != 1 {
+		return &DocumentError{Msg: "Document must have exactly one root element"}
+	}
+	root := doc.children[0]
+	buf.WriteByte('{')
+	writeJSONString(buf, root.name)
+	buf.WriteByte(':')
+	o.write(buf, root)
+	buf.WriteByte('}')
+	return nil
+}
+
+func (o JSONOptions) write(buf *bytes.Buffer, n *jsonNode) {
+	text := strings.TrimSpace(n.text.String())
+	if len(n.attr) == 0 && len(n.children) == 0 {
+		writeJSONString(buf, text)
+		return
+	}
+
+	attrPrefix := o.AttrPrefix
+	if attrPrefix == "" {
+		attrPrefix = "@"
+	}
+	textKey := o.TextKey
+	if textKey == "" {
+		textKey = "#text"
+	}
+
+	buf.WriteByte('{')
+	first := true
+	key := func(k string) {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		writeJSONString(buf, k)
+		buf.WriteByte(':')
+	}
+	for _, a := range n.attr {
+		if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+			continue
+		}
+		key(attrPrefix + a.Name.Local)
+		writeJSONString(buf, a.Value)
+	}
+
+	// Child elements grouped by name, in order of first appearance
+	names := make([]string, 0)
+	groups := make(map[string][]*jsonNode)
+	for _, c := range n.children {
+		if _, ok := groups[c.name]; !ok {
+			names = append(names, c.name)
+		}
+		groups[c.name] = append(groups[c.name], c)
+	}
+	for _, name := range names {
+		key(name)
+		group := groups[name]
+		if len(group) == 1 && !o.AlwaysArray {
+			o.write(buf, group[0])
+			continue
+		}
+		buf.WriteByte('[')
+		for i, c := range group {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			o.write(buf, c)
+		}
+		buf.WriteByte(']')
+	}
+
+	if text != "" {
+		key(textKey)
+		writeJSONString(buf, text)
+	}
+	buf.WriteByte('}')
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
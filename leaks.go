@@ -0,0 +1,83 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"runtime"
+	"strings"
+	"time"
+)
+
+//. Types
+
+// An iterator that was garbage collected without being closed, as reported by db.Leaks().
+type Leak struct {
+	// The query, or the method that created the iterator.
+	What string
+
+	// When the iterator was created.
+	Created time.Time
+
+	// The stack trace of the creation of the iterator.
+	Stack string
+}
+
+//. Leak detection
+
+// Enable or disable leak detection for iterators on the database.
+//
+// With leak detection, the stack trace of the creation of each iterator is recorded. An iterator that is garbage collected
+// before it was closed, by docs.Close() or by docs.Next() returning false, is logged as an error, and reported by db.Leaks().
+// This only applies to iterators created after this call. Recording stack traces makes creating iterators slower,
+// so this is meant for debugging.
+//
+// See SetLogger() for where the messages are written.
+func (db *Db) SetLeakDetection(enabled bool) {
+	db.dlock.Lock()
+	db.detectLeaks = enabled
+	db.dlock.Unlock()
+}
+
+// Get the iterators that were garbage collected without being closed, while leak detection was enabled.
+//
+// See: db.SetLeakDetection()
+func (db *Db) Leaks() []Leak {
+	db.dlock.Lock()
+	defer db.dlock.Unlock()
+	return append([]Leak{}, db.leaks...)
+}
+
+// Called by db.track() with the lock held
+func (db *Db) trackLeak(docs *Docs) {
+	if !db.detectLeaks {
+		return
+	}
+	buf := make([]byte, 4096)
+	buf = buf[:runtime.Stack(buf, false)]
+	a := db.active[docs.id]
+	a.stack = string(buf)
+	db.active[docs.id] = a
+	runtime.SetFinalizer(docs, nil)
+	runtime.SetFinalizer(docs, (*Docs).finalize)
+}
+
+func (docs *Docs) finalize() {
+	if docs.opened && docs.db != nil {
+		docs.db.leak(docs)
+	}
+	docs.Close()
+}
+
+func (db *Db) leak(docs *Docs) {
+	db.dlock.Lock()
+	a, ok := db.active[docs.id]
+	if ok {
+		db.leaks = append(db.leaks, Leak{What: a.what, Created: a.start, Stack: a.stack})
+	}
+	db.dlock.Unlock()
+	if ok {
+		logMessage(1, "dbxml: iterator was not closed: "+a.what+"\n"+strings.TrimSpace(a.stack))
+	}
+}
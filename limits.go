@@ -0,0 +1,87 @@
+// +build cgo
+
+package dbxml
+
+//. Types
+
+// The limits of an iterator, and what it has retrieved so far.
+type limits struct {
+	maxResults uint64
+	maxBytes   uint64
+	results    uint64
+	bytes      uint64
+}
+
+//. Limits
+
+// Set limits for the results of the query, used when the query is run with query.Run() after this call.
+//
+// See docs.SetLimits(). A limit of 0 means no limit.
+func (query *Query) SetLimits(maxResults, maxBytes uint64) error {
+	query.lock.Lock()
+	defer query.lock.Unlock()
+
+	if !query.opened {
+		return errqueryclosed
+	}
+	query.limits = limits{maxResults: maxResults, maxBytes: maxBytes}
+	return nil
+}
+
+// Set limits for the iterator, to protect against queries that match much more than expected.
+//
+// If there are more than maxResults results, docs.Next() returns false instead of getting the next result.
+// The bytes are counted when parts of the results are retrieved, by docs.Name(), docs.Content(), docs.Match(),
+// docs.Value(), docs.NextBatch(), docs.NextHits(), or docs.Prefetch(). When the total exceeds maxBytes,
+// the part that crosses the limit is not returned. The results that were retrieved before this call are counted too.
+// A limit of 0 means no limit.
+//
+// When a limit is exceeded, the iterator is closed, and docs.Error() returns a *LimitError.
+//
+// Example:
+//
+//      docs, _ := db.Query("//node[@cat = 'smain']")
+//      docs.SetLimits(10000, 100*1024*1024)
+//      for docs.Next() {
+//          process(docs.Content())
+//      }
+//      if errors.Is(docs.Error(), dbxml.ErrLimitExceeded) {
+//          fmt.Println("Too many results")
+//      }
+func (docs *Docs) SetLimits(maxResults, maxBytes uint64) error {
+	docs.lock.Lock()
+	defer docs.lock.Unlock()
+
+	if !docs.opened {
+		return errdocsclosed
+	}
+	docs.limits.maxResults = maxResults
+	docs.limits.maxBytes = maxBytes
+	return nil
+}
+
+// Count the result that was retrieved, and close the iterator if it is one too many. The caller must hold the lock.
+func (docs *Docs) countResult() bool {
+	if docs.limits.maxResults > 0 && docs.limits.results == docs.limits.maxResults {
+		docs.exceeded(&LimitError{Limit: "results", Max: docs.limits.maxResults})
+		return false
+	}
+	docs.limits.results++
+	return true
+}
+
+// Count the bytes that were retrieved, and close the iterator if they are too many. The caller must hold the lock.
+func (docs *Docs) countBytes(n int) bool {
+	docs.limits.bytes += uint64(n)
+	if docs.limits.maxBytes > 0 && docs.limits.bytes > docs.limits.maxBytes {
+		docs.exceeded(&LimitError{Limit: "bytes", Max: docs.limits.maxBytes})
+		return false
+	}
+	return true
+}
+
+func (docs *Docs) exceeded(err error) {
+	docs.err = err
+	docs.close()
+	docs.started = false
+}
@@ -0,0 +1,268 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sync"
+)
+
+//. Types
+
+// A document to be loaded by loader.Load().
+//
+// The content is read from Reader, or from the file Filename if Reader is nil.
+// If Reader implements io.Closer, it is closed after reading. If Name is empty, Filename is used as name.
+type LoadItem struct {
+	Name     string
+	Filename string
+	Reader   io.Reader
+}
+
+// Options for db.NewLoader().
+type LoaderConfig struct {
+	// The number of goroutines that read and put documents. If 0, runtime.NumCPU() is used.
+	Workers int
+
+	// The number of documents that each worker puts in one transaction. If 0, 1000 is used.
+	//
+	// This is only used for a database in a transactional environment. In other databases
+	// documents are read in parallel, but put into the database, and parsed by DbXml, one at a time.
+	BatchSize int
+
+	// Replace existing documents.
+	Replace bool
+
+	// If not nil, this is called after each batch of documents, with the number of documents loaded
+	// and failed so far. It is called from the worker goroutines, one call at a time.
+	Progress func(loaded, failed uint64)
+}
+
+// A parallel loader of documents, created with db.NewLoader().
+type Loader struct {
+	db     *Db
+	config LoaderConfig
+}
+
+type loadDoc struct {
+	name string
+	data string
+}
+
+type loadState struct {
+	lock   sync.Mutex
+	report PutReport
+	loaded uint64
+	failed uint64
+	err    error
+	cancel func()
+}
+
+//. Loader
+
+// Create a loader that puts documents into the database with a pool of worker goroutines.
+//
+// In a transactional environment, each worker puts its documents in its own transactions of BatchSize documents,
+// retrying after a deadlock. If a transaction fails, for instance because DbXml can't parse a document,
+// its documents are put one at a time, so only the documents that fail are reported.
+func (db *Db) NewLoader(config LoaderConfig) *Loader {
+	if config.Workers <= 0 {
+		config.Workers = runtime.NumCPU()
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1000
+	}
+	return &Loader{db: db, config: config}
+}
+
+// Load all documents from the channel, until the channel is closed or the context is cancelled.
+//
+// Documents that can't be read or put into the database are reported in PutReport.Failed, with the
+// document name as Filename. An error is returned if the context was cancelled, or if the database
+// failed in a way that stopped the load. Documents that were loaded before that remain in the database.
+// After the context is cancelled, no more documents are put, not even those that were already read.
+//
+// Example:
+//
+//      items := make(chan dbxml.LoadItem)
+//      go func() {
+//          for _, filename := range filenames {
+//              items <- dbxml.LoadItem{Filename: filename}
+//          }
+//          close(items)
+//      }()
+//      report, err := db.NewLoader(dbxml.LoaderConfig{Workers: 8}).Load(ctx, items)
+func (l *Loader) Load(ctx context.Context, items <-chan LoadItem) (PutReport, error) {
+	var info ContainerInfo
+	if err := l.db.info(&info); err != nil {
+		return PutReport{}, err
+	}
+	if info.ReadOnly {
+		return PutReport{}, errors.New("Database is read-only")
+	}
+
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	state := &loadState{cancel: cancel}
+
+	var wg sync.WaitGroup
+	for i := 0; i < l.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.work(lctx, items, info.Transactional, state)
+		}()
+	}
+	wg.Wait()
+
+	if state.err != nil {
+		return state.report, state.err
+	}
+	if err := ctx.Err(); err != nil {
+		return state.report, err
+	}
+	return state.report, nil
+}
+
+func (l *Loader) work(ctx context.Context, items <-chan LoadItem, transactional bool, state *loadState) {
+	batch := make([]loadDoc, 0, l.config.BatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			l.putBatch(batch, state)
+			batch = batch[:0]
+		}
+	}
+	defer func() {
+		// after the context is cancelled, the documents of the partial batch are not put
+		if ctx.Err() == nil {
+			flush()
+		}
+	}()
+
+	for {
+		var item LoadItem
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case item, ok = <-items:
+			if !ok {
+				return
+			}
+		}
+
+		doc, err := readLoadItem(item)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			state.add(0, []FileError{{Filename: doc.name, Err: err}}, nil)
+			l.progress(state)
+			continue
+		}
+		if !transactional {
+			if err := l.db.PutXml(doc.name, doc.data, l.config.Replace); err != nil {
+				if errors.Is(err, ErrContainerClosed) {
+					state.add(0, nil, err)
+					return
+				}
+				state.add(0, []FileError{{Filename: doc.name, Err: err}}, nil)
+			} else {
+				state.add(1, nil, nil)
+			}
+			l.progress(state)
+			continue
+		}
+		batch = append(batch, doc)
+		if len(batch) == l.config.BatchSize {
+			flush()
+		}
+	}
+}
+
+// Put a batch in one transaction. If that fails, put the documents one at a time, to find the ones that fail.
+func (l *Loader) putBatch(batch []loadDoc, state *loadState) {
+	err := l.db.WithTxnRetry(func(t *Txn) error {
+		for _, doc := range batch {
+			if err := t.PutXml(doc.name, doc.data, l.config.Replace); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		state.add(uint64(len(batch)), nil, nil)
+		l.progress(state)
+		return
+	}
+	if errors.Is(err, ErrContainerClosed) {
+		state.add(0, nil, err)
+		return
+	}
+
+	var loaded uint64
+	failed := make([]FileError, 0)
+	for _, doc := range batch {
+		err := l.db.WithTxnRetry(func(t *Txn) error {
+			return t.PutXml(doc.name, doc.data, l.config.Replace)
+		})
+		if err != nil {
+			failed = append(failed, FileError{Filename: doc.name, Err: err})
+		} else {
+			loaded++
+		}
+	}
+	state.add(loaded, failed, nil)
+	l.progress(state)
+}
+
+func (l *Loader) progress(state *loadState) {
+	if l.config.Progress == nil {
+		return
+	}
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	l.config.Progress(state.loaded, state.failed)
+}
+
+func (state *loadState) add(loaded uint64, failed []FileError, err error) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.loaded += loaded
+	state.failed += uint64(len(failed))
+	state.report.Put += int(loaded)
+	state.report.Failed = append(state.report.Failed, failed...)
+	if err != nil && state.err == nil {
+		state.err = err
+		state.cancel()
+	}
+}
+
+// Read a document. The name of the document is also returned if there is an error.
+func readLoadItem(item LoadItem) (loadDoc, error) {
+	doc := loadDoc{name: item.Name}
+	if doc.name == "" {
+		doc.name = item.Filename
+	}
+	var b []byte
+	var err error
+	if item.Reader != nil {
+		b, err = ioutil.ReadAll(item.Reader)
+		if c, ok := item.Reader.(io.Closer); ok {
+			c.Close()
+		}
+	} else {
+		b, err = ioutil.ReadFile(item.Filename)
+	}
+	if err != nil {
+		return doc, err
+	}
+	doc.data = string(b)
+	return doc, nil
+}
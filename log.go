@@ -0,0 +1,126 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+//. Types
+
+// Log levels of DbXml, for SetLogLevel(). The values can be combined.
+type LogLevel int
+
+const (
+	LogDebug   LogLevel = 1
+	LogInfo    LogLevel = 2
+	LogWarning LogLevel = 4
+	LogError   LogLevel = 8
+	LogAll     LogLevel = 15
+)
+
+// Log categories of DbXml, for SetLogCategory(). The values can be combined.
+type LogCategory int
+
+const (
+	LogIndexer    LogCategory = 1
+	LogQuery      LogCategory = 2
+	LogOptimizer  LogCategory = 4
+	LogDictionary LogCategory = 8
+	LogContainer  LogCategory = 16
+	LogNodeStore  LogCategory = 32
+	LogManager    LogCategory = 64
+	LogCategories LogCategory = 127
+)
+
+//. Variables
+
+var (
+	// Receives log messages, level 0 = info, 1 = error. If nil, messages are written to stdout and stderr.
+	logFunc func(level int, msg string)
+	logLock sync.RWMutex
+
+	// Receives all log messages while a query is traced by db.QueryTrace()
+	logTrace io.Writer
+
+	// Log levels enabled by SetLogLevel()
+	logLevels LogLevel
+
+	// Log categories enabled by SetLogCategory()
+	logCategories LogCategory
+)
+
+//. Logging
+
+// Enable or disable log levels of DbXml.
+//
+// Messages are written to stdout and stderr, or to the logger set with SetLogger().
+func SetLogLevel(level LogLevel, enabled bool) {
+	enable := C.int(0)
+	if enabled {
+		enable = 1
+	}
+	logLock.Lock()
+	if enabled {
+		logLevels |= level
+	} else {
+		logLevels &^= level
+	}
+	logLock.Unlock()
+	C.c_dbxml_set_log_level(C.int(level), enable)
+}
+
+// Enable or disable log categories of DbXml. Both the level and the category of a message must be enabled for it to be logged.
+func SetLogCategory(category LogCategory, enabled bool) {
+	enable := C.int(0)
+	if enabled {
+		enable = 1
+	}
+	logLock.Lock()
+	if enabled {
+		logCategories |= category
+	} else {
+		logCategories &^= category
+	}
+	logLock.Unlock()
+	C.c_dbxml_set_log_category(C.int(category), enable)
+}
+
+func setLogFunc(f func(level int, msg string)) {
+	logLock.Lock()
+	defer logLock.Unlock()
+	logFunc = f
+}
+
+//. Callbacks
+
+//export goLog
+func goLog(level C.int, msg *C.char) {
+	logMessage(int(level), C.GoString(msg))
+}
+
+// Write a message to the trace, the logger, or stdout or stderr. Level 0 = info, 1 = error.
+func logMessage(level int, s string) {
+	logLock.RLock()
+	f := logFunc
+	trace := logTrace
+	logLock.RUnlock()
+	if trace != nil {
+		fmt.Fprintln(trace, s)
+	} else if f != nil {
+		f(level, s)
+	} else if level == 0 {
+		fmt.Fprintln(os.Stdout, s)
+	} else {
+		fmt.Fprintln(os.Stderr, s)
+	}
+}
@@ -0,0 +1,41 @@
+//go:build go1.21 && cgo
+// +build go1.21,cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+//. Logging
+
+// Send log messages of DbXml and Berkeley DB to a structured logger. If logger is nil, messages are written to stdout and stderr again.
+//
+// Error messages are logged at level slog.LevelError, or slog.LevelWarn if the message is a warning.
+// Other messages are logged at level slog.LevelInfo. Each record has the attribute source="dbxml".
+//
+// Example:
+//
+//      dbxml.SetLogger(slog.Default())
+//      dbxml.SetLogLevel(dbxml.LogInfo, true)
+//      dbxml.SetLogCategory(dbxml.LogQuery, true)
+func SetLogger(logger *slog.Logger) {
+	if logger == nil {
+		setLogFunc(nil)
+		return
+	}
+	setLogFunc(func(level int, msg string) {
+		lvl := slog.LevelInfo
+		if level != 0 {
+			lvl = slog.LevelError
+			if strings.Contains(strings.ToLower(msg), "warning") {
+				lvl = slog.LevelWarn
+			}
+		}
+		logger.Log(context.Background(), lvl, strings.TrimSpace(msg), "source", "dbxml")
+	})
+}
@@ -0,0 +1,442 @@
+package dbxml
+
+//. Imports
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//. Types
+
+// An in-memory database, for testing code that uses the Database interface.
+//
+// This is pure Go, it doesn't need DbXml or cgo. Documents are returned in order of their names.
+//
+// Queries are limited to a subset of XPATH: a path of steps separated by "/" or "//", where each step is
+// an element name or "*", optionally followed by predicates [@attr], [@attr='value'] or [name]:
+//
+//      //sentence
+//      /alpino_ds/node[@cat='smain']//node[@rel='su']
+//
+// Any other query fails with a *QueryError.
+type Memory struct {
+	opened bool
+	lock   sync.RWMutex
+	docs   map[string]string
+}
+
+type memDocs struct {
+	items   []memItem
+	current int
+	opened  bool
+	err     error
+}
+
+type memItem struct {
+	name    string
+	content string
+	match   string
+}
+
+type memNode struct {
+	name     xml.Name
+	attr     []xml.Attr
+	children []*memNode
+	start    int64
+	end      int64
+}
+
+type memStep struct {
+	descendant bool
+	uri        string
+	local      string // "*" for any element
+	preds      []memPred
+}
+
+type memPred struct {
+	attr   bool
+	uri    string
+	local  string
+	value  string
+	hasVal bool
+}
+
+//. Variables
+
+var (
+	errmemnotfound = &Error{Msg: "Document not found", code: 1}
+	errmemexists   = &Error{Msg: "Document exists", code: 2}
+)
+
+//. Open & Close
+
+// Create an empty in-memory database.
+func NewMemory() *Memory {
+	return &Memory{
+		opened: true,
+		docs:   make(map[string]string),
+	}
+}
+
+// Close the database. All documents are discarded.
+func (m *Memory) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.opened = false
+	m.docs = nil
+	return nil
+}
+
+//. Write
+
+// Put an xml document into the database. The document must be well-formed.
+func (m *Memory) PutXml(name string, data string, replace bool) error {
+	if _, err := memParse(data); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.opened {
+		return ErrContainerClosed
+	}
+	if _, ok := m.docs[name]; ok && !replace {
+		return errmemexists
+	}
+	m.docs[name] = data
+	return nil
+}
+
+// Remove an xml document from the database.
+func (m *Memory) Remove(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.opened {
+		return ErrContainerClosed
+	}
+	if _, ok := m.docs[name]; !ok {
+		return errmemnotfound
+	}
+	delete(m.docs, name)
+	return nil
+}
+
+//. Read
+
+// Get an xml document by name from the database.
+func (m *Memory) Get(name string) (string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if !m.opened {
+		return "", ErrContainerClosed
+	}
+	content, ok := m.docs[name]
+	if !ok {
+		return "", errmemnotfound
+	}
+	return content, nil
+}
+
+// Get the number of xml documents in the database.
+func (m *Memory) Size() (uint64, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if !m.opened {
+		return 0, ErrContainerClosed
+	}
+	return uint64(len(m.docs)), nil
+}
+
+// Get all xml documents from the database.
+func (m *Memory) All() (Documents, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if !m.opened {
+		return nil, ErrContainerClosed
+	}
+	items := make([]memItem, 0, len(m.docs))
+	for _, name := range m.names() {
+		items = append(items, memItem{name: name, content: m.docs[name], match: m.docs[name]})
+	}
+	return &memDocs{items: items, current: -1, opened: true}, nil
+}
+
+// Run an XPATH query on the database. See Memory for the supported queries.
+func (m *Memory) Query(query string, namespaces ...Namespace) (Documents, error) {
+	steps, err := memCompile(query, namespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if !m.opened {
+		return nil, ErrContainerClosed
+	}
+	items := make([]memItem, 0)
+	for _, name := range m.names() {
+		content := m.docs[name]
+		root, err := memParse(content)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range memEval(root, steps) {
+			items = append(items, memItem{name: name, content: content, match: content[n.start:n.end]})
+		}
+	}
+	return &memDocs{items: items, current: -1, opened: true}, nil
+}
+
+// Sorted names of the documents. The caller must hold the lock.
+func (m *Memory) names() []string {
+	names := make([]string, 0, len(m.docs))
+	for name := range m.docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//. Iterator
+
+func (d *memDocs) Next() bool {
+	if !d.opened {
+		return false
+	}
+	d.current++
+	if d.current >= len(d.items) {
+		d.opened = false
+		return false
+	}
+	return true
+}
+
+func (d *memDocs) item() memItem {
+	if !d.opened || d.current < 0 {
+		return memItem{}
+	}
+	return d.items[d.current]
+}
+
+func (d *memDocs) Name() string {
+	return d.item().name
+}
+
+func (d *memDocs) Content() string {
+	return d.item().content
+}
+
+func (d *memDocs) Match() string {
+	return d.item().match
+}
+
+// Always empty: queries on the in-memory database only return elements.
+func (d *memDocs) Value() string {
+	return ""
+}
+
+func (d *memDocs) Error() error {
+	return d.err
+}
+
+func (d *memDocs) Close() {
+	d.opened = false
+}
+
+//. Parse
+
+// Parse a document into a tree of elements. Returns a document node with the root element as child.
+func memParse(data string) (*memNode, error) {
+	doc := &memNode{end: int64(len(data))}
+	stack := []*memNode{doc}
+	dec := xml.NewDecoder(strings.NewReader(data))
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			derr := &DocumentError{Msg: err.Error()}
+			var serr *xml.SyntaxError
+			if errors.As(err, &serr) {
+				derr.Line = serr.Line
+			}
+			return nil, derr
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &memNode{name: t.Name, attr: t.Attr, start: offset}
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack[len(stack)-1].end = dec.InputOffset()
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(doc.children) != 1 {
+		return nil, &DocumentError{Msg: "Document must have exactly one root element"}
+	}
+	return doc, nil
+}
+
+//. Query
+
+func memCompile(query string, namespaces []Namespace) ([]memStep, error) {
+	unsupported := func() error {
+		return &QueryError{Msg: "Query not supported by the in-memory database: " + query, code: 6}
+	}
+	resolve := func(qname string) (string, string, bool) {
+		i := strings.Index(qname, ":")
+		if i < 0 {
+			return "", qname, validName(qname)
+		}
+		prefix, local := qname[:i], qname[i+1:]
+		for _, n := range namespaces {
+			if n.Prefix == prefix {
+				return n.Uri, local, validName(local)
+			}
+		}
+		return "", "", false
+	}
+
+	q := strings.TrimSpace(query)
+	if !strings.HasPrefix(q, "/") {
+		return nil, unsupported()
+	}
+	steps := make([]memStep, 0)
+	for q != "" {
+		var step memStep
+		if strings.HasPrefix(q, "//") {
+			step.descendant = true
+			q = q[2:]
+		} else if strings.HasPrefix(q, "/") {
+			q = q[1:]
+		} else {
+			return nil, unsupported()
+		}
+		i := strings.IndexAny(q, "/[")
+		if i < 0 {
+			i = len(q)
+		}
+		name := q[:i]
+		q = q[i:]
+		if name == "*" {
+			step.local = "*"
+		} else {
+			uri, local, ok := resolve(name)
+			if !ok {
+				return nil, unsupported()
+			}
+			step.uri, step.local = uri, local
+		}
+		for strings.HasPrefix(q, "[") {
+			end := strings.Index(q, "]")
+			if end < 0 {
+				return nil, unsupported()
+			}
+			expr := strings.TrimSpace(q[1:end])
+			q = q[end+1:]
+			var pred memPred
+			if strings.HasPrefix(expr, "@") {
+				pred.attr = true
+				expr = expr[1:]
+			}
+			if i := strings.Index(expr, "="); i >= 0 {
+				if !pred.attr {
+					return nil, unsupported()
+				}
+				v := strings.TrimSpace(expr[i+1:])
+				if len(v) < 2 || (v[0] != '\'' && v[0] != '"') || v[len(v)-1] != v[0] {
+					return nil, unsupported()
+				}
+				pred.value = v[1 : len(v)-1]
+				pred.hasVal = true
+				expr = strings.TrimSpace(expr[:i])
+			}
+			uri, local, ok := resolve(expr)
+			if !ok {
+				return nil, unsupported()
+			}
+			pred.uri, pred.local = uri, local
+			step.preds = append(step.preds, pred)
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, unsupported()
+	}
+	return steps, nil
+}
+
+// Evaluate the steps, with the document node as context. Returns elements in document order, without duplicates.
+func memEval(doc *memNode, steps []memStep) []*memNode {
+	context := []*memNode{doc}
+	for _, step := range steps {
+		seen := make(map[*memNode]bool)
+		next := make([]*memNode, 0)
+		var visit func(n *memNode, deep bool)
+		visit = func(n *memNode, deep bool) {
+			for _, c := range n.children {
+				if !seen[c] && step.matches(c) {
+					seen[c] = true
+					next = append(next, c)
+				}
+				if deep {
+					visit(c, true)
+				}
+			}
+		}
+		for _, n := range context {
+			visit(n, step.descendant)
+		}
+		// document order
+		sort.SliceStable(next, func(i, j int) bool { return next[i].start < next[j].start })
+		context = next
+	}
+	return context
+}
+
+func (s memStep) matches(n *memNode) bool {
+	if s.local != "*" && (n.name.Local != s.local || n.name.Space != s.uri) {
+		return false
+	}
+	for _, p := range s.preds {
+		if !p.matches(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p memPred) matches(n *memNode) bool {
+	if p.attr {
+		for _, a := range n.attr {
+			if a.Name.Local == p.local && a.Name.Space == p.uri {
+				return !p.hasVal || a.Value == p.value
+			}
+		}
+		return false
+	}
+	for _, c := range n.children {
+		if c.name.Local == p.local && c.name.Space == p.uri {
+			return true
+		}
+	}
+	return false
+}
+
+// Make sure the in-memory database implements the interface.
+var _ Database = (*Memory)(nil)
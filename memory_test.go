@@ -0,0 +1,262 @@
+package dbxml
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newTestMemory(t *testing.T, docs map[string]string) *Memory {
+	t.Helper()
+	m := NewMemory()
+	for name, data := range docs {
+		if err := m.PutXml(name, data, false); err != nil {
+			t.Fatalf("PutXml(%q): %v", name, err)
+		}
+	}
+	return m
+}
+
+// Names and matches of all results, closing the iterator
+func collect(t *testing.T, docs Documents) (names, matches []string) {
+	t.Helper()
+	defer docs.Close()
+	names = make([]string, 0)
+	matches = make([]string, 0)
+	for docs.Next() {
+		names = append(names, docs.Name())
+		matches = append(matches, docs.Match())
+	}
+	if err := docs.Error(); err != nil {
+		t.Fatalf("Error(): %v", err)
+	}
+	return names, matches
+}
+
+func TestMemoryPutGet(t *testing.T) {
+	m := newTestMemory(t, map[string]string{"a.xml": `<a/>`})
+	defer m.Close()
+
+	if content, err := m.Get("a.xml"); err != nil || content != `<a/>` {
+		t.Errorf("Get: %q, %v", content, err)
+	}
+
+	if err := m.PutXml("a.xml", `<b/>`, false); !errors.Is(err, ErrDocumentExists) {
+		t.Errorf("PutXml existing without replace: %v, want ErrDocumentExists", err)
+	}
+	if content, _ := m.Get("a.xml"); content != `<a/>` {
+		t.Errorf("Content changed without replace: %q", content)
+	}
+	if err := m.PutXml("a.xml", `<b/>`, true); err != nil {
+		t.Errorf("PutXml with replace: %v", err)
+	}
+	if content, _ := m.Get("a.xml"); content != `<b/>` {
+		t.Errorf("Content not replaced: %q", content)
+	}
+
+	var derr *DocumentError
+	if err := m.PutXml("bad.xml", `<a>`, false); !errors.As(err, &derr) {
+		t.Errorf("PutXml malformed: %v, want *DocumentError", err)
+	}
+	if err := m.PutXml("two.xml", `<a/><b/>`, false); !errors.As(err, &derr) {
+		t.Errorf("PutXml two root elements: %v, want *DocumentError", err)
+	}
+
+	if _, err := m.Get("missing.xml"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("Get missing: %v, want ErrDocumentNotFound", err)
+	}
+	if n, err := m.Size(); err != nil || n != 1 {
+		t.Errorf("Size: %d, %v, want 1", n, err)
+	}
+
+	if err := m.Remove("a.xml"); err != nil {
+		t.Errorf("Remove: %v", err)
+	}
+	if err := m.Remove("a.xml"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("Remove missing: %v, want ErrDocumentNotFound", err)
+	}
+	if n, _ := m.Size(); n != 0 {
+		t.Errorf("Size after Remove: %d, want 0", n)
+	}
+}
+
+func TestMemoryAll(t *testing.T) {
+	m := newTestMemory(t, map[string]string{
+		"c.xml": `<c/>`,
+		"a.xml": `<a/>`,
+		"b.xml": `<b/>`,
+	})
+	defer m.Close()
+
+	docs, err := m.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, matches := collect(t, docs)
+	if want := []string{"a.xml", "b.xml", "c.xml"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names: %q, want %q", names, want)
+	}
+	if want := []string{`<a/>`, `<b/>`, `<c/>`}; !reflect.DeepEqual(matches, want) {
+		t.Errorf("matches: %q, want %q", matches, want)
+	}
+}
+
+func TestMemoryIterator(t *testing.T) {
+	m := newTestMemory(t, map[string]string{"a.xml": `<a/>`})
+	defer m.Close()
+
+	docs, err := m.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if docs.Name() != "" {
+		t.Errorf("Name before Next: %q", docs.Name())
+	}
+	if !docs.Next() {
+		t.Fatal("Next: false")
+	}
+	if docs.Name() != "a.xml" || docs.Content() != `<a/>` || docs.Value() != "" {
+		t.Errorf("current: %q, %q, %q", docs.Name(), docs.Content(), docs.Value())
+	}
+	if docs.Next() {
+		t.Error("Next after last: true")
+	}
+	if docs.Name() != "" {
+		t.Errorf("Name after last: %q", docs.Name())
+	}
+
+	docs, _ = m.All()
+	docs.Close()
+	if docs.Next() {
+		t.Error("Next after Close: true")
+	}
+}
+
+func TestMemoryQuery(t *testing.T) {
+	m := newTestMemory(t, map[string]string{
+		"1.xml": `<alpino_ds><node cat="smain"><node rel="su" word="ik"/><node rel="hd" word="loop"/></node></alpino_ds>`,
+		"2.xml": `<alpino_ds><node cat="np"><node rel="det"/></node><sentence>hallo</sentence></alpino_ds>`,
+		"3.xml": `<x:doc xmlns:x="urn:x"><x:item id="1"/><item id="2"/></x:doc>`,
+	})
+	defer m.Close()
+
+	tests := []struct {
+		query      string
+		namespaces []Namespace
+		names      []string
+		matches    []string
+	}{
+		{
+			query:   "/alpino_ds/node[@cat='smain']//node[@rel='su']",
+			names:   []string{"1.xml"},
+			matches: []string{`<node rel="su" word="ik"/>`},
+		},
+		{
+			query:   "//sentence",
+			names:   []string{"2.xml"},
+			matches: []string{`<sentence>hallo</sentence>`},
+		},
+		{
+			query:   `//node[@cat="np"]/node`,
+			names:   []string{"2.xml"},
+			matches: []string{`<node rel="det"/>`},
+		},
+		{
+			query:   "//node[@rel]",
+			names:   []string{"1.xml", "1.xml", "2.xml"},
+			matches: []string{`<node rel="su" word="ik"/>`, `<node rel="hd" word="loop"/>`, `<node rel="det"/>`},
+		},
+		{
+			// document order, without duplicates
+			query:   "//node//node",
+			names:   []string{"1.xml", "1.xml", "2.xml"},
+			matches: []string{`<node rel="su" word="ik"/>`, `<node rel="hd" word="loop"/>`, `<node rel="det"/>`},
+		},
+		{
+			query:   "/alpino_ds[sentence]",
+			names:   []string{"2.xml"},
+			matches: []string{`<alpino_ds><node cat="np"><node rel="det"/></node><sentence>hallo</sentence></alpino_ds>`},
+		},
+		{
+			query:   "/*/*[@id]",
+			names:   []string{"3.xml", "3.xml"},
+			matches: []string{`<x:item id="1"/>`, `<item id="2"/>`},
+		},
+		{
+			query:      "//y:item",
+			namespaces: []Namespace{{Prefix: "y", Uri: "urn:x"}},
+			names:      []string{"3.xml"},
+			matches:    []string{`<x:item id="1"/>`},
+		},
+		{
+			query:   "//item",
+			names:   []string{"3.xml"},
+			matches: []string{`<item id="2"/>`},
+		},
+		{
+			query:   "//node[@cat='ppart']",
+			names:   []string{},
+			matches: []string{},
+		},
+	}
+	for _, tt := range tests {
+		docs, err := m.Query(tt.query, tt.namespaces...)
+		if err != nil {
+			t.Errorf("Query(%q): %v", tt.query, err)
+			continue
+		}
+		names, matches := collect(t, docs)
+		if !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("Query(%q) names: %q, want %q", tt.query, names, tt.names)
+		}
+		if !reflect.DeepEqual(matches, tt.matches) {
+			t.Errorf("Query(%q) matches: %q, want %q", tt.query, matches, tt.matches)
+		}
+	}
+}
+
+func TestMemoryQueryUnsupported(t *testing.T) {
+	m := NewMemory()
+	defer m.Close()
+
+	for _, query := range []string{
+		"",
+		"count(//node)",
+		"node",
+		"//node[1]",
+		"//node[@cat=smain]",
+		"//node[cat='np']",
+		"//node[@cat='np'",
+		"//y:node",
+		"/",
+	} {
+		var qerr *QueryError
+		if _, err := m.Query(query); !errors.As(err, &qerr) {
+			t.Errorf("Query(%q): %v, want *QueryError", query, err)
+		}
+	}
+}
+
+func TestMemoryClosed(t *testing.T) {
+	m := newTestMemory(t, map[string]string{"a.xml": `<a/>`})
+	m.Close()
+
+	if err := m.PutXml("b.xml", `<b/>`, false); !errors.Is(err, ErrContainerClosed) {
+		t.Errorf("PutXml: %v, want ErrContainerClosed", err)
+	}
+	if _, err := m.Get("a.xml"); !errors.Is(err, ErrContainerClosed) {
+		t.Errorf("Get: %v, want ErrContainerClosed", err)
+	}
+	if err := m.Remove("a.xml"); !errors.Is(err, ErrContainerClosed) {
+		t.Errorf("Remove: %v, want ErrContainerClosed", err)
+	}
+	if _, err := m.Size(); !errors.Is(err, ErrContainerClosed) {
+		t.Errorf("Size: %v, want ErrContainerClosed", err)
+	}
+	if _, err := m.All(); !errors.Is(err, ErrContainerClosed) {
+		t.Errorf("All: %v, want ErrContainerClosed", err)
+	}
+	if _, err := m.Query("//a"); !errors.Is(err, ErrContainerClosed) {
+		t.Errorf("Query: %v, want ErrContainerClosed", err)
+	}
+}
@@ -0,0 +1,130 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"time"
+	"unsafe"
+)
+
+//. Types
+
+type mergeState struct {
+	ctx      context.Context
+	progress func(merged uint64)
+}
+
+//. Merge
+
+// Merge a database from disc into this database, like db.Merge(), with progress reporting and cancellation.
+//
+// If progress is not nil, it is called after each document, with the number of documents merged so far.
+// It must not call methods of db.
+// If the context is cancelled, the merge stops and the error of the context is returned.
+// Documents that were merged before that remain in the database.
+//
+// Example:
+//
+//      err := db.MergeContext(ctx, "staging.dbxml", false, func(n uint64) {
+//          if n%10000 == 0 {
+//              fmt.Println(n, "documents merged")
+//          }
+//      })
+func (db *Db) MergeContext(ctx context.Context, filename string, replace bool, progress func(merged uint64)) (err error) {
+	defer db.observe(OpPut, time.Now(), &err)
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	h := newHandle(&mergeState{ctx: ctx, progress: progress})
+	defer freeHandle(h)
+
+	cs := C.CString(filename)
+	defer C.free(unsafe.Pointer(cs))
+	repl := C.int(0)
+	if replace {
+		repl = 1
+	}
+	r := C.c_dbxml_merge_progress(db.db, cs, repl, C.ulonglong(h))
+	defer C.c_dbxml_result_free(r)
+	db.notify(ChangeEvent{Kind: ChangeMany})
+	if C.c_dbxml_result_error(r) != 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return resultError(r)
+	}
+	return nil
+}
+
+// Merge all documents from another open database into this database.
+//
+// The source database can't be modified while the merge is running.
+func (db *Db) MergeFrom(src *Db, replace bool) (err error) {
+	defer db.observe(OpPut, time.Now(), &err)
+	if src == db {
+		return errors.New("Can't merge a database into itself")
+	}
+
+	// Lock in a fixed order, to prevent a deadlock with a merge in the opposite direction
+	if uintptr(unsafe.Pointer(db)) < uintptr(unsafe.Pointer(src)) {
+		db.lock.Lock()
+		defer db.lock.Unlock()
+		src.lock.RLock()
+		defer src.lock.RUnlock()
+	} else {
+		src.lock.RLock()
+		defer src.lock.RUnlock()
+		db.lock.Lock()
+		defer db.lock.Unlock()
+	}
+
+	if !db.opened || !src.opened {
+		return errclosed
+	}
+
+	repl := C.int(0)
+	if replace {
+		repl = 1
+	}
+	r := C.c_dbxml_merge_from(db.db, src.db, repl)
+	defer C.c_dbxml_result_free(r)
+	db.notify(ChangeEvent{Kind: ChangeMany})
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
+
+//. Callbacks
+
+// Returns non-zero to abort the merge.
+//
+//export goMergeProgress
+func goMergeProgress(handle C.ulonglong, count C.ulonglong) C.int {
+	st, ok := getHandle(uint64(handle)).(*mergeState)
+	if !ok {
+		return 1
+	}
+	if st.progress != nil {
+		st.progress(uint64(count))
+	}
+	if st.ctx.Err() != nil {
+		return 1
+	}
+	return 0
+}
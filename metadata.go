@@ -0,0 +1,139 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"bytes"
+	"time"
+	"unsafe"
+)
+
+//. Types
+
+// A metadata item of an xml document.
+//
+// Values are stored and retrieved as strings.
+type MetaData struct {
+	Uri   string
+	Name  string
+	Value string
+}
+
+//. Read
+
+// Get the metadata of the current xml document after call to docs.Next().
+//
+// The previous revisions stored by db.PutXmlVersion() are not included.
+//
+// Example:
+//
+//      for docs.Next() {
+//          md, err := docs.MetaData()
+//          if err != nil {
+//              return err
+//          }
+//          for _, m := range md {
+//              fmt.Println(docs.Name(), m.Name, m.Value)
+//          }
+//      }
+func (docs *Docs) MetaData() ([]MetaData, error) {
+	docs.lock.Lock()
+	defer docs.lock.Unlock()
+
+	all, err := docs.metaData()
+	if err != nil {
+		return all, err
+	}
+	md := make([]MetaData, 0, len(all))
+	for _, m := range all {
+		if m.Uri != versionURI {
+			md = append(md, m)
+		}
+	}
+	return md, nil
+}
+
+// Get all metadata of the current document. The caller must hold the lock.
+func (docs *Docs) metaData() ([]MetaData, error) {
+	md := make([]MetaData, 0)
+	if !(docs.opened && docs.started) {
+		return md, nil
+	}
+	n := int(C.c_dbxml_docs_metadata(docs.docs))
+	if n < 0 {
+		return md, docsError(docs.docs)
+	}
+	if n == 0 {
+		return md, nil
+	}
+	b := C.GoBytes(unsafe.Pointer(C.c_dbxml_docs_batch(docs.docs)), C.int(C.c_dbxml_docs_batch_size(docs.docs)))
+	for i := 0; i < n; i++ {
+		var item [3]string
+		for j := range item {
+			p := bytes.IndexByte(b, 0)
+			item[j] = string(b[:p])
+			b = b[p+1:]
+		}
+		md = append(md, MetaData{Uri: item[0], Name: item[1], Value: item[2]})
+	}
+	return md, nil
+}
+
+//. Write
+
+// Put an xml document from memory into the database, with metadata, in one operation.
+//
+// If replace is true and the document exists, its content and its metadata are replaced.
+// The document never exists without its metadata, not even for a moment.
+//
+// Example:
+//
+//      err := db.PutXmlWithMetaData("doc1.xml", data, []dbxml.MetaData{
+//          {Uri: "http://example.com/annotation", Name: "status", Value: "checked"},
+//      }, true)
+func (db *Db) PutXmlWithMetaData(name, data string, metadata []MetaData, replace bool) (err error) {
+	defer db.observe(OpPut, time.Now(), &err)
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+
+	csname := C.CString(name)
+	defer C.free(unsafe.Pointer(csname))
+	csdata := C.CString(data)
+	defer C.free(unsafe.Pointer(csdata))
+
+	md := make([]*C.char, 3*len(metadata)+1)
+	for i, m := range metadata {
+		md[3*i] = C.CString(m.Uri)
+		md[3*i+1] = C.CString(m.Name)
+		md[3*i+2] = C.CString(m.Value)
+	}
+	defer func() {
+		for i := range metadata {
+			C.free(unsafe.Pointer(md[3*i]))
+			C.free(unsafe.Pointer(md[3*i+1]))
+			C.free(unsafe.Pointer(md[3*i+2]))
+		}
+	}()
+
+	var repl C.int
+	if replace {
+		repl = 1
+	}
+	r := C.c_dbxml_put_xml_metadata(db.db, csname, csdata, &md[0], repl)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	db.notify(ChangeEvent{Kind: ChangePut, Name: name})
+	return nil
+}
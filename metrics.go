@@ -0,0 +1,109 @@
+package dbxml
+
+//. Imports
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//. Types
+
+// An operation on a database, reported to an Observer.
+type Op int
+
+const (
+	OpPut    Op = iota // A call of db.PutXml() or another method that puts, updates, renames or merges documents
+	OpGet              // A call of db.Get(), db.GetBytes(), db.GetMany(), or db.GetTo()
+	OpRemove           // A call of db.Remove(), db.RemoveMany(), or db.RemoveQuery()
+	OpQuery            // Running a query, not including the iteration over the results
+	OpNext             // One result of a query, by docs.Next(), docs.NextBatch(), docs.NextHits(), or a prefetch
+
+	numOps
+)
+
+// A function that is called after each operation on a database, set with db.SetObserver().
+//
+// The function is called from the goroutine that did the operation, so it should return quickly.
+// It must not call methods of the database.
+type Observer func(op Op, d time.Duration, err error)
+
+// Counters of operations on databases, safe for concurrent use.
+//
+// Counters implements expvar.Var, so it can be published as is:
+//
+//      var counters dbxml.Counters
+//      expvar.Publish("dbxml", &counters)
+//      db.SetObserver(counters.Observe)
+type Counters struct {
+	ops [numOps]struct {
+		count  uint64
+		errors uint64
+		nanos  uint64
+	}
+}
+
+//. Variables
+
+var (
+	opNames = [numOps]string{"put", "get", "remove", "query", "next"}
+)
+
+//. Methods
+
+func (op Op) String() string {
+	if op < 0 || op >= numOps {
+		return fmt.Sprintf("Op(%d)", int(op))
+	}
+	return opNames[op]
+}
+
+// Record an operation. This is an Observer.
+func (c *Counters) Observe(op Op, d time.Duration, err error) {
+	if op < 0 || op >= numOps {
+		return
+	}
+	atomic.AddUint64(&c.ops[op].count, 1)
+	atomic.AddUint64(&c.ops[op].nanos, uint64(d))
+	if err != nil {
+		atomic.AddUint64(&c.ops[op].errors, 1)
+	}
+}
+
+// The number of operations of a kind.
+func (c *Counters) Count(op Op) uint64 {
+	if op < 0 || op >= numOps {
+		return 0
+	}
+	return atomic.LoadUint64(&c.ops[op].count)
+}
+
+// The number of operations of a kind that failed.
+func (c *Counters) Errors(op Op) uint64 {
+	if op < 0 || op >= numOps {
+		return 0
+	}
+	return atomic.LoadUint64(&c.ops[op].errors)
+}
+
+// The total duration of operations of a kind.
+func (c *Counters) Duration(op Op) time.Duration {
+	if op < 0 || op >= numOps {
+		return 0
+	}
+	return time.Duration(atomic.LoadUint64(&c.ops[op].nanos))
+}
+
+// The counters as JSON, for expvar.
+//
+//      {"put":{"count":12,"errors":0,"seconds":0.0042},...}
+func (c *Counters) String() string {
+	parts := make([]string, 0, numOps)
+	for op := Op(0); op < numOps; op++ {
+		parts = append(parts, fmt.Sprintf(`"%s":{"count":%d,"errors":%d,"seconds":%g}`,
+			op, c.Count(op), c.Errors(op), c.Duration(op).Seconds()))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
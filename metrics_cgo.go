@@ -0,0 +1,43 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"time"
+)
+
+//. Observer
+
+// Set a function that is called after each operation on the database, for instance to collect metrics.
+//
+// Operations in transactions are not reported. A nil function removes the observer.
+//
+// Example:
+//
+//      db.SetObserver(func(op dbxml.Op, d time.Duration, err error) {
+//          latency.WithLabelValues(op.String()).Observe(d.Seconds())
+//      })
+func (db *Db) SetObserver(observer Observer) {
+	db.observer.Store(observerBox{observer})
+}
+
+// The observer type must be the same for each call of Store()
+type observerBox struct {
+	f Observer
+}
+
+func (db *Db) getObserver() Observer {
+	if b, ok := db.observer.Load().(observerBox); ok {
+		return b.f
+	}
+	return nil
+}
+
+// Report an operation that started at start, with the error at the end of the operation. For use with defer.
+func (db *Db) observe(op Op, start time.Time, err *error) {
+	if f := db.getObserver(); f != nil {
+		f(op, time.Since(start), *err)
+	}
+}
@@ -0,0 +1,209 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+//. Types
+
+// A list of modifications, to be applied to documents with db.ApplyModify().
+//
+// Example:
+//
+//      m := dbxml.NewModify().
+//          InsertAfter("//node[@id='3']", dbxml.Element, "node", "").
+//          Rename("//sentence", "s")
+//      n, err := db.ApplyModify(m, "/alpino_ds[@version='1.3']")
+type Modify struct {
+	steps []modifyStep
+}
+
+type modifyStep struct {
+	kind      int
+	selection string
+	object    Object
+	name      string
+	content   string
+	location  int
+}
+
+// The type of object that is added by a modification.
+type Object int
+
+const (
+	Element Object = iota
+	Attribute
+	Text
+	ProcessingInstruction
+	Comment
+)
+
+//. Build
+
+// Create an empty list of modifications.
+func NewModify() *Modify {
+	return &Modify{
+		steps: make([]modifyStep, 0),
+	}
+}
+
+// Append a new object as the last child of the nodes that match the selection.
+func (m *Modify) Append(selection string, object Object, name, content string) *Modify {
+	return m.AppendAt(selection, object, name, content, -1)
+}
+
+// Append a new object as child of the nodes that match the selection, at the given child position.
+func (m *Modify) AppendAt(selection string, object Object, name, content string, location int) *Modify {
+	m.steps = append(m.steps, modifyStep{kind: 0, selection: selection, object: object, name: name, content: content, location: location})
+	return m
+}
+
+// Insert a new object after the nodes that match the selection.
+func (m *Modify) InsertAfter(selection string, object Object, name, content string) *Modify {
+	m.steps = append(m.steps, modifyStep{kind: 1, selection: selection, object: object, name: name, content: content})
+	return m
+}
+
+// Insert a new object before the nodes that match the selection.
+func (m *Modify) InsertBefore(selection string, object Object, name, content string) *Modify {
+	m.steps = append(m.steps, modifyStep{kind: 2, selection: selection, object: object, name: name, content: content})
+	return m
+}
+
+// Remove the nodes that match the selection.
+func (m *Modify) Remove(selection string) *Modify {
+	m.steps = append(m.steps, modifyStep{kind: 3, selection: selection})
+	return m
+}
+
+// Rename the nodes that match the selection.
+func (m *Modify) Rename(selection, newName string) *Modify {
+	m.steps = append(m.steps, modifyStep{kind: 4, selection: selection, name: newName})
+	return m
+}
+
+// Replace the text content of the nodes that match the selection.
+func (m *Modify) Update(selection, content string) *Modify {
+	m.steps = append(m.steps, modifyStep{kind: 5, selection: selection, content: content})
+	return m
+}
+
+//. Apply
+
+// Apply modifications to all documents that match the XPATH query.
+//
+// Each document that contains at least one match of the query is modified once, and the selections of the
+// modifications are evaluated relative to the document, not to the matching nodes.
+// The modifications are run as one XQuery Update expression, so they are applied at once, to the documents
+// as they were before: a selection doesn't see the changes of the modifications before it.
+// Two modifications of the same node, such as two renames, are an error.
+// If the database is transactional, the modifications are applied in one transaction.
+//
+// The content of a new element is its text content.
+//
+// Returns the number of modifications performed, that is the number of nodes selected by the modifications.
+func (db *Db) ApplyModify(m *Modify, query string, namespaces ...Namespace) (int, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return 0, errclosed
+	}
+	if len(m.steps) == 0 {
+		return 0, nil
+	}
+
+	update, count := m.queries(query)
+	csupdate := C.CString(update)
+	defer C.free(unsafe.Pointer(csupdate))
+	cscount := C.CString(count)
+	defer C.free(unsafe.Pointer(cscount))
+
+	ns := make([]*C.char, 2*len(namespaces)+1)
+	for i, n := range namespaces {
+		ns[2*i] = C.CString(n.Prefix)
+		ns[2*i+1] = C.CString(n.Uri)
+	}
+
+	var n C.ulonglong
+	r := C.c_dbxml_modify(db.db, csupdate, cscount, &ns[0], &n)
+
+	for i := range namespaces {
+		C.free(unsafe.Pointer(ns[2*i]))
+		C.free(unsafe.Pointer(ns[2*i+1]))
+	}
+
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return 0, resultError(r)
+	}
+	if n > 0 {
+		db.notify(ChangeEvent{Kind: ChangeMany})
+	}
+	return int(n), nil
+}
+
+// Build the XQuery Update expression for the modifications, and the query that counts the selected nodes.
+func (m *Modify) queries(query string) (update, count string) {
+	updates := make([]string, len(m.steps))
+	counts := make([]string, len(m.steps))
+	for i, step := range m.steps {
+		sel := "$modify_doc/(" + step.selection + ")"
+		updates[i] = "for $modify_node in " + sel + " return " + step.update()
+		counts[i] = "count(" + sel + ")"
+	}
+	// each document once, in document order, however many nodes in it match the query
+	docs := "for $modify_doc in (collection()" + query + ")/root() return "
+	update = docs + "(" + strings.Join(updates, ", ") + ")"
+	count = "sum(" + docs + "(" + strings.Join(counts, ", ") + "))"
+	return
+}
+
+// The update of the node $modify_node.
+func (step modifyStep) update() string {
+	switch step.kind {
+	case 0:
+		if step.location < 0 || step.object == Attribute {
+			return "insert node " + step.node() + " as last into $modify_node"
+		}
+		child := "$modify_node/node()[" + strconv.Itoa(step.location+1) + "]"
+		return "if (" + child + ") then insert node " + step.node() + " before " + child +
+			" else insert node " + step.node() + " as last into $modify_node"
+	case 1:
+		return "insert node " + step.node() + " after $modify_node"
+	case 2:
+		return "insert node " + step.node() + " before $modify_node"
+	case 3:
+		return "delete node $modify_node"
+	case 4:
+		return "rename node $modify_node as " + quoteString(step.name)
+	}
+	return "replace value of node $modify_node with " + quoteString(step.content)
+}
+
+// A constructor for the new object.
+func (step modifyStep) node() string {
+	name := quoteString(step.name)
+	content := quoteString(step.content)
+	switch step.object {
+	case Attribute:
+		return "attribute {" + name + "} {" + content + "}"
+	case Text:
+		return "text {" + content + "}"
+	case ProcessingInstruction:
+		return "processing-instruction {" + name + "} {" + content + "}"
+	case Comment:
+		return "comment {" + content + "}"
+	}
+	return "element {" + name + "} {" + content + "}"
+}
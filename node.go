@@ -0,0 +1,56 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+//. Node handles
+
+// Get a handle for the matched node, after call to docs.Next().
+//
+// The handle can be used with db.GetNode() to retrieve the node later, without running the query again.
+// A handle stays valid as long as the document is not modified.
+//
+// Returns an empty string if the current item is not a node in the database,
+// such as the result of count(), or an element constructed by the query.
+func (docs *Docs) NodeHandle() string {
+	return docs.getNameContent(5)
+}
+
+// Get a node by a handle that was returned by docs.NodeHandle().
+//
+// Example, a deep link to a sentence:
+//
+//      docs, _ := db.Query(`//sentence[@id="s12"]`)
+//      for docs.Next() {
+//          link := "/node?h=" + url.QueryEscape(docs.NodeHandle())
+//          ...
+//      }
+//
+//      // later
+//      sentence, err := db.GetNode(handle)
+func (db *Db) GetNode(handle string) (string, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return "", errclosed
+	}
+
+	cs := C.CString(handle)
+	defer C.free(unsafe.Pointer(cs))
+	r := C.c_dbxml_get_node(db.db, cs)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return "", resultError(r)
+	}
+	return C.GoString(C.c_dbxml_result_string(r)), nil
+}
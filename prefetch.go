@@ -0,0 +1,116 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"errors"
+)
+
+//. Prefetching
+
+// Retrieve the next k results in the background, while the current result is being processed.
+//
+// A goroutine retrieves results in batches of k, with the name, content, match and value of each result,
+// so the calls to docs.Name(), docs.Content(), docs.Match() and docs.Value() don't need to wait for the database.
+// This is useful when processing a result takes about as much time as retrieving it, for instance when
+// the content is parsed. Since all parts of each result are retrieved, don't use this if you only need the name.
+//
+// After this, don't use docs.NextBatch(), docs.NextHits(), docs.Reset(), docs.NodeHandle() or docs.Query().
+// Iterate until docs.Next() returns false, or call docs.Close(), else the goroutine is never stopped.
+//
+// Example:
+//
+//      docs, _ := db.All()
+//      docs.Prefetch(100)
+//      for docs.Next() {
+//          var v MyType
+//          xml.Unmarshal([]byte(docs.Content()), &v)
+//      }
+//      if err := docs.Error(); err != nil {
+//          fmt.Println(err)
+//      }
+func (docs *Docs) Prefetch(k int) error {
+	docs.lock.Lock()
+	defer docs.lock.Unlock()
+
+	if !docs.opened {
+		return errdocsclosed
+	}
+	if docs.prefetch != nil {
+		return errprefetch
+	}
+	if k < 1 {
+		return errors.New("Prefetch size must be at least 1")
+	}
+	ch := make(chan [][]string)
+	stop := make(chan struct{})
+	docs.prefetch = ch
+	docs.pstop = stop
+	go func() {
+		defer close(ch)
+		for {
+			docs.lock.Lock()
+			batch := docs.nextBatch(k, 2)
+			docs.lock.Unlock()
+			if len(batch) == 0 {
+				return
+			}
+			select {
+			case ch <- batch:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (docs *Docs) nextPrefetched() bool {
+	if docs.pstop == nil {
+		// closed
+		return false
+	}
+	if len(docs.pending) == 0 {
+		batch, ok := <-docs.prefetch
+		if !ok {
+			docs.current = nil
+			return false
+		}
+		docs.pending = batch
+	}
+	docs.current = docs.pending[0]
+	docs.pending = docs.pending[1:]
+	return true
+}
+
+func (docs *Docs) prefetched(what int) string {
+	if docs.current == nil {
+		return ""
+	}
+	switch what {
+	case 1:
+		return docs.current[0]
+	case 2:
+		return docs.output.apply(docs.current[1])
+	case 3:
+		return docs.current[2]
+	case 4:
+		if docs.current[3] == "" {
+			return docs.current[2]
+		}
+		return docs.current[3]
+	}
+	return ""
+}
+
+// Stop the goroutine, the results it retrieved are dropped.
+func (docs *Docs) stopPrefetch() {
+	if docs.pstop != nil {
+		close(docs.pstop)
+		docs.pstop = nil
+		docs.pending = nil
+		docs.current = nil
+	}
+}
@@ -0,0 +1,133 @@
+package dbxml
+
+//. Imports
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//. Query building
+
+// Quote a string as an XPATH/XQUERY string literal, so it can be used safely in a query.
+//
+// Example:
+//
+//      docs, err := db.Query("//node[@word = " + dbxml.Quote(word) + "]")
+func Quote(s string) string {
+	return quoteString(s)
+}
+
+// Build an absolute path from element names, checking each name.
+//
+// A name can have a prefix, and "*" matches any element. An empty name results in "//", for any descendant.
+//
+// Example:
+//
+//      p, err := dbxml.Path("alpino_ds", "", "node") // "/alpino_ds//node"
+func Path(names ...string) (string, error) {
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteByte('/')
+		if name != "" && name != "*" && !validName(name) {
+			return "", errelement
+		}
+		b.WriteString(name)
+	}
+	return b.String(), nil
+}
+
+// Build a query from a template, by replacing the placeholders $1, $2, ... with the arguments as literals.
+//
+// A string is quoted with dbxml.Quote(), numbers are written as numeric literals in parentheses, and a bool as true() or false().
+// Placeholders inside string literals of the template are not replaced. Since a variable name can't start with
+// a digit, placeholders can't be confused with variables.
+//
+// Example:
+//
+//      query, err := dbxml.Format("//node[@rel = $1 and @begin >= $2]", rel, begin)
+func Format(template string, args ...interface{}) (string, error) {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			b.WriteByte(c)
+			continue
+		}
+		if c == '"' || c == '\'' {
+			quote = c
+			b.WriteByte(c)
+			continue
+		}
+		j := i + 1
+		for j < len(template) && template[j] >= '0' && template[j] <= '9' {
+			j++
+		}
+		if c != '$' || j == i+1 {
+			b.WriteByte(c)
+			continue
+		}
+		n, _ := strconv.Atoi(template[i+1 : j])
+		if n < 1 || n > len(args) {
+			return "", fmt.Errorf("No argument for placeholder $%d", n)
+		}
+		lit, err := literal(args[n-1])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(lit)
+		i = j - 1
+	}
+	return b.String(), nil
+}
+
+// Numbers are put in parentheses, so they can't be joined with a preceding name or operator.
+func literal(arg interface{}) (string, error) {
+	switch v := arg.(type) {
+	case string:
+		return quoteString(v), nil
+	case bool:
+		if v {
+			return "true()", nil
+		}
+		return "false()", nil
+	case int:
+		return "(" + strconv.FormatInt(int64(v), 10) + ")", nil
+	case int8:
+		return "(" + strconv.FormatInt(int64(v), 10) + ")", nil
+	case int16:
+		return "(" + strconv.FormatInt(int64(v), 10) + ")", nil
+	case int32:
+		return "(" + strconv.FormatInt(int64(v), 10) + ")", nil
+	case int64:
+		return "(" + strconv.FormatInt(v, 10) + ")", nil
+	case uint:
+		return "(" + strconv.FormatUint(uint64(v), 10) + ")", nil
+	case uint8:
+		return "(" + strconv.FormatUint(uint64(v), 10) + ")", nil
+	case uint16:
+		return "(" + strconv.FormatUint(uint64(v), 10) + ")", nil
+	case uint32:
+		return "(" + strconv.FormatUint(uint64(v), 10) + ")", nil
+	case uint64:
+		return "(" + strconv.FormatUint(v, 10) + ")", nil
+	case float32:
+		return floatLiteral(float64(v))
+	case float64:
+		return floatLiteral(v)
+	}
+	return "", fmt.Errorf("Unsupported argument type %T", arg)
+}
+
+func floatLiteral(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("No literal for %v", f)
+	}
+	return "(" + strconv.FormatFloat(f, 'E', -1, 64) + ")", nil
+}
@@ -0,0 +1,80 @@
+// +build cgo
+
+package dbxml
+
+//. Types
+
+// Settings for queries, that can be reused for many queries with db.QueryWithContext() and db.PrepareWithContext().
+//
+// Example:
+//
+//      qc := &dbxml.QueryContext{
+//          Namespaces: []dbxml.Namespace{{Prefix: "ling", Uri: "http://example.com/ling"}},
+//          Variables:  map[string]string{"rel": "su"},
+//      }
+//      docs, err := db.QueryWithContext(qc, "//node[@rel = $rel]")
+type QueryContext struct {
+	Namespaces []Namespace
+
+	// String values of variables, referred to in queries as $name. The variables don't need to be declared in the query.
+	Variables map[string]string
+
+	// The base uri of the queries. If empty, the base uri set with db.SetBaseURI() is used.
+	BaseURI string
+
+	// How the results are evaluated. The default is Lazy.
+	Evaluation Evaluation
+
+	// The flags for running the queries. If 0, the flags set with db.SetQueryFlags() are used.
+	Flags QueryFlags
+
+	// Prepare queries as with db.PrepareRaw(), without setting the default collection.
+	Raw bool
+
+	// The maximum number of results, and the maximum number of bytes retrieved from the results, of each query.
+	// If 0, there is no limit. See docs.SetLimits().
+	MaxResults uint64
+	MaxBytes   uint64
+}
+
+//. Query context
+
+// Get all xml documents that match the XPATH query from the database, with the settings of the query context.
+//
+// See: db.Query()
+func (db *Db) QueryWithContext(qc *QueryContext, query string) (*Docs, error) {
+	q, err := db.PrepareWithContext(qc, query)
+	if err != nil {
+		return &Docs{}, err
+	}
+	return q.Run()
+}
+
+// Prepare an XPATH query with the settings of the query context.
+//
+// See: db.Prepare()
+func (db *Db) PrepareWithContext(qc *QueryContext, query string) (*Query, error) {
+	q, err := db.prepareContext(query, !qc.Raw, qc.Variables, qc.BaseURI, qc.Namespaces...)
+	if err != nil {
+		return q, err
+	}
+	if qc.Evaluation != Lazy {
+		if err := q.SetEvaluation(qc.Evaluation); err != nil {
+			q.Close()
+			return q, err
+		}
+	}
+	if qc.Flags != 0 {
+		if err := q.SetFlags(qc.Flags); err != nil {
+			q.Close()
+			return q, err
+		}
+	}
+	if qc.MaxResults != 0 || qc.MaxBytes != 0 {
+		if err := q.SetLimits(qc.MaxResults, qc.MaxBytes); err != nil {
+			q.Close()
+			return q, err
+		}
+	}
+	return q, nil
+}
@@ -0,0 +1,53 @@
+package dbxml
+
+//. Imports
+
+/*
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+//. Raw handles
+
+// Get the handle of the database in C, a c_dbxml as declared in c_dbxml.h, or nil if the database is closed.
+//
+// UNSAFE: this is for calling functions from your own cgo code that this package doesn't provide.
+// With the handle, c_dbxml_raw_manager() and c_dbxml_raw_container() give pointers to the
+// DbXml::XmlManager and DbXml::XmlContainer of the database.
+// The handle is only valid until the database is closed. Don't free it, don't close the container through it,
+// and don't use it while other goroutines are writing to the database, since the locks of db are not used.
+//
+// Example, in your own package, with c_dbxml.h from this package in the include path:
+//
+//      // #include "c_dbxml.h"
+//      // #include "mycode.h" // mycode.cc uses DbXml::XmlContainer
+//      import "C"
+//
+//      count := C.my_count_documents(C.c_dbxml_raw_container(C.c_dbxml(db.RawHandle())))
+func (db *Db) RawHandle() unsafe.Pointer {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if !db.opened {
+		return nil
+	}
+	return unsafe.Pointer(db.db)
+}
+
+// Get the handle of the iterator in C, a c_dbxml_docs as declared in c_dbxml.h, or nil if the iterator is closed.
+//
+// UNSAFE: see db.RawHandle(). With the handle, c_dbxml_raw_results() and c_dbxml_raw_value() give pointers
+// to the DbXml::XmlResults and the DbXml::XmlValue of the current result.
+// The handle is only valid until the iterator is closed, which happens when docs.Next() returns false for lazy results.
+// Don't advance the results through the handle, or docs.Next() will skip them.
+func (docs *Docs) RawHandle() unsafe.Pointer {
+	docs.lock.Lock()
+	defer docs.lock.Unlock()
+	if !docs.opened {
+		return nil
+	}
+	return unsafe.Pointer(docs.docs)
+}
@@ -0,0 +1,135 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"unsafe"
+)
+
+//. Types
+
+// Options for a replicated environment, used in EnvConfig.
+//
+// All environments in a replication group have their own home directory, usually on different hosts.
+// Write operations are only allowed in the environment of the master. Changes are sent to the other
+// environments, where they can be queried.
+//
+// Example, a read replica:
+//
+//      env, err := dbxml.OpenEnv("/var/lib/corpus", dbxml.EnvConfig{
+//          Replication: &dbxml.ReplicationConfig{
+//              LocalSite:   "replica1.example.com:6000",
+//              RemoteSites: []string{"master.example.com:6000"},
+//              Role:        dbxml.ReplicationClient,
+//          },
+//      })
+type ReplicationConfig struct {
+	// The address of this environment, as "host:port". Other environments in the group connect to this address.
+	LocalSite string
+
+	// Addresses of other environments in the group, as "host:port", used to join the group.
+	RemoteSites []string
+
+	// The role of this environment in the group.
+	Role ReplicationRole
+
+	// The priority in elections. The environment with the highest priority is most likely to be elected master.
+	// If 0, the default of 100 is used. Only used with role ReplicationElection.
+	Priority int
+}
+
+// The role of an environment in a replication group.
+type ReplicationRole int
+
+const (
+	// Join the group, and call for an election of a master if there is none.
+	ReplicationElection ReplicationRole = iota
+	// Start as master.
+	ReplicationMaster
+	// Start as read replica. The environment is never elected master.
+	ReplicationClient
+)
+
+//. Replication
+
+// Return true if the environment is the master of its replication group, and write operations are allowed.
+//
+// For an environment without replication, this always returns false.
+func (env *Env) IsMaster() bool {
+	env.lock.Lock()
+	defer env.lock.Unlock()
+
+	if !env.opened {
+		return false
+	}
+	return C.c_dbxml_env_is_master(env.env) != 0
+}
+
+// Split "host:port".
+func splitSite(site string) (string, int, error) {
+	host, p, err := net.SplitHostPort(site)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("Invalid port in replication site %q", site)
+	}
+	return host, port, nil
+}
+
+// Arguments for c_dbxml_env_open(). The returned function frees the C strings.
+func (r *ReplicationConfig) cArgs() (host *C.char, port C.uint, hosts []*C.char, ports []C.uint, role, priority C.int, free func(), err error) {
+	var localHost string
+	var localPort int
+	var remoteHosts []string
+	if r != nil {
+		localHost, localPort, err = splitSite(r.LocalSite)
+		if err != nil {
+			return
+		}
+		for _, site := range r.RemoteSites {
+			h, p, e := splitSite(site)
+			if e != nil {
+				err = e
+				return
+			}
+			remoteHosts = append(remoteHosts, h)
+			ports = append(ports, C.uint(p))
+		}
+		switch r.Role {
+		case ReplicationMaster:
+			role, priority = 1, 100
+		case ReplicationClient:
+			role, priority = 2, 0
+		default:
+			role, priority = 0, C.int(r.Priority)
+			if priority <= 0 {
+				priority = 100
+			}
+		}
+	}
+
+	host = C.CString(localHost)
+	hosts = make([]*C.char, len(remoteHosts)+1)
+	for i, h := range remoteHosts {
+		hosts[i] = C.CString(h)
+	}
+	ports = append(ports, 0)
+	free = func() {
+		C.free(unsafe.Pointer(host))
+		for _, h := range hosts[:len(remoteHosts)] {
+			C.free(unsafe.Pointer(h))
+		}
+	}
+	return host, C.uint(localPort), hosts, ports, role, priority, free, nil
+}
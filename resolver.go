@@ -0,0 +1,136 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"sync"
+)
+
+//. Types
+
+// A function that provides the content for a uri, set with SetResolver().
+//
+// If found is false, the uri is resolved by DbXml as usual.
+type Resolver func(kind Resource, uri string) (content []byte, found bool, err error)
+
+// The kind of resource that is resolved by a Resolver.
+type Resource int
+
+const (
+	// A document, as in doc('uri') in a query.
+	DocumentResource Resource = iota
+
+	// A schema, referred to by a document that is validated.
+	SchemaResource
+
+	// An external entity or DTD, referred to by a document. The uri is the system id.
+	EntityResource
+)
+
+// What is done with external entities and DTDs that are not provided by a Resolver, set with SetEntityPolicy().
+type EntityPolicy int
+
+const (
+	// External entities and DTDs are loaded by DbXml, from files or from the network. This is the default.
+	AllowEntities EntityPolicy = iota
+
+	// Loading an external entity or DTD is an error, so the document is not stored, or the query fails.
+	ForbidEntities
+
+	// External entities and DTDs are replaced by empty content. A document that uses an entity
+	// declared in an external DTD is not well-formed with this policy.
+	IgnoreEntities
+)
+
+//. Variables
+
+var (
+	resolver     Resolver
+	entityPolicy EntityPolicy
+	resolverLock sync.Mutex
+)
+
+//. Set
+
+// Set a function that resolves documents, schemas and entities by uri, for all databases.
+//
+// Example, resolve from an embedded filesystem:
+//
+//      //go:embed schemas
+//      var schemas embed.FS
+//
+//      dbxml.SetResolver(func(kind dbxml.Resource, uri string) ([]byte, bool, error) {
+//          if kind != dbxml.SchemaResource {
+//              return nil, false, nil
+//          }
+//          b, err := schemas.ReadFile("schemas/" + path.Base(uri))
+//          if err != nil {
+//              return nil, false, nil
+//          }
+//          return b, true, nil
+//      })
+//
+// A nil function removes the resolver. The function may be called concurrently. It must not panic.
+func SetResolver(r Resolver) {
+	resolverLock.Lock()
+	defer resolverLock.Unlock()
+	resolver = r
+}
+
+// Set what is done with external entities and DTDs when documents are parsed, for all databases.
+//
+// This is used when documents are put into a database, and when documents are read by a query, as in doc('uri').
+// Entities provided by the Resolver set with SetResolver() are always used, so with ForbidEntities
+// you can still supply local copies of the DTDs that you trust.
+//
+// Example, for xml from untrusted sources, with a local copy of one DTD:
+//
+//      dbxml.SetEntityPolicy(dbxml.ForbidEntities)
+//      dbxml.SetResolver(func(kind dbxml.Resource, uri string) ([]byte, bool, error) {
+//          if kind == dbxml.EntityResource && path.Base(uri) == "alpino_ds.dtd" {
+//              b, err := ioutil.ReadFile("/usr/local/share/alpino/alpino_ds.dtd")
+//              return b, err == nil, err
+//          }
+//          return nil, false, nil
+//      })
+func SetEntityPolicy(p EntityPolicy) {
+	resolverLock.Lock()
+	defer resolverLock.Unlock()
+	entityPolicy = p
+}
+
+//. Callbacks
+
+// Returns 0 if not found, 1 if found, 2 on error. Result memory is freed by the caller.
+//
+//export goResolve
+func goResolve(kind C.int, uri *C.char, result **C.char, resultsize *C.ulonglong) C.int {
+	resolverLock.Lock()
+	r := resolver
+	policy := entityPolicy
+	resolverLock.Unlock()
+	if r != nil {
+		content, found, err := r(Resource(kind), C.GoString(uri))
+		if err != nil {
+			return setFunctionResult([]byte(err.Error()), result, resultsize, 2)
+		}
+		if found {
+			return setFunctionResult(content, result, resultsize, 1)
+		}
+	}
+	if Resource(kind) == EntityResource {
+		switch policy {
+		case ForbidEntities:
+			return setFunctionResult([]byte("External entity forbidden: "+C.GoString(uri)), result, resultsize, 2)
+		case IgnoreEntities:
+			return setFunctionResult([]byte{}, result, resultsize, 1)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+//. Sequences
+
+// Get the next value of a named sequence. The first value is 1.
+//
+// Sequences are stored in a separate file next to the database, with ".seq" appended to its filename.
+// There may be gaps. In a transactional database, each value is committed before it is returned, so values
+// are never handed out twice, even after a crash, unless db.SetDurability() was called with NoSync.
+// In a database that is not transactional, the sequence is only written to disk by db.Sync() and db.Close(),
+// so after a crash, values that were handed out since then can be handed out again.
+//
+// Example, unique names for new documents:
+//
+//      n, err := db.NextSequence("doc")
+//      if err == nil {
+//          err = db.PutXml(fmt.Sprintf("doc%08d.xml", n), data, false)
+//      }
+func (db *Db) NextSequence(name string) (uint64, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return 0, errclosed
+	}
+
+	// Sequences are opened when first used, this must not run concurrently
+	db.slock.Lock()
+	defer db.slock.Unlock()
+
+	cs := C.CString(name)
+	defer C.free(unsafe.Pointer(cs))
+	var value C.ulonglong
+	r := C.c_dbxml_next_sequence(db.db, cs, &value)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return 0, resultError(r)
+	}
+	return uint64(value), nil
+}
@@ -0,0 +1,178 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+//. Types
+
+// Options for the output of xml documents, set with db.SetSerialization().
+//
+// The encoding of the content is not changed.
+type Serialization struct {
+	// Indent nested elements with this string, for instance "  ". If empty, the content is not reformatted.
+	//
+	// Whitespace-only text between elements is replaced. Elements that contain text, elements without
+	// child elements, and elements with xml:space="preserve" are kept as they are. Markup, entities and
+	// the xml declaration are not rewritten.
+	Indent string
+
+	// Remove the xml declaration at the start of the document.
+	OmitDeclaration bool
+}
+
+//. Apply
+
+func (s Serialization) isDefault() bool {
+	return s.Indent == "" && !s.OmitDeclaration
+}
+
+// Apply the serialization options to the content of a document.
+// If the content can't be parsed, it is returned unchanged.
+func (s Serialization) apply(content string) string {
+	if s.isDefault() {
+		return content
+	}
+	if s.OmitDeclaration {
+		content = omitDeclaration(content)
+	}
+	if s.Indent != "" {
+		if c, err := indent(content, s.Indent); err == nil {
+			content = c
+		}
+	}
+	return content
+}
+
+func omitDeclaration(content string) string {
+	c := strings.TrimLeft(content, " \t\r\n")
+	if !strings.HasPrefix(c, "<?xml") {
+		return content
+	}
+	i := strings.Index(c, "?>")
+	if i < 0 {
+		return content
+	}
+	return strings.TrimLeft(c[i+2:], " \t\r\n")
+}
+
+// A token of the content, with the text it was parsed from.
+type rawToken struct {
+	t        xml.Token
+	raw      string
+	end      int  // for a start element: the index of its end element
+	verbatim bool // for a start element: its content is kept as it is
+}
+
+func indent(content, indent string) (string, error) {
+	tokens, err := rawTokens(content)
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	newline := func(depth int) {
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+			buf.WriteString(strings.Repeat(indent, depth))
+		}
+	}
+	depth := 0
+	for i := 0; i < len(tokens); i++ {
+		tk := tokens[i]
+		switch tk.t.(type) {
+		case xml.CharData:
+			// only whitespace between elements and in the prolog gets here
+			if strings.TrimSpace(tk.raw) != "" {
+				buf.WriteString(tk.raw)
+			}
+			continue
+		case xml.StartElement:
+			newline(depth)
+			if tk.verbatim {
+				for j := i; j <= tk.end; j++ {
+					buf.WriteString(tokens[j].raw)
+				}
+				i = tk.end
+				continue
+			}
+			depth++
+		case xml.EndElement:
+			// an element that isn't kept as it is has child elements, so the end tag goes on a line of its own
+			depth--
+			newline(depth)
+		default:
+			newline(depth)
+		}
+		buf.WriteString(tk.raw)
+	}
+	return buf.String(), nil
+}
+
+// Split the content into tokens, and find the elements that must not be reformatted:
+// elements with text content, elements without child elements, and elements with xml:space="preserve".
+func rawTokens(content string) ([]rawToken, error) {
+	dec := xml.NewDecoder(strings.NewReader(content))
+	dec.Strict = false
+	// the text of each token is copied as it is, so it doesn't need to be converted from its encoding
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	tokens := make([]rawToken, 0)
+	open := make([]int, 0)
+	children := make([]bool, 0)
+	var offset int64
+	for {
+		// RawToken, because Token would check and rewrite namespace prefixes
+		t, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		next := dec.InputOffset()
+		tk := rawToken{t: xml.CopyToken(t), raw: content[offset:next]}
+		offset = next
+		switch tt := t.(type) {
+		case xml.StartElement:
+			if len(open) > 0 {
+				children[len(children)-1] = true
+			}
+			for _, a := range tt.Attr {
+				if a.Name.Space == "xml" && a.Name.Local == "space" && a.Value == "preserve" {
+					tk.verbatim = true
+				}
+			}
+			open = append(open, len(tokens))
+			children = append(children, false)
+		case xml.EndElement:
+			if len(open) == 0 {
+				return nil, errors.New("Unexpected end element")
+			}
+			start := open[len(open)-1]
+			tokens[start].end = len(tokens)
+			if !children[len(children)-1] {
+				tokens[start].verbatim = true
+			}
+			open = open[:len(open)-1]
+			children = children[:len(children)-1]
+		case xml.CharData:
+			if len(open) > 0 && strings.TrimSpace(tk.raw) != "" {
+				tokens[open[len(open)-1]].verbatim = true
+			}
+		}
+		tokens = append(tokens, tk)
+	}
+	if len(open) > 0 {
+		return nil, errors.New("Unexpected end of content")
+	}
+	return tokens, nil
+}
@@ -0,0 +1,212 @@
+package dbxml
+
+//. Imports
+
+import (
+	"errors"
+	"hash/fnv"
+)
+
+//. Types
+
+// A set of databases that is used as one database, with the documents distributed over the databases by name.
+//
+// This implements Database. Each document is stored in the shard that is selected by a hash of its name,
+// so db.Get() and db.Remove() use only one shard, while db.All() and db.Query() use all shards.
+// Results of db.All() and db.Query() are given shard by shard, so there is no order across shards.
+//
+// The number and the order of the shards must be the same each time the set is opened,
+// or documents will not be found.
+type ShardedDb struct {
+	shards []Database
+}
+
+type shardedDocs struct {
+	docs []Documents
+	i    int
+	err  error
+}
+
+//. Open & Close
+
+// Open a set of databases as a ShardedDb, creating databases that don't exist, like OpenDatabase().
+//
+// Example:
+//
+//      db, err := dbxml.OpenSharded("corpus-0.dbxml", "corpus-1.dbxml", "corpus-2.dbxml", "corpus-3.dbxml")
+func OpenSharded(filenames ...string) (*ShardedDb, error) {
+	if len(filenames) == 0 {
+		return nil, errors.New("No shards")
+	}
+	shards := make([]Database, 0, len(filenames))
+	for _, filename := range filenames {
+		db, err := OpenDatabase(filename)
+		if err != nil {
+			for _, s := range shards {
+				s.Close()
+			}
+			return nil, err
+		}
+		shards = append(shards, db)
+	}
+	return &ShardedDb{shards: shards}, nil
+}
+
+// Use open databases as a ShardedDb, for instance databases opened in an environment with env.OpenContainer() and AsDatabase().
+func NewSharded(shards ...Database) (*ShardedDb, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("No shards")
+	}
+	return &ShardedDb{shards: append([]Database{}, shards...)}, nil
+}
+
+// Close all shards. Returns the first error, if any.
+func (db *ShardedDb) Close() error {
+	var err error
+	for _, s := range db.shards {
+		if e := s.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+//. Shards
+
+// Get the shards, in the order in which they were given.
+func (db *ShardedDb) Shards() []Database {
+	return append([]Database{}, db.shards...)
+}
+
+// Get the shard in which a document with this name is stored.
+func (db *ShardedDb) Shard(name string) Database {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return db.shards[h.Sum32()%uint32(len(db.shards))]
+}
+
+//. Read & Write
+
+// Put an xml document into its shard.
+func (db *ShardedDb) PutXml(name string, data string, replace bool) error {
+	return db.Shard(name).PutXml(name, data, replace)
+}
+
+// Get an xml document by name from its shard.
+func (db *ShardedDb) Get(name string) (string, error) {
+	return db.Shard(name).Get(name)
+}
+
+// Remove an xml document from its shard.
+func (db *ShardedDb) Remove(name string) error {
+	return db.Shard(name).Remove(name)
+}
+
+// Get the number of xml documents in all shards.
+func (db *ShardedDb) Size() (uint64, error) {
+	var size uint64
+	for _, s := range db.shards {
+		n, err := s.Size()
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	return size, nil
+}
+
+// Get all xml documents from all shards.
+func (db *ShardedDb) All() (Documents, error) {
+	return db.fanOut(func(s Database) (Documents, error) {
+		return s.All()
+	})
+}
+
+// Run an XPATH query on all shards.
+//
+// The query is run on each shard separately, so a query that combines documents, such as count(collection()//node),
+// gives a result for each shard.
+func (db *ShardedDb) Query(query string, namespaces ...Namespace) (Documents, error) {
+	return db.fanOut(func(s Database) (Documents, error) {
+		return s.Query(query, namespaces...)
+	})
+}
+
+// Start the iterators on all shards first, so errors in a query are returned at once.
+func (db *ShardedDb) fanOut(start func(Database) (Documents, error)) (Documents, error) {
+	docs := &shardedDocs{docs: make([]Documents, 0, len(db.shards))}
+	for _, s := range db.shards {
+		d, err := start(s)
+		if err != nil {
+			docs.Close()
+			return nil, err
+		}
+		docs.docs = append(docs.docs, d)
+	}
+	return docs, nil
+}
+
+//. Iterator
+
+func (docs *shardedDocs) Next() bool {
+	for docs.i < len(docs.docs) {
+		d := docs.docs[docs.i]
+		if d.Next() {
+			return true
+		}
+		if err := d.Error(); err != nil {
+			docs.err = err
+			docs.Close()
+			return false
+		}
+		d.Close()
+		docs.i++
+	}
+	return false
+}
+
+func (docs *shardedDocs) current() Documents {
+	if docs.i < len(docs.docs) {
+		return docs.docs[docs.i]
+	}
+	return nil
+}
+
+func (docs *shardedDocs) Name() string {
+	if d := docs.current(); d != nil {
+		return d.Name()
+	}
+	return ""
+}
+
+func (docs *shardedDocs) Content() string {
+	if d := docs.current(); d != nil {
+		return d.Content()
+	}
+	return ""
+}
+
+func (docs *shardedDocs) Match() string {
+	if d := docs.current(); d != nil {
+		return d.Match()
+	}
+	return ""
+}
+
+func (docs *shardedDocs) Value() string {
+	if d := docs.current(); d != nil {
+		return d.Value()
+	}
+	return ""
+}
+
+func (docs *shardedDocs) Error() error {
+	return docs.err
+}
+
+func (docs *shardedDocs) Close() {
+	for _, d := range docs.docs[docs.i:] {
+		d.Close()
+	}
+	docs.i = len(docs.docs)
+}
@@ -0,0 +1,79 @@
+// +build cgo
+
+package dbxml
+
+//. Types
+
+// A stable view of the database, as it was when db.Snapshot() was called.
+//
+// Reads from the view don't see changes by other goroutines or processes, and don't block them.
+// Like a transaction, a view must be used by one goroutine at a time.
+type SnapshotView struct {
+	t *Txn
+}
+
+//. Snapshot
+
+// Get a stable view of the database, for reads that must not see changes made while they run, such as an export.
+//
+// The view is a transaction with Snapshot isolation, so the database must be opened in an environment
+// that was opened with EnvConfig.Multiversion. Close the view when done with it. Until then, pages that
+// are modified by others are copied, so a view that is kept open for a long time uses more cache.
+//
+// Example:
+//
+//      view, err := db.Snapshot()
+//      if err != nil {
+//          return err
+//      }
+//      defer view.Close()
+//      docs, err := view.All()
+func (db *Db) Snapshot() (*SnapshotView, error) {
+	t, err := db.BeginIsolation(Snapshot)
+	if err != nil {
+		return &SnapshotView{}, err
+	}
+	return &SnapshotView{t: t}, nil
+}
+
+// Get an xml document by name, as it was when the view was created.
+//
+// See: db.Get()
+func (v *SnapshotView) Get(name string) (string, error) {
+	if v.t == nil {
+		return "", errtxnclosed
+	}
+	s, output, err := v.t.get(name)
+	if err != nil {
+		return "", err
+	}
+	return output.apply(s), nil
+}
+
+// Run an XPATH query on the view. Iterate the results before the view is closed.
+//
+// See: db.Query()
+func (v *SnapshotView) Query(query string, namespaces ...Namespace) (*Docs, error) {
+	if v.t == nil {
+		return &Docs{}, errtxnclosed
+	}
+	return v.t.Query(query, namespaces...)
+}
+
+// Get all xml documents in the view. Iterate the results before the view is closed.
+//
+// See: db.All()
+func (v *SnapshotView) All() (*Docs, error) {
+	if v.t == nil {
+		return &Docs{}, errtxnclosed
+	}
+	return v.t.All()
+}
+
+// Close the view.
+func (v *SnapshotView) Close() error {
+	if v.t == nil {
+		return errtxnclosed
+	}
+	return v.t.Commit()
+}
@@ -0,0 +1,227 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+//. Types
+
+// The content of an xml document, in memory that is not managed by Go.
+//
+// Call ref.Free() when you're done with it. The memory is not released on garbage collection, because
+// slices returned by ref.Bytes() may still refer to it.
+type ContentRef struct {
+	r      C.c_dbxml_result
+	opened bool
+	lock   sync.Mutex
+}
+
+type reader struct {
+	r   io.Reader
+	err error
+}
+
+//. Variables
+
+var (
+	errnodoc = errors.New("No current document")
+)
+
+//. Write
+
+// Put an xml document from an io.Reader into the database.
+//
+// The document is read while it is stored, without reading all of it into memory first.
+// If reading fails, the error of the reader is returned, and nothing is stored. With replace,
+// the existing document is kept in that case.
+//
+// The reader must not use the database.
+func (db *Db) PutReader(name string, r io.Reader, replace bool) (err error) {
+	defer db.observe(OpPut, time.Now(), &err)
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+
+	rd := &reader{r: r}
+	h := newHandle(rd)
+	defer freeHandle(h)
+
+	cs := C.CString(name)
+	defer C.free(unsafe.Pointer(cs))
+	repl := C.int(0)
+	if replace {
+		repl = 1
+	}
+	result := C.c_dbxml_put_reader(db.db, cs, C.ulonglong(h), repl)
+	defer C.c_dbxml_result_free(result)
+	if C.c_dbxml_result_error(result) != 0 {
+		if rd.err != nil {
+			return rd.err
+		}
+		return resultError(result)
+	}
+	db.notify(ChangeEvent{Kind: ChangePut, Name: name})
+	return nil
+}
+
+//. Read
+
+// Write an xml document from the database to an io.Writer.
+//
+// The document is written while it is retrieved, without reading all of it into memory first.
+//
+// The writer must not use the database.
+func (db *Db) GetTo(name string, w io.Writer) (size int64, err error) {
+	defer db.observe(OpGet, time.Now(), &err)
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return 0, errclosed
+	}
+
+	cs := C.CString(name)
+	defer C.free(unsafe.Pointer(cs))
+
+	s := C.c_dbxml_get_stream(db.db, cs)
+	defer C.c_dbxml_stream_free(s)
+	return writeStream(s, w)
+}
+
+// Write the content of the current xml document to an io.Writer.
+//
+// This is like docs.Content(), but without reading all of the document into memory first.
+// If the current item is not an xml document, nothing is written.
+func (docs *Docs) WriteContentTo(w io.Writer) (int64, error) {
+	docs.lock.Lock()
+	defer docs.lock.Unlock()
+	if !(docs.opened && docs.started) {
+		return 0, errnodoc
+	}
+
+	s := C.c_dbxml_docs_content_stream(docs.docs)
+	defer C.c_dbxml_stream_free(s)
+	return writeStream(s, w)
+}
+
+// Get the content of the current xml document, without copying it into memory managed by Go.
+//
+// If the current item is not an xml document, the content is empty.
+func (docs *Docs) ContentRef() (*ContentRef, error) {
+	docs.lock.Lock()
+	defer docs.lock.Unlock()
+	if !(docs.opened && docs.started) {
+		return &ContentRef{}, errnodoc
+	}
+
+	r := C.c_dbxml_docs_content_result(docs.docs)
+	if C.c_dbxml_result_error(r) != 0 {
+		defer C.c_dbxml_result_free(r)
+		return &ContentRef{}, resultError(r)
+	}
+	// No finalizer: slices returned by ref.Bytes() refer to this memory, and the garbage collector doesn't know that
+	return &ContentRef{r: r, opened: true}, nil
+}
+
+// Get the content as a byte slice.
+//
+// The slice refers directly to memory not managed by Go. It must not be modified,
+// and it must not be used after ref.Free() is called.
+func (ref *ContentRef) Bytes() []byte {
+	ref.lock.Lock()
+	defer ref.lock.Unlock()
+	if !ref.opened {
+		return []byte{}
+	}
+	return cBytes(unsafe.Pointer(C.c_dbxml_result_string(ref.r)), int(C.c_dbxml_result_size(ref.r)))
+}
+
+// Release the memory of the content.
+//
+// This must be called explicitly, it is not called on garbage collection.
+func (ref *ContentRef) Free() {
+	ref.lock.Lock()
+	defer ref.lock.Unlock()
+	if ref.opened {
+		C.c_dbxml_result_free(ref.r)
+		ref.opened = false
+	}
+}
+
+func writeStream(s C.c_dbxml_stream, w io.Writer) (int64, error) {
+	if C.c_dbxml_stream_error(s) != 0 {
+		return 0, streamError(s)
+	}
+	buf := make([]byte, 65536)
+	var size int64
+	for {
+		n := C.c_dbxml_stream_read(s, (*C.char)(unsafe.Pointer(&buf[0])), C.uint(len(buf)))
+		if n < 0 {
+			return size, streamError(s)
+		}
+		if n == 0 {
+			return size, nil
+		}
+		m, err := w.Write(buf[:n])
+		size += int64(m)
+		if err != nil {
+			return size, err
+		}
+	}
+}
+
+//. Callbacks
+
+//export goReaderRead
+func goReaderRead(handle C.ulonglong, buf *C.char, size C.uint) C.longlong {
+	rd, ok := getHandle(uint64(handle)).(*reader)
+	if !ok || rd.err != nil || size == 0 {
+		return -1
+	}
+	p := cBytes(unsafe.Pointer(buf), int(size))
+	for {
+		n, err := rd.r.Read(p)
+		if err != nil && err != io.EOF {
+			rd.err = err
+			if n > 0 {
+				// the error is reported on the next call
+				return C.longlong(n)
+			}
+			return -1
+		}
+		if n > 0 || err == io.EOF {
+			return C.longlong(n)
+		}
+	}
+}
+
+//. Util
+
+// Create a byte slice that refers to memory not managed by Go.
+func cBytes(p unsafe.Pointer, size int) []byte {
+	if size == 0 {
+		return []byte{}
+	}
+	if size > 1<<30 {
+		// too large for the array type below, fall back to a copy
+		return C.GoBytes(p, C.int(size))
+	}
+	return (*[1 << 30]byte)(p)[:size:size]
+}
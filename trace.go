@@ -0,0 +1,84 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+//. Variables
+
+var (
+	// Only one query can be traced at a time
+	traceLock sync.Mutex
+)
+
+//. Trace
+
+// Run an XPATH query with debug output of DbXml enabled, and write that output to w.
+//
+// This shows how DbXml optimises and evaluates the query, and which indexes it uses.
+// The query is evaluated eagerly, so the trace is complete when this function returns.
+//
+// If w is nil and the query fails, the error is a *TraceError with the trace output.
+//
+// Log levels and categories are global, so while a query is traced, log messages of other
+// databases in the program also end up in the trace output, instead of the logger set with SetLogger().
+//
+// Example:
+//
+//      docs, err := db.QueryTrace(`//node[@cat="np"]`, os.Stderr)
+func (db *Db) QueryTrace(query string, w io.Writer, namespaces ...Namespace) (*Docs, error) {
+	q, err := db.prepare(query, true, namespaces...)
+	if err != nil {
+		return &Docs{}, err
+	}
+	if err := q.SetEvaluation(Eager); err != nil {
+		q.Close()
+		return &Docs{}, err
+	}
+
+	var buf bytes.Buffer
+	if w == nil {
+		w = &buf
+	}
+
+	traceLock.Lock()
+	defer traceLock.Unlock()
+
+	logLock.Lock()
+	logTrace = w
+	restore := (LogDebug | LogInfo) &^ logLevels
+	restoreCategories := (LogQuery | LogOptimizer) &^ logCategories
+	logLock.Unlock()
+
+	C.c_dbxml_set_log_category(C.int(LogQuery|LogOptimizer), 1)
+	C.c_dbxml_set_log_level(C.int(LogDebug|LogInfo), 1)
+
+	docs, err := q.Run()
+
+	if restore != 0 {
+		C.c_dbxml_set_log_level(C.int(restore), 0)
+	}
+	if restoreCategories != 0 {
+		C.c_dbxml_set_log_category(C.int(restoreCategories), 0)
+	}
+	logLock.Lock()
+	logTrace = nil
+	logLock.Unlock()
+
+	if err != nil && w == &buf {
+		return docs, &TraceError{Err: err, Trace: buf.String()}
+	}
+	return docs, err
+}
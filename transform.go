@@ -0,0 +1,163 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+//. Types
+
+// A function that transforms the content of a document before it is stored, set with db.SetTransform().
+//
+// For a document that is put with a generated name, name is the prefix.
+type Transform func(name string, data []byte) ([]byte, error)
+
+//. Transformations
+
+// Set a function that transforms the content of each document that is stored in the database.
+//
+// The function is applied to all documents that are put, updated, or merged into the database,
+// for instance for canonicalization, so all documents are stored in the same form.
+// If it returns an error, the document is not stored, and the error message is returned by the call that stores it.
+// Documents that are renamed, or changed with db.Update() or db.ApplyModify(), are not transformed.
+//
+// The transformations set with db.SetXInclude(), db.SetStripWhitespace() and db.SetTransformQuery() are applied first.
+// A nil function removes the transformation.
+// The function may be called concurrently. It must not call methods of db, and it must not panic.
+//
+// Example:
+//
+//      db.SetTransform(func(name string, data []byte) ([]byte, error) {
+//          return bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), nil
+//      })
+func (db *Db) SetTransform(t Transform) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	var h uint64
+	if t != nil {
+		h = newHandle(t)
+	}
+	C.c_dbxml_set_transform(db.db, C.ulonglong(h))
+	if db.transform != 0 {
+		freeHandle(db.transform)
+	}
+	db.transform = h
+	return nil
+}
+
+// Set an XQUERY that transforms the content of each document that is stored in the database.
+//
+// The document is the context item of the query, the first item of the result is stored instead.
+// If the query has no result, the document is not stored. See db.SetTransform() for which documents are transformed,
+// and the order of the transformations.
+// An empty query removes the transformation.
+//
+// Example, remove processing instructions outside the root element:
+//
+//      err := db.SetTransformQuery(`document { node()[not(. instance of processing-instruction())] }`)
+func (db *Db) SetTransformQuery(query string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	cs := C.CString(query)
+	defer C.free(unsafe.Pointer(cs))
+	r := C.c_dbxml_set_transform_query(db.db, cs)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
+
+// Resolve XInclude directives in each document that is stored in the database, so it is stored fully expanded.
+//
+// Each xi:include element is replaced by the root element of the included document, which is itself expanded.
+// Relative hrefs are resolved against the name of the document as a file path, relative to the current directory,
+// so for db.PutFile() against the location of the file. Included documents are read as in doc('uri') in a query,
+// so a resolver set with SetResolver() is used.
+// Only parse="xml" is supported, without xpointer, and xi:fallback is not used: a document that can't be expanded is not stored.
+//
+// This is applied before the transformations set with db.SetTransformQuery() and db.SetTransform(),
+// to the same documents. See db.SetTransform().
+//
+// Example:
+//
+//      db.SetXInclude(true)
+//      err := db.PutFile("corpus/book.xml", false) // includes chapter1.xml from corpus/
+func (db *Db) SetXInclude(enable bool) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	x := C.int(0)
+	if enable {
+		x = 1
+	}
+	r := C.c_dbxml_set_xinclude(db.db, x)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
+
+// Remove ignorable whitespace from each document that is stored in the database.
+//
+// Text nodes with only whitespace are removed from elements that have no other text, such as the
+// indentation between elements. Elements with mixed content, and elements with xml:space="preserve"
+// and their descendants, are kept as they are.
+// This makes the database smaller, especially with NodeStorage, and the results of string() cleaner.
+//
+// This is applied after db.SetXInclude(), and before the transformations set with db.SetTransformQuery() and db.SetTransform(),
+// to the same documents. See db.SetTransform().
+func (db *Db) SetStripWhitespace(enable bool) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return errclosed
+	}
+	x := C.int(0)
+	if enable {
+		x = 1
+	}
+	r := C.c_dbxml_set_strip_whitespace(db.db, x)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
+
+//. Callbacks
+
+// Returns 1 on success, 0 on failure with the error message as result. Result memory is freed by the caller.
+//
+//export goTransform
+func goTransform(handle C.ulonglong, name *C.char, data *C.char, size C.ulonglong, result **C.char, resultsize *C.ulonglong) C.int {
+	t, ok := getHandle(uint64(handle)).(Transform)
+	if !ok {
+		return setFunctionResult([]byte("Transformation not found"), result, resultsize, 0)
+	}
+	out, err := t(C.GoString(name), C.GoBytes(unsafe.Pointer(data), C.int(size)))
+	if err != nil {
+		return setFunctionResult([]byte(err.Error()), result, resultsize, 0)
+	}
+	return setFunctionResult(out, result, resultsize, 1)
+}
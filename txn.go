@@ -0,0 +1,377 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+//. Types
+
+// A transaction on a database, started with db.Begin().
+//
+// The database must be opened in an environment that was opened with EnvConfig.Transactional.
+//
+// A transaction must be used by one goroutine at a time. Operations in the transaction
+// don't wait for other operations on the database in this process, only for Berkeley DB locks.
+type Txn struct {
+	db     *Db
+	id     uint64
+	opened bool
+	txn    C.c_dbxml_txn
+	lock   sync.Mutex
+	events []ChangeEvent
+}
+
+// The isolation level of a transaction or a query.
+type Isolation int
+
+const (
+	// Full isolation for transactions. For queries, no isolation beyond the single read operation,
+	// or a snapshot in an environment with EnvConfig.Multiversion.
+	DefaultIsolation Isolation = iota
+
+	// Only read data that was committed. Read locks are released early.
+	ReadCommitted
+
+	// Also read data that was modified by other transactions but not committed yet. No read locks are used.
+	ReadUncommitted
+
+	// Read from a snapshot, as it was at the start. This requires EnvConfig.Multiversion.
+	Snapshot
+)
+
+//. Variables
+
+var (
+	errtxnclosed = errors.New("Transaction is closed")
+)
+
+const (
+	// The number of attempts by db.WithTxnRetry()
+	txnRetries = 10
+)
+
+//. Begin & End
+
+// Start a transaction.
+//
+// Call t.Commit() or t.Abort() to end it. Open transactions are aborted when the database is closed.
+func (db *Db) Begin() (*Txn, error) {
+	return db.BeginIsolation(DefaultIsolation)
+}
+
+// Start a transaction with the given isolation level.
+//
+// See: db.Begin()
+func (db *Db) BeginIsolation(level Isolation) (*Txn, error) {
+	t := &Txn{}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return t, errclosed
+	}
+	t.txn = C.c_dbxml_txn_begin(db.db, C.int(level))
+	if C.c_dbxml_txn_error(t.txn) != 0 {
+		err := newError(C.GoString(C.c_dbxml_txn_errstring(t.txn)), C.c_dbxml_errinfo_txn(t.txn))
+		C.c_dbxml_txn_free(t.txn)
+		return t, err
+	}
+	t.opened = true
+	t.db = db
+	db.qlock.Lock()
+	t.id = db.counter
+	db.counter++
+	db.txns[t.id] = t
+	db.qlock.Unlock()
+	return t, nil
+}
+
+// Run fn in a transaction, and commit it if fn returns nil. If fn returns an error, the transaction is aborted.
+//
+// If the transaction fails because of a deadlock, it is retried, a limited number of times.
+// So fn may be called more than once, and it should have no other side effects than operations on t.
+//
+// Example:
+//
+//      err := db.WithTxnRetry(func(t *dbxml.Txn) error {
+//          s, err := t.Get("counter.xml")
+//          if err != nil {
+//              return err
+//          }
+//          return t.PutXml("counter.xml", increment(s), true)
+//      })
+func (db *Db) WithTxnRetry(fn func(t *Txn) error) error {
+	var err error
+	for i := 0; i < txnRetries; i++ {
+		var t *Txn
+		t, err = db.Begin()
+		if err != nil {
+			return err
+		}
+		err = fn(t)
+		if err == nil {
+			err = t.Commit()
+		} else {
+			t.Abort()
+		}
+		if !errors.Is(err, ErrDeadlock) {
+			return err
+		}
+	}
+	return err
+}
+
+// Commit the transaction.
+//
+// The transaction is closed, even if the commit fails.
+func (t *Txn) Commit() error {
+	return t.end(true)
+}
+
+// Abort the transaction, undoing all its write operations.
+func (t *Txn) Abort() error {
+	return t.end(false)
+}
+
+func (t *Txn) end(commit bool) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.opened {
+		return errtxnclosed
+	}
+	var r C.c_dbxml_result
+	if commit {
+		r = C.c_dbxml_txn_commit(t.txn)
+	} else {
+		r = C.c_dbxml_txn_abort(t.txn)
+	}
+	defer C.c_dbxml_result_free(r)
+	db := t.db
+	t.close()
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	if commit && db != nil && len(t.events) > 0 {
+		db.notify(t.events...)
+	}
+	t.events = nil
+	return nil
+}
+
+// Free the transaction. The caller must hold the lock of the transaction.
+func (t *Txn) close() {
+	C.c_dbxml_txn_free(t.txn)
+	t.opened = false
+	if t.db != nil {
+		t.db.qlock.Lock()
+		delete(t.db.txns, t.id)
+		t.db.qlock.Unlock()
+		t.db = nil
+	}
+}
+
+// Abort all open transactions. The caller must hold the write lock of the database.
+func (db *Db) abortTxns() {
+	// Collect all the keys before starting to close, because closing will change the hash
+	keys := make([]uint64, 0, len(db.txns))
+	for key := range db.txns {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		db.txns[key].Abort()
+	}
+}
+
+//. Isolation
+
+// Set the isolation level for running the query.
+//
+// This is used when the query is run with query.Run(). Analytic queries that can tolerate
+// uncommitted data can use ReadUncommitted, so they don't hold up write operations.
+//
+// ReadUncommitted and Snapshot are only available for databases in a transactional environment.
+func (query *Query) SetIsolation(level Isolation) error {
+	query.lock.Lock()
+	defer query.lock.Unlock()
+
+	if !query.opened {
+		return errqueryclosed
+	}
+	C.c_dbxml_query_set_isolation(query.query, C.int(level))
+	return nil
+}
+
+//. Write
+
+// Put an xml document from memory into the database, in the transaction.
+func (t *Txn) PutXml(name string, data string, replace bool) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.opened {
+		return errtxnclosed
+	}
+
+	csname, buf := cstring(name)
+	defer buf.free()
+	csdata := C.CString(data)
+	defer C.free(unsafe.Pointer(csdata))
+	repl := C.int(0)
+	if replace {
+		repl = 1
+	}
+	r := C.c_dbxml_txn_put_xml(t.txn, csname, csdata, repl)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	t.events = append(t.events, ChangeEvent{Kind: ChangePut, Name: name})
+	return nil
+}
+
+// Remove an xml document from the database, in the transaction.
+func (t *Txn) Remove(name string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.opened {
+		return errtxnclosed
+	}
+
+	cs, buf := cstring(name)
+	defer buf.free()
+	r := C.c_dbxml_txn_remove(t.txn, cs)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	t.events = append(t.events, ChangeEvent{Kind: ChangeRemove, Name: name})
+	return nil
+}
+
+//. Read
+
+// Get an xml document by name from the database, in the transaction.
+func (t *Txn) Get(name string) (string, error) {
+	s, _, err := t.get(name)
+	return s, err
+}
+
+// Get a document, and the serialization of the database, read while the database can't be changed.
+func (t *Txn) get(name string) (string, Serialization, error) {
+	db, err := t.rlockDb()
+	if err != nil {
+		return "", Serialization{}, err
+	}
+	defer db.lock.RUnlock()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.opened {
+		return "", Serialization{}, errtxnclosed
+	}
+
+	cs, buf := cstring(name)
+	defer buf.free()
+	r := C.c_dbxml_txn_get(t.txn, cs)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return "", Serialization{}, resultError(r)
+	}
+	return C.GoString(C.c_dbxml_result_string(r)), db.output, nil
+}
+
+// Get the read lock of the database of the transaction, so its settings can't change while it is used.
+// The lock of the database is taken before the lock of the transaction, as in db.Close().
+// The caller must release the read lock, and check that the transaction is still open after taking its lock.
+func (t *Txn) rlockDb() (*Db, error) {
+	t.lock.Lock()
+	db := t.db
+	t.lock.Unlock()
+	if db == nil {
+		return nil, errtxnclosed
+	}
+	db.lock.RLock()
+	return db, nil
+}
+
+// Run an XPATH query on the default collection in the transaction.
+//
+// Iterate the results before the transaction ends. See: db.Query()
+func (t *Txn) Query(query string, namespaces ...Namespace) (*Docs, error) {
+	docs := &Docs{}
+	db, err := t.rlockDb()
+	if err != nil {
+		return docs, err
+	}
+	defer db.lock.RUnlock()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.opened {
+		return docs, errtxnclosed
+	}
+
+	cs := C.CString(query)
+	defer C.free(unsafe.Pointer(cs))
+	ns := make([]*C.char, 2*len(namespaces)+1)
+	for i, n := range namespaces {
+		ns[2*i] = C.CString(n.Prefix)
+		ns[2*i+1] = C.CString(n.Uri)
+	}
+	docs.docs = C.c_dbxml_txn_query(t.txn, cs, &ns[0])
+	for i := range namespaces {
+		C.free(unsafe.Pointer(ns[2*i]))
+		C.free(unsafe.Pointer(ns[2*i+1]))
+	}
+	if C.c_dbxml_get_query_error(docs.docs) != 0 {
+		defer C.c_dbxml_docs_free(docs.docs)
+		return docs, withQuery(docsError(docs.docs), db.queryText(cs, 1))
+	}
+	docs.output = db.output
+	docs.text = db.queryText(cs, 1)
+	runtime.SetFinalizer(docs, (*Docs).Close)
+	docs.opened = true
+	db.track(docs, query)
+	return docs, nil
+}
+
+// Get all xml documents from the database in the transaction.
+//
+// Iterate the results before the transaction ends. See: db.All()
+func (t *Txn) All() (*Docs, error) {
+	docs := &Docs{}
+	db, err := t.rlockDb()
+	if err != nil {
+		return docs, err
+	}
+	defer db.lock.RUnlock()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.opened {
+		return docs, errtxnclosed
+	}
+	docs.docs = C.c_dbxml_txn_get_all(t.txn)
+	if C.c_dbxml_get_query_error(docs.docs) != 0 {
+		defer C.c_dbxml_docs_free(docs.docs)
+		return docs, docsError(docs.docs)
+	}
+	docs.output = db.output
+	runtime.SetFinalizer(docs, (*Docs).Close)
+	docs.opened = true
+	db.track(docs, "txn.All()")
+	return docs, nil
+}
@@ -0,0 +1,41 @@
+package dbxml
+
+//. Imports
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+//. Variables
+
+var (
+	errelement = errors.New("Invalid element name")
+)
+
+//. Util
+
+// Check for a valid element name, with an optional prefix.
+func validName(name string) bool {
+	if name == "" || strings.HasPrefix(name, ":") || strings.HasSuffix(name, ":") || strings.Count(name, ":") > 1 {
+		return false
+	}
+	for i, c := range name {
+		if unicode.IsLetter(c) || c == '_' || c == ':' {
+			continue
+		}
+		if i > 0 && (unicode.IsDigit(c) || c == '-' || c == '.') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// Quote a string as an XQUERY string literal.
+func quoteString(s string) string {
+	s = strings.Replace(s, "&", "&amp;", -1)
+	s = strings.Replace(s, `"`, `""`, -1)
+	return `"` + s + `"`
+}
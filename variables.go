@@ -0,0 +1,94 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+//. Variables in queries
+
+// Bind a string value to the variable $name in the query.
+//
+// The variable must be declared in the query as external, so the query must be prepared with db.PrepareRaw() or env.Prepare().
+// The value is used when the query is run after this call, and can be changed between runs.
+// Variables set with a QueryContext don't need a declaration.
+//
+// Example:
+//
+//      query, _ := db.PrepareRaw(`declare variable $word external; collection()//node[@word = $word]`)
+//      query.SetVariable("word", "kat")
+//      docs, err := query.Run()
+func (query *Query) SetVariable(name, value string) error {
+	return query.setVariable(name, 0, value, nil)
+}
+
+// Bind an xml document, parsed from data, to the variable $name in the query.
+//
+// The document is a temporary document, not stored in the database. See query.SetVariable() for the declaration of the variable.
+// If DbXml can't parse the data, an error is returned.
+//
+// Example:
+//
+//      query, _ := db.PrepareRaw(`declare variable $words external; collection()//node[@word = $words//w]`)
+//      query.SetXmlVariable("words", "<words><w>kat</w><w>hond</w></words>")
+func (query *Query) SetXmlVariable(name, data string) error {
+	return query.setVariable(name, 1, data, nil)
+}
+
+// Bind the current item of docs, after a call to docs.Next(), to the variable $name in the query.
+//
+// For a query result that is a node, the node in the database itself is bound, not a copy,
+// so the query can navigate from it, for instance to its parent or to the root of its document.
+// Run the query before docs is closed. See query.SetVariable() for the declaration of the variable.
+//
+// Example, a two-phase query:
+//
+//      query, _ := db.PrepareRaw(`declare variable $s external; $s//node[@rel = "su"]`)
+//      docs, _ := db.Query(`//node[@cat = "smain"]`)
+//      for docs.Next() {
+//          query.SetNodeVariable("s", docs)
+//          subjects, err := query.Run()
+//          ...
+//      }
+func (query *Query) SetNodeVariable(name string, docs *Docs) error {
+	docs.lock.Lock()
+	defer docs.lock.Unlock()
+
+	if !docs.opened {
+		return errdocsclosed
+	}
+	if !docs.started {
+		return errnocurrent
+	}
+	return query.setVariable(name, 2, "", docs)
+}
+
+func (query *Query) setVariable(name string, what int, value string, docs *Docs) error {
+	query.lock.Lock()
+	defer query.lock.Unlock()
+
+	if !query.opened {
+		return errqueryclosed
+	}
+	csname := C.CString(name)
+	defer C.free(unsafe.Pointer(csname))
+	csvalue := C.CString(value)
+	defer C.free(unsafe.Pointer(csvalue))
+	var d C.c_dbxml_docs
+	if docs != nil {
+		d = docs.docs
+	}
+	r := C.c_dbxml_query_set_variable(query.query, csname, C.int(what), csvalue, d)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return resultError(r)
+	}
+	return nil
+}
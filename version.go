@@ -0,0 +1,156 @@
+package dbxml
+
+//. Imports
+
+/*
+#include <stdlib.h>
+#include "c_dbxml.h"
+*/
+import "C"
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+//. Types
+
+// A revision of a versioned document, as returned by db.History().
+type Revision struct {
+	Number int
+
+	// The time the revision was stored. Zero for a document that was stored before versioning was used on it.
+	Time time.Time
+}
+
+//. Constants
+
+const (
+	// The namespace of the metadata used for revisions, VERSION_URI in c_dbxml.cc
+	versionURI = "https://github.com/pebbe/dbxml/version"
+)
+
+//. Write
+
+// Put an xml document into the database as a new revision, keeping the previous revisions.
+//
+// Revisions are numbered from 1. If the document already exists without revisions, its current
+// content becomes revision 1. Returns the number of the new revision.
+//
+// Previous revisions are stored as metadata of the document. To keep them, only change the document
+// with db.PutXmlVersion() and db.Revert(). Other write operations, such as db.PutXml() with replace set
+// to true, drop the stored revisions, or change the current revision without keeping the previous one.
+func (db *Db) PutXmlVersion(name string, data string) (int, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return 0, errclosed
+	}
+	return db.putVersion(name, data)
+}
+
+// Store a revision. The caller must hold the write lock.
+func (db *Db) putVersion(name string, data string) (int, error) {
+	csname := C.CString(name)
+	defer C.free(unsafe.Pointer(csname))
+	csdata := C.CString(data)
+	defer C.free(unsafe.Pointer(csdata))
+	cswhen := C.CString(time.Now().UTC().Format(time.RFC3339Nano))
+	defer C.free(unsafe.Pointer(cswhen))
+	r := C.c_dbxml_put_version(db.db, csname, csdata, cswhen)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return 0, resultError(r)
+	}
+	db.notify(ChangeEvent{Kind: ChangePut, Name: name})
+	n, _ := strconv.Atoi(C.GoString(C.c_dbxml_result_string(r)))
+	return n, nil
+}
+
+// Store the content of revision n of a document as a new revision. Returns the number of the new revision.
+//
+// The revisions after n are kept, so a revert can be undone.
+func (db *Db) Revert(name string, n int) (int, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if !db.opened {
+		return 0, errclosed
+	}
+	content, err := db.getVersion(name, n)
+	if err != nil {
+		return 0, err
+	}
+	return db.putVersion(name, content)
+}
+
+//. Read
+
+// Get revision n of an xml document.
+//
+// If the revision doesn't exist, an error is returned for which errors.Is(err, ErrDocumentNotFound) is true.
+func (db *Db) GetVersion(name string, n int) (string, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return "", errclosed
+	}
+	content, err := db.getVersion(name, n)
+	if err != nil {
+		return "", err
+	}
+	if !db.output.isDefault() {
+		return db.output.apply(content), nil
+	}
+	return content, nil
+}
+
+// Get a revision. The caller must hold the lock.
+func (db *Db) getVersion(name string, n int) (string, error) {
+	cs := C.CString(name)
+	defer C.free(unsafe.Pointer(cs))
+	r := C.c_dbxml_get_version(db.db, cs, C.long(n))
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return "", resultError(r)
+	}
+	return C.GoStringN(C.c_dbxml_result_string(r), C.int(C.c_dbxml_result_size(r))), nil
+}
+
+// Get the list of revisions of an xml document, oldest first. The last one is the current content.
+//
+// A document that was never stored with db.PutXmlVersion() has one revision.
+func (db *Db) History(name string) ([]Revision, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return nil, errclosed
+	}
+
+	cs := C.CString(name)
+	defer C.free(unsafe.Pointer(cs))
+	r := C.c_dbxml_history(db.db, cs)
+	defer C.c_dbxml_result_free(r)
+	if C.c_dbxml_result_error(r) != 0 {
+		return nil, resultError(r)
+	}
+	b := C.GoBytes(unsafe.Pointer(C.c_dbxml_result_string(r)), C.int(C.c_dbxml_result_size(r)))
+	revs := make([]Revision, 0)
+	for len(b) > 0 {
+		var item [2]string
+		for j := range item {
+			p := bytes.IndexByte(b, 0)
+			item[j] = string(b[:p])
+			b = b[p+1:]
+		}
+		n, _ := strconv.Atoi(item[0])
+		t, _ := time.Parse(time.RFC3339Nano, item[1])
+		revs = append(revs, Revision{Number: n, Time: t})
+	}
+	return revs, nil
+}
@@ -0,0 +1,152 @@
+// +build cgo
+
+package dbxml
+
+//. Imports
+
+import (
+	"errors"
+)
+
+//. Types
+
+// A change to the documents in a database, reported by db.Watch().
+type ChangeEvent struct {
+	Kind ChangeKind
+
+	// The name of the document. Empty for ChangeMany.
+	Name string
+
+	// The previous name of the document, for ChangeRename.
+	OldName string
+}
+
+// The kind of a change to the documents in a database.
+type ChangeKind int
+
+const (
+	// A document was stored, as a new document or replacing an existing document.
+	ChangePut ChangeKind = iota
+
+	// The content of an existing document was replaced, with db.UpdateXml().
+	ChangeUpdate
+
+	// A document was removed.
+	ChangeRemove
+
+	// A document was renamed.
+	ChangeRename
+
+	// Any number of documents may have changed, for instance by db.Merge(), db.Update() or db.Truncate(),
+	// or because events were lost when the channel was full.
+	ChangeMany
+)
+
+type watcher struct {
+	ch   chan ChangeEvent
+	lost bool
+}
+
+//. Variables
+
+var (
+	errnotwatching = errors.New("Not watching this database")
+)
+
+const (
+	// The size of the channel returned by db.Watch()
+	watchBuffer = 256
+)
+
+//. Watch
+
+// Get notified of changes to documents in the database.
+//
+// Only changes made through this database handle are reported, including changes in transactions
+// started with db.Begin(), which are reported when the transaction is committed.
+// Changes made by other processes, or through another handle for the same file, are not reported.
+//
+// Events are never blocked on a slow reader. If the channel is full, events are dropped, and
+// a ChangeMany event is sent as soon as there is room again.
+//
+// The channel is closed by db.Unwatch(), or when the database is closed.
+//
+// Example:
+//
+//      ch, err := db.Watch()
+//      for ev := range ch {
+//          if ev.Kind == dbxml.ChangeMany {
+//              cache.Clear()
+//          } else {
+//              cache.Delete(ev.Name)
+//              cache.Delete(ev.OldName)
+//          }
+//      }
+func (db *Db) Watch() (<-chan ChangeEvent, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if !db.opened {
+		return nil, errclosed
+	}
+
+	db.wlock.Lock()
+	defer db.wlock.Unlock()
+	if db.watchers == nil {
+		db.watchers = make(map[<-chan ChangeEvent]*watcher)
+	}
+	w := &watcher{ch: make(chan ChangeEvent, watchBuffer)}
+	db.watchers[w.ch] = w
+	return w.ch, nil
+}
+
+// Stop watching for changes, and close the channel returned by db.Watch().
+func (db *Db) Unwatch(ch <-chan ChangeEvent) error {
+	db.wlock.Lock()
+	defer db.wlock.Unlock()
+
+	w, ok := db.watchers[ch]
+	if !ok {
+		return errnotwatching
+	}
+	delete(db.watchers, ch)
+	close(w.ch)
+	return nil
+}
+
+// Close all watch channels.
+func (db *Db) closeWatchers() {
+	db.wlock.Lock()
+	defer db.wlock.Unlock()
+
+	for ch, w := range db.watchers {
+		delete(db.watchers, ch)
+		close(w.ch)
+	}
+}
+
+// Send an event to all watchers, without blocking.
+func (db *Db) notify(events ...ChangeEvent) {
+	db.wlock.Lock()
+	defer db.wlock.Unlock()
+
+	for _, w := range db.watchers {
+		for _, ev := range events {
+			if w.lost {
+				select {
+				case w.ch <- ChangeEvent{Kind: ChangeMany}:
+					w.lost = false
+				default:
+				}
+			}
+			if w.lost {
+				break
+			}
+			select {
+			case w.ch <- ev:
+			default:
+				w.lost = true
+			}
+		}
+	}
+}